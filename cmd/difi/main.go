@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/oug-t/difi/internal/config"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/mbox"
+	"github.com/oug-t/difi/internal/patch"
+	"github.com/oug-t/difi/internal/pathdiff"
+	"github.com/oug-t/difi/internal/pipe"
+	"github.com/oug-t/difi/internal/plugin"
 	"github.com/oug-t/difi/internal/ui"
 	"github.com/oug-t/difi/internal/vcs"
 )
@@ -17,52 +27,116 @@ var version = "dev"
 func main() {
 	showVersion := flag.Bool("version", false, "Show version")
 	plain := flag.Bool("plain", false, "Print a plain summary")
-	forceVCS := flag.String("vcs", "", "Force specific VCS (git or hg)")
+	forceVCS := flag.String("vcs", "", "Force a VCS `backend`: "+strings.Join(vcs.BackendNames(), ", ")+", or the name of a difi-vcs-<name> plugin")
+	difftool := flag.Bool("difftool", false, "Compare two files or directories: LOCAL REMOTE [MERGED] (for git difftool / hg extdiff)")
+	noIndex := flag.Bool("no-index", false, "Compare two paths outside of any repository: difi --no-index PATH_A PATH_B")
+	checkPlugin := flag.String("check-plugin", "", "Validate the difi-vcs-`name` plugin against the repository in the current directory")
+	batch := flag.Bool("batch", false, "Load every diff from a single streamed git or hg diff, for large change sets")
+	conflicts := flag.Bool("conflicts", false, "Review and resolve the unmerged files of a merge or rebase")
+	strip := patch.AutoStrip
+	flag.IntVar(&strip, "p", patch.AutoStrip, "Strip `N` leading path components from a piped non-git diff, like patch -pN; -1 guesses")
+	flag.IntVar(&strip, "strip", patch.AutoStrip, "Same as -p `N`")
 	flag.Parse()
 
+	pathMode := *difftool || *noIndex
+
 	if *showVersion {
 		fmt.Printf("difi version %s\n", version)
 		os.Exit(0)
 	}
 
+	if *checkPlugin != "" {
+		os.Exit(runPluginCheck(*checkPlugin, flag.Arg(0)))
+	}
+
 	var pipedDiff string
-	if stat, _ := os.Stdin.Stat(); (stat.Mode() & os.ModeCharDevice) == 0 {
-		b, _ := io.ReadAll(os.Stdin)
-		pipedDiff = string(b)
+	var streamed *pipe.Diff
+	stat, _ := os.Stdin.Stat()
+	stdinPiped := (stat.Mode() & os.ModeCharDevice) == 0
+	// difftool and extdiff may hand us a non-terminal stdin; it never
+	// carries a diff in that mode.
+	if stdinPiped && !pathMode {
+		// git and hg diffs are shown while they arrive. The rest has to be
+		// read whole: GNU diff, svn, p4 and context diffs are rewritten in
+		// git's format, and mbox series are split into patches.
+		head, rest, ok := pipe.Sniff(os.Stdin)
+		if ok && !*plain {
+			streamed = pipe.New(io.MultiReader(strings.NewReader(head), rest))
+		} else {
+			b, _ := io.ReadAll(rest)
+			pipedDiff = head + string(b)
+			// Normalizing would drop the mail headers a series is told by.
+			if !mbox.IsSeries(pipedDiff) {
+				pipedDiff = patch.Normalize(pipedDiff, strip)
+			}
+		}
 	}
 
 	// Detect or force VCS type
 	var vcsClient vcs.VCS
-	if *forceVCS != "" {
-		switch *forceVCS {
-		case "git":
-			vcsClient = vcs.GitVCS{}
-		case "hg":
-			vcsClient = vcs.HgVCS{}
-		default:
-			fmt.Fprintf(os.Stderr, "Error: unsupported VCS '%s'. Supported values: git, hg\n", *forceVCS)
+	target := ""
+	if pathMode {
+		var pair pathdiff.Pair
+		var err error
+		if *difftool {
+			pair, err = difftoolPair(flag.Args())
+		} else {
+			pair, err = noIndexPair(flag.Args())
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		vcsClient = vcs.PathVCS{Pair: pair}
+		target = pair.Left
+	} else if *forceVCS != "" {
+		if b, ok := vcs.LookupBackend(*forceVCS); ok {
+			vcsClient = b.New()
+		} else if p, ok := plugin.Lookup(*forceVCS, workDir()); ok {
+			vcsClient = vcs.PluginVCS{Plugin: p}
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: unsupported VCS '%s'. Supported values: %s, or a %s<name> plugin on PATH\n",
+				*forceVCS, strings.Join(vcs.BackendNames(), ", "), plugin.Prefix)
 			os.Exit(1)
 		}
 	} else {
 		vcsClient = vcs.DetectVCS()
 	}
 
-	target := "HEAD"
-	if flag.NArg() > 0 {
+	if !pathMode && flag.NArg() > 0 {
 		target = flag.Arg(0)
 	}
+	if target == "" {
+		target = vcsClient.Backend().DefaultTarget
+	}
+	if target == "" {
+		target = "HEAD"
+	}
 
-	// For Mercurial, use "tip" as default instead of "HEAD"
-	if _, isHg := vcsClient.(vcs.HgVCS); isHg && target == "HEAD" {
-		target = "tip"
+	cfg := config.Load()
+	if *batch {
+		cfg.Diff.Batch = true
 	}
 
 	if *plain && pipedDiff == "" {
 		// Use VCS-specific commands for plain output
-		files, err := vcsClient.ListChangedFiles(target)
+		var files []string
+		var err error
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if cfg.Timeouts.Stats > 0 {
+			ctx, cancel = context.WithTimeout(ctx, cfg.Timeouts.Stats)
+		}
+		if c, ok := vcsClient.(vcs.Conflicts); ok && *conflicts {
+			files, err = c.UnmergedFiles()
+		} else {
+			renameOpts := diff.Options{RenameThreshold: cfg.Diff.RenameThreshold, FindCopies: cfg.Diff.Copies}
+			files, err = vcsClient.ListChangedFiles(ctx, target, renameOpts)
+		}
+		err = vcs.Classify(ctx, err)
+		cancel()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error listing changed files: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 		for _, file := range files {
 			fmt.Println(file)
@@ -70,18 +144,114 @@ func main() {
 		os.Exit(0)
 	}
 
-	cfg := config.Load()
-
 	opts := []tea.ProgramOption{tea.WithAltScreen()}
-	if pipedDiff != "" {
+	if stdinPiped {
 		if tty, err := os.Open("/dev/tty"); err == nil {
 			opts = append(opts, tea.WithInput(tty))
 		}
 	}
 
-	p := tea.NewProgram(ui.NewModel(cfg, target, pipedDiff, vcsClient), opts...)
+	var model ui.Model
+	if *conflicts {
+		m, err := ui.NewConflictModel(cfg, target, vcsClient)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		model = m
+	} else if streamed != nil {
+		model = ui.NewPipeModel(cfg, target, streamed, vcsClient)
+	} else {
+		model = ui.NewModel(cfg, target, pipedDiff, vcsClient)
+	}
+
+	p := tea.NewProgram(model, opts...)
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// Exit codes of --plain, so scripts can tell failures apart. 2 is left to
+// the flag package, which uses it for usage errors.
+const (
+	exitError           = 1
+	exitUnknownRevision = 3
+	exitNotRepository   = 4
+	exitToolMissing     = 5
+	exitTimeout         = 6
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, vcs.ErrUnknownRevision):
+		return exitUnknownRevision
+	case errors.Is(err, vcs.ErrNotRepository):
+		return exitNotRepository
+	case errors.Is(err, vcs.ErrToolMissing):
+		return exitToolMissing
+	case errors.Is(err, vcs.ErrTimeout):
+		return exitTimeout
+	}
+	return exitError
+}
+
+func workDir() string {
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// runPluginCheck validates the difi-vcs-<name> plugin in the current
+// directory, prints a line per operation and returns the exit code.
+func runPluginCheck(name, target string) int {
+	p, ok := plugin.Lookup(name, workDir())
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: %s%s not found on PATH\n", plugin.Prefix, name)
+		return 1
+	}
+
+	code := 0
+	for _, r := range plugin.Check(p, target) {
+		switch {
+		case r.Skipped:
+			fmt.Printf("skip  %-9s %v\n", r.Op, r.Err)
+		case r.Err != nil:
+			fmt.Printf("FAIL  %-9s %v\n", r.Op, r.Err)
+			code = 1
+		default:
+			fmt.Printf("ok    %s\n", r.Op)
+		}
+	}
+	return code
+}
+
+// difftoolPair builds the comparison from the positional arguments, which
+// git difftool and hg extdiff pass as LOCAL REMOTE [MERGED].
+func difftoolPair(args []string) (pathdiff.Pair, error) {
+	var pair pathdiff.Pair
+	if len(args) < 2 {
+		return pair, fmt.Errorf("--difftool expects two paths: LOCAL REMOTE [MERGED]")
+	}
+	pair.Left, pair.Right = args[0], args[1]
+	if len(args) > 2 {
+		pair.Name = args[2]
+	}
+	return pair, pair.Validate()
+}
+
+// noIndexPair mirrors `git diff --no-index`: comparing a file against a
+// directory compares it with the file of the same name inside it.
+func noIndexPair(args []string) (pathdiff.Pair, error) {
+	if len(args) != 2 {
+		return pathdiff.Pair{}, fmt.Errorf("--no-index expects exactly two paths")
+	}
+	pair := pathdiff.Pair{Left: args[0], Right: args[1]}
+	if info, err := os.Stat(pair.Right); err == nil && info.IsDir() {
+		if info, err := os.Stat(pair.Left); err == nil && !info.IsDir() {
+			pair.Right = filepath.Join(pair.Right, filepath.Base(pair.Left))
+		}
+	} else if info, err := os.Stat(pair.Left); err == nil && info.IsDir() {
+		pair.Left = filepath.Join(pair.Left, filepath.Base(pair.Right))
+	}
+	return pair, pair.Validate()
+}
@@ -0,0 +1,24 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// EditorCmd builds the command that opens path in editor at lineNumber,
+// when it is known. It runs in dir when set, with the terminal attached and
+// the target in DIFI_TARGET.
+func EditorCmd(dir, path string, lineNumber int, targetBranch, editor string) *exec.Cmd {
+	var args []string
+	if lineNumber > 0 {
+		args = append(args, fmt.Sprintf("+%d", lineNumber))
+	}
+	args = append(args, path)
+
+	c := exec.Command(editor, args...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	c.Dir = dir
+	c.Env = append(os.Environ(), fmt.Sprintf("DIFI_TARGET=%s", targetBranch))
+	return c
+}
@@ -0,0 +1,45 @@
+// Package backend holds what the version control backends share: running
+// their diff commands, reading the unified diffs they print and opening
+// files in an editor.
+package backend
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+)
+
+// stream is the output of a running command.
+type stream struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+}
+
+// Stream starts cmd and returns its output as it is written. Closing the
+// reader waits for the command and returns its error, so it must be closed
+// even after reading to the end.
+func Stream(cmd *exec.Cmd) (io.ReadCloser, error) {
+	s := &stream{cmd: cmd}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	s.ReadCloser = out
+	cmd.Stderr = &s.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close stops reading, which ends a command that is still writing, and
+// waits for it. A failure carries its stderr like one from Output would.
+func (s *stream) Close() error {
+	s.ReadCloser.Close()
+	err := s.cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitErr.Stderr = s.stderr.Bytes()
+	}
+	return err
+}
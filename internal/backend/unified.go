@@ -0,0 +1,153 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// SectionFunc returns the file the section starting at lines[i] is about.
+// The lines are free of color codes. A section whose file cannot be told
+// is reported with an empty path, so it ends the one before it.
+type SectionFunc func(lines []string, i int) (path string, ok bool)
+
+// CleanLines splits a diff into lines without color codes.
+func CleanLines(diffText string) []string {
+	lines := strings.Split(diffText, "\n")
+	for i, line := range lines {
+		lines[i] = diff.StripANSI(line)
+	}
+	return lines
+}
+
+// ParseFiles lists the files of a diff once each, in order.
+func ParseFiles(diffText string, section SectionFunc) []string {
+	var files []string
+	seen := make(map[string]bool)
+	lines := CleanLines(diffText)
+
+	for i := range lines {
+		if file, ok := section(lines, i); ok && file != "" && !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// ExtractFile returns the section of a diff about targetPath, colors and
+// all.
+func ExtractFile(diffText, targetPath string, section SectionFunc) string {
+	lines := strings.Split(diffText, "\n")
+	clean := CleanLines(diffText)
+	var out []string
+	inTarget := false
+
+	for i, line := range lines {
+		if path, ok := section(clean, i); ok {
+			inTarget = targetPath != "" && path == targetPath
+		}
+		if inTarget {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// CountLines counts the added and deleted lines of each file of a diff
+// printed without colors. start returns the file a line begins the changes
+// of, such as the "Index:" lines of svn and fossil.
+func CountLines(text string, start func(line string) (string, bool)) map[string][2]int {
+	result := make(map[string][2]int)
+	path := ""
+	parents := 0
+	for _, line := range strings.Split(text, "\n") {
+		if p, ok := start(line); ok {
+			path, parents = p, 0
+			continue
+		}
+		switch {
+		case diff.Parents(line) > 0:
+			parents = diff.Parents(line)
+		case path != "" && parents > 0:
+			s := result[path]
+			switch added, deleted := diff.Classify(line, parents); {
+			case added:
+				s[0]++
+			case deleted:
+				s[1]++
+			default:
+				continue
+			}
+			result[path] = s
+		}
+	}
+	return result
+}
+
+// Totals sums per-file [added, deleted] counts.
+func Totals(byFile map[string][2]int) (added, deleted int) {
+	for _, s := range byFile {
+		added += s[0]
+		deleted += s[1]
+	}
+	return added, deleted
+}
+
+// BinaryFiles returns the files of a diff that were left out as binary,
+// reading the diff once.
+func BinaryFiles(diffText string, section SectionFunc) map[string]bool {
+	result := make(map[string]bool)
+	lines := CleanLines(diffText)
+	path := ""
+	for i, line := range lines {
+		if p, ok := section(lines, i); ok {
+			path = p
+		}
+		if path != "" && diff.IsBinaryDiff(line) {
+			result[path] = true
+		}
+	}
+	return result
+}
+
+// CatFunc returns the contents of path at rev, or nil when the file does
+// not exist in that revision.
+type CatFunc func(ctx context.Context, rev, path string) ([]byte, error)
+
+// FileContents loads oldPath at oldRev and path at newRev, or from the
+// working copy under root when newRev is empty. oldPath defaults to path.
+func FileContents(ctx context.Context, cat CatFunc, root, oldRev, newRev, path, oldPath string) (diff.File, error) {
+	if oldPath == "" {
+		oldPath = path
+	}
+	f := diff.File{Path: path, OldPath: oldPath}
+	old, err := cat(ctx, oldRev, oldPath)
+	if err != nil {
+		return diff.File{}, err
+	}
+	f.Old, f.OldMissing = old, old == nil
+
+	if newRev != "" {
+		data, err := cat(ctx, newRev, path)
+		if err != nil {
+			return diff.File{}, err
+		}
+		f.New, f.NewMissing = data, data == nil
+		return f, nil
+	}
+	file := filepath.Join(root, path)
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return diff.File{}, err
+	}
+	f.New, f.NewMissing = data, os.IsNotExist(err)
+	// Only the working copy's mode is known without asking the backend.
+	if info, err := os.Lstat(file); err == nil {
+		f.NewMode = diff.Mode(info)
+	}
+	return f, nil
+}
@@ -0,0 +1,94 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+const indexDiff = "Index: a.txt\n" +
+	"===================================================================\n" +
+	"--- a.txt\n" +
+	"+++ a.txt\n" +
+	"\x1b[36m@@ -1,2 +1,2 @@\x1b[m\n" +
+	" one\n" +
+	"-two\n" +
+	"+TWO\n" +
+	"Index: img.png\n" +
+	"===================================================================\n" +
+	"Cannot display: file marked as a binary type.\n" +
+	"Index: b.txt\n" +
+	"===================================================================\n" +
+	"--- b.txt\n" +
+	"+++ b.txt\n" +
+	"@@ -0,0 +1 @@\n" +
+	"+new\n"
+
+func indexSection(lines []string, i int) (string, bool) {
+	return strings.CutPrefix(lines[i], "Index: ")
+}
+
+func TestParseFiles(t *testing.T) {
+	if got, want := ParseFiles(indexDiff, indexSection), []string{"a.txt", "img.png", "b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("ParseFiles() = %v, want %v", got, want)
+	}
+	out := ExtractFile(indexDiff, "a.txt", indexSection)
+	if !strings.HasPrefix(out, "Index: a.txt\n") || !strings.HasSuffix(out, "+TWO") {
+		t.Errorf("ExtractFile(a.txt) = %q", out)
+	}
+	if out := ExtractFile(indexDiff, "", indexSection); out != "" {
+		t.Errorf("ExtractFile(\"\") = %q, want nothing", out)
+	}
+	if got := BinaryFiles(indexDiff, indexSection); len(got) != 1 || !got["img.png"] {
+		t.Errorf("BinaryFiles() = %v, want [img.png]", got)
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	// The backends count diffs printed without colors.
+	got := CountLines(diff.StripANSI(indexDiff), func(line string) (string, bool) {
+		return strings.CutPrefix(line, "Index: ")
+	})
+	want := map[string][2]int{"a.txt": {1, 1}, "b.txt": {1, 0}}
+	if len(got) != len(want) || got["a.txt"] != want["a.txt"] || got["b.txt"] != want["b.txt"] {
+		t.Errorf("CountLines() = %v, want %v", got, want)
+	}
+	if added, deleted := Totals(got); added != 2 || deleted != 1 {
+		t.Errorf("Totals() = %d, %d, want 2, 1", added, deleted)
+	}
+}
+
+func TestFileContents(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "new.txt"), []byte("working\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	revs := map[string]string{"1:old.txt": "old\n", "2:new.txt": "two\n"}
+	cat := func(ctx context.Context, rev, path string) ([]byte, error) {
+		if data, ok := revs[rev+":"+path]; ok {
+			return []byte(data), nil
+		}
+		return nil, nil
+	}
+
+	f, err := FileContents(context.Background(), cat, root, "1", "", "new.txt", "old.txt")
+	if err != nil {
+		t.Fatalf("FileContents() error: %v", err)
+	}
+	if string(f.Old) != "old\n" || string(f.New) != "working\n" || f.OldMissing || f.NewMissing {
+		t.Errorf("FileContents(working copy) = %+v", f)
+	}
+
+	f, err = FileContents(context.Background(), cat, root, "1", "2", "new.txt", "")
+	if err != nil {
+		t.Fatalf("FileContents() error: %v", err)
+	}
+	if !f.OldMissing || string(f.New) != "two\n" {
+		t.Errorf("FileContents(1:2) = %+v, want a missing old side and the new one at 2", f)
+	}
+}
@@ -3,18 +3,57 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Editor string   `yaml:"editor"`
-	UI     UIConfig `yaml:"ui"`
+	Editor   string     `yaml:"editor"`
+	UI       UIConfig   `yaml:"ui"`
+	Diff     DiffConfig `yaml:"diff"`
+	Timeouts Timeouts   `yaml:"timeouts"`
 }
 
 type UIConfig struct {
 	LineNumbers string `yaml:"line_numbers"`
 	Theme       string `yaml:"theme"`
+	// Watch reloads the changes when files in the working tree are edited.
+	// It is off by default: it takes an inotify watch per directory.
+	Watch bool `yaml:"watch"`
+}
+
+// DiffConfig selects how per-file diffs are produced. Engine "vcs" asks
+// git/hg for the diff; "builtin" fetches both versions and diffs them
+// in-process.
+type DiffConfig struct {
+	Engine    string `yaml:"engine"`
+	Algorithm string `yaml:"algorithm"`
+	Context   int    `yaml:"context"`
+	WordDiff  bool   `yaml:"word_diff"`
+
+	IgnoreAllSpace    bool `yaml:"ignore_all_space"`
+	IgnoreSpaceChange bool `yaml:"ignore_space_change"`
+	IgnoreBlankLines  bool `yaml:"ignore_blank_lines"`
+	IgnoreCRAtEOL     bool `yaml:"ignore_cr_at_eol"`
+
+	// RenameThreshold is the similarity percentage needed to pair a
+	// deleted and an added file as a rename.
+	RenameThreshold int  `yaml:"rename_threshold"`
+	Copies          bool `yaml:"copies"`
+
+	// Batch loads every file's diff from a single run of git or hg, which
+	// is faster for large change sets than one run per viewed file.
+	Batch bool `yaml:"batch"`
+}
+
+// Timeouts bound how long a VCS command may run before it is killed. Zero
+// means no limit.
+type Timeouts struct {
+	// Diff applies to loading the diff of the selected file.
+	Diff time.Duration `yaml:"diff"`
+	// Stats applies to listing changed files and counting their lines.
+	Stats time.Duration `yaml:"stats"`
 }
 
 func Load() Config {
@@ -23,6 +62,17 @@ func Load() Config {
 			LineNumbers: "hybrid",
 			Theme:       "default",
 		},
+		Diff: DiffConfig{
+			Engine:    "vcs",
+			Algorithm: "myers",
+			Context:   3,
+
+			RenameThreshold: 50,
+		},
+		Timeouts: Timeouts{
+			Diff:  10 * time.Second,
+			Stats: 30 * time.Second,
+		},
 	}
 
 	home, _ := os.UserHomeDir()
@@ -0,0 +1,184 @@
+// Package conflict parses and resolves the conflict markers git and hg
+// leave in files that failed to merge.
+package conflict
+
+import (
+	"os"
+	"strings"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// Block is one conflicted region. Start and End index the lines of the
+// file, End being one past the closing ">>>>>>>" marker.
+type Block struct {
+	Start, End int
+
+	OursLabel, TheirsLabel string
+	Ours, Base, Theirs     []string
+	// HasBase is set once Base is known: for diff3-style conflicts, which
+	// include the common ancestor between "|||||||" and "=======", or by
+	// FillBase.
+	HasBase bool
+}
+
+// Choice says how to resolve a block.
+type Choice int
+
+const (
+	Ours Choice = iota
+	Theirs
+	// Both keeps ours followed by theirs.
+	Both
+)
+
+const markerLen = 7
+
+// marker reports whether line is a conflict marker made of c, which must
+// be followed by a space or the end of the line.
+func marker(line string, c byte) (label string, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, strings.Repeat(string(c), markerLen)) {
+		return "", false
+	}
+	if len(line) > markerLen && line[markerLen] != ' ' {
+		return "", false
+	}
+	return strings.TrimSpace(line[markerLen:]), true
+}
+
+// Parse finds the conflict blocks in a file's contents. Unterminated
+// blocks are ignored.
+func Parse(data []byte) []Block {
+	lines := diff.Lines(string(data))
+	var blocks []Block
+
+	const (
+		outside = iota
+		inOurs
+		inBase
+		inTheirs
+	)
+	state := outside
+	var cur Block
+	for i, line := range lines {
+		switch state {
+		case outside:
+			if label, ok := marker(line, '<'); ok {
+				cur = Block{Start: i, OursLabel: label}
+				state = inOurs
+			}
+		case inOurs:
+			if _, ok := marker(line, '|'); ok {
+				cur.HasBase = true
+				state = inBase
+			} else if _, ok := marker(line, '='); ok {
+				state = inTheirs
+			} else {
+				cur.Ours = append(cur.Ours, line)
+			}
+		case inBase:
+			if _, ok := marker(line, '='); ok {
+				state = inTheirs
+			} else {
+				cur.Base = append(cur.Base, line)
+			}
+		case inTheirs:
+			if label, ok := marker(line, '>'); ok {
+				cur.End = i + 1
+				cur.TheirsLabel = label
+				blocks = append(blocks, cur)
+				state = outside
+			} else {
+				cur.Theirs = append(cur.Theirs, line)
+			}
+		}
+	}
+	return blocks
+}
+
+// Resolve replaces block idx of data with the chosen side and returns the
+// new contents.
+func Resolve(data []byte, idx int, choice Choice) []byte {
+	blocks := Parse(data)
+	if idx < 0 || idx >= len(blocks) {
+		return data
+	}
+	b := blocks[idx]
+	lines := diff.Lines(string(data))
+
+	var keep []string
+	switch choice {
+	case Ours:
+		keep = b.Ours
+	case Theirs:
+		keep = b.Theirs
+	case Both:
+		keep = append(append([]string{}, b.Ours...), b.Theirs...)
+	}
+
+	var sb strings.Builder
+	for _, line := range lines[:b.Start] {
+		sb.WriteString(line)
+	}
+	for _, line := range keep {
+		sb.WriteString(line)
+	}
+	for _, line := range lines[b.End:] {
+		sb.WriteString(line)
+	}
+	return []byte(sb.String())
+}
+
+// FillBase sets the base of the blocks that lack one, as with the default
+// two-way markers, from base, the file as it was in the merge's common
+// ancestor. data is the file the blocks were parsed from. Each block gets
+// the lines of base between the ones its surroundings match in our side.
+func FillBase(blocks []Block, data, base []byte) {
+	lines := diff.Lines(string(data))
+	baseLines := diff.Lines(string(base))
+
+	// Our side of the file, and where each block lies in it.
+	var ours []string
+	spans := make([][2]int, len(blocks))
+	prev := 0
+	for i, b := range blocks {
+		ours = append(ours, lines[prev:b.Start]...)
+		spans[i][0] = len(ours)
+		ours = append(ours, b.Ours...)
+		spans[i][1] = len(ours)
+		prev = b.End
+	}
+	ours = append(ours, lines[prev:]...)
+
+	edits := diff.Compute(baseLines, ours, diff.Options{})
+	for i := range blocks {
+		if blocks[i].HasBase {
+			continue
+		}
+		start, end := spans[i][0], spans[i][1]
+		lo, hi := 0, len(baseLines)
+		for _, e := range edits {
+			if e.Op != diff.Equal {
+				continue
+			}
+			if e.B < start {
+				lo = e.A + 1
+			} else if e.B >= end {
+				hi = e.A
+				break
+			}
+		}
+		blocks[i].Base = baseLines[lo:max(hi, lo)]
+		blocks[i].HasBase = true
+	}
+}
+
+// Write replaces the contents of path, keeping its permissions.
+func Write(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, info.Mode().Perm())
+}
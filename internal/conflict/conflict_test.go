@@ -0,0 +1,114 @@
+package conflict
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const merged = `package main
+
+<<<<<<< HEAD
+const greeting = "hi"
+||||||| base
+const greeting = "hello"
+=======
+const greeting = "hey"
+>>>>>>> feature
+func main() {}
+<<<<<<< HEAD
+// ours
+=======
+// theirs
+>>>>>>> feature
+`
+
+func TestParse(t *testing.T) {
+	blocks := Parse([]byte(merged))
+	if len(blocks) != 2 {
+		t.Fatalf("Parse() found %d blocks, want 2", len(blocks))
+	}
+
+	b := blocks[0]
+	if b.Start != 2 || b.End != 9 || b.OursLabel != "HEAD" || b.TheirsLabel != "feature" {
+		t.Errorf("Parse()[0] = %+v", b)
+	}
+	if !b.HasBase || len(b.Base) != 1 || b.Base[0] != "const greeting = \"hello\"\n" {
+		t.Errorf("Parse()[0] base = %q, want the diff3 base", b.Base)
+	}
+	if blocks[1].HasBase || blocks[1].Ours[0] != "// ours\n" || blocks[1].Theirs[0] != "// theirs\n" {
+		t.Errorf("Parse()[1] = %+v", blocks[1])
+	}
+
+	if got := Parse([]byte("<<<<<<< HEAD\nunterminated\n")); len(got) != 0 {
+		t.Errorf("Parse() = %+v, want unterminated blocks ignored", got)
+	}
+	if got := Parse([]byte("<<<<<<<< not a marker\n========\n>>>>>>>>\n")); len(got) != 0 {
+		t.Errorf("Parse() = %+v, want eight-character runs ignored", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	theirs := string(Resolve([]byte(merged), 0, Theirs))
+	both := string(Resolve([]byte(theirs), 0, Both))
+
+	want := `package main
+
+const greeting = "hey"
+func main() {}
+// ours
+// theirs
+`
+	if both != want {
+		t.Errorf("Resolve():\nGot:\n%s\nWant:\n%s", both, want)
+	}
+	if len(Parse([]byte(both))) != 0 {
+		t.Error("Resolve() left conflict markers behind")
+	}
+
+	ours := string(Resolve([]byte(merged), 1, Ours))
+	if len(Parse([]byte(ours))) != 1 {
+		t.Error("Resolve(1) should only touch the second block")
+	}
+}
+
+func TestFillBase(t *testing.T) {
+	base := "package main\n\nconst greeting = \"hello\"\nfunc main() {}\n// base\n"
+	blocks := Parse([]byte(merged))
+	FillBase(blocks, []byte(merged), []byte(base))
+
+	if want := []string{"const greeting = \"hello\"\n"}; !slices.Equal(blocks[0].Base, want) {
+		t.Errorf("FillBase() changed the diff3 base to %q", blocks[0].Base)
+	}
+	if want := []string{"// base\n"}; !blocks[1].HasBase || !slices.Equal(blocks[1].Base, want) {
+		t.Errorf("FillBase() base of block 1 = %q, want %q", blocks[1].Base, want)
+	}
+
+	// Both sides added the lines: the base has nothing there.
+	added := Parse([]byte("a\n<<<<<<< HEAD\nx\n=======\ny\n>>>>>>> b\nz\n"))
+	FillBase(added, []byte("a\n<<<<<<< HEAD\nx\n=======\ny\n>>>>>>> b\nz\n"), []byte("a\nz\n"))
+	if !added[0].HasBase || len(added[0].Base) != 0 {
+		t.Errorf("FillBase() base = %q, want empty", added[0].Base)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.sh")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(path, []byte("new\n")); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("Write() left mode %v, want 0755", info.Mode().Perm())
+	}
+}
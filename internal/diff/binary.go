@@ -0,0 +1,131 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HexDumpLimit is the largest blob, in bytes, offered as a hex-dump diff.
+// Beyond that the dump is too long to review and slow to compute.
+const HexDumpLimit = 64 << 10
+
+// BlobInfo describes one side of a binary change.
+type BlobInfo struct {
+	// Missing marks a side on which the file does not exist.
+	Missing bool
+	// Known is false when only the diff text was available, e.g. a piped
+	// patch, so Size may be a guess and the rest is empty.
+	Known bool
+	Size  int
+	MIME  string
+	// Width and Height are set for PNG, JPEG and GIF images.
+	Width, Height int
+}
+
+// Describe inspects data, which is nil when the file is missing.
+func Describe(data []byte) BlobInfo {
+	if data == nil {
+		return BlobInfo{Missing: true, Known: true}
+	}
+	info := BlobInfo{Known: true, Size: len(data), MIME: http.DetectContentType(data)}
+	if strings.HasPrefix(info.MIME, "image/") {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			info.Width, info.Height = cfg.Width, cfg.Height
+		}
+	}
+	return info
+}
+
+// IsBinaryDiff reports whether diff text describes a binary change: git's
+// "Binary files ... differ" and "GIT binary patch", hg's "Binary file ...
+// has changed", svn's "Cannot display" or fossil's "cannot compute
+// difference". Colored output is accepted.
+func IsBinaryDiff(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.Contains(line, "GIT binary patch"),
+			strings.Contains(line, "Binary files ") && strings.Contains(line, " differ"),
+			strings.Contains(line, "Binary file ") && strings.Contains(line, " has changed"),
+			strings.Contains(line, "Cannot display: file marked as a binary type."),
+			strings.Contains(line, "cannot compute difference between binary files"):
+			return true
+		}
+	}
+	return false
+}
+
+var literalRe = regexp.MustCompile(`^literal (\d+)$`)
+
+// PatchSizes reads the sizes out of a "GIT binary patch", whose first
+// "literal N" block holds the new contents and the second the old. ok is
+// false when a side is encoded as a delta, which does not record the size.
+func PatchSizes(text string) (oldSize, newSize int, ok bool) {
+	var sizes []int
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "delta ") {
+			return 0, 0, false
+		}
+		if m := literalRe.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			sizes = append(sizes, n)
+		}
+	}
+	if len(sizes) != 2 {
+		return 0, 0, false
+	}
+	return sizes[1], sizes[0], true
+}
+
+// HexDump formats data like `hexdump -C`, sixteen bytes per line, so a
+// binary change can be diffed line by line.
+func HexDump(data []byte) []string {
+	var lines []string
+	for off := 0; off < len(data); off += 16 {
+		end := off + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[off:end]
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%08x ", off)
+		for i := 0; i < 16; i++ {
+			if i == 8 {
+				sb.WriteByte(' ')
+			}
+			if i < len(chunk) {
+				fmt.Fprintf(&sb, " %02x", chunk[i])
+			} else {
+				sb.WriteString("   ")
+			}
+		}
+		sb.WriteString("  |")
+		for _, c := range chunk {
+			if c >= 0x20 && c < 0x7f {
+				sb.WriteByte(c)
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteString("|\n")
+		lines = append(lines, sb.String())
+	}
+	return lines
+}
+
+// HexDiff renders the hunks between the hex dumps of two blobs. Offsets are
+// part of each line, so inserting bytes shows everything after the
+// insertion as changed, which is what a reviewer of a binary wants to see.
+func HexDiff(old, new []byte, opts Options) string {
+	a, b := HexDump(old), HexDump(new)
+	return Unified(a, b, Compute(a, b, Options{Algorithm: opts.Algorithm}), Options{Context: opts.Context})
+}
@@ -0,0 +1,66 @@
+package diff
+
+import "strings"
+
+// Parents returns the number of parents a hunk header compares against:
+// 1 for "@@ -a +b @@" and N for the N+1 '@' of a combined diff's
+// "@@@ -a -b +c @@@". It returns 0 for lines that are not hunk headers.
+func Parents(line string) int {
+	n := 0
+	for n < len(line) && line[n] == '@' {
+		n++
+	}
+	if n < 2 || n >= len(line) || line[n] != ' ' {
+		return 0
+	}
+	rest := line[n+1:]
+	for i := 0; i < n-1; i++ {
+		if !strings.HasPrefix(rest, "-") {
+			return 0
+		}
+		sp := strings.IndexByte(rest, ' ')
+		if sp < 0 {
+			return 0
+		}
+		rest = rest[sp+1:]
+	}
+	if !strings.HasPrefix(rest, "+") {
+		return 0
+	}
+	return n - 1
+}
+
+// Classify reads the prefix columns of a hunk line, one per parent. A line
+// with a '-' in any column is gone from the result; otherwise a '+' in any
+// column means it was added relative to at least one parent.
+func Classify(line string, parents int) (added, deleted bool) {
+	if parents < 1 || len(line) < parents {
+		return false, false
+	}
+	for _, c := range []byte(line[:parents]) {
+		switch c {
+		case '-':
+			deleted = true
+		case '+':
+			added = true
+		case ' ':
+		default:
+			return false, false
+		}
+	}
+	return added && !deleted, deleted
+}
+
+// InResult reports whether a hunk line is present in the new side, that is
+// a context or added line.
+func InResult(line string, parents int) bool {
+	if parents < 1 || len(line) < parents {
+		return false
+	}
+	for _, c := range []byte(line[:parents]) {
+		if c != ' ' && c != '+' {
+			return false
+		}
+	}
+	return true
+}
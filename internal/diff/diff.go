@@ -0,0 +1,298 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Op describes what happens to a single line when going from the old text
+// to the new one.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Edit is one line-level step of an edit script. A indexes the line in the
+// old input and B the line in the new input; the side an Op does not touch
+// is -1.
+type Edit struct {
+	Op Op
+	A  int
+	B  int
+}
+
+// Algorithm selects how an edit script is computed. All of them produce a
+// valid script; they differ in which of several equally short scripts they
+// pick and therefore in how readable the hunks are.
+type Algorithm int
+
+const (
+	Myers Algorithm = iota
+	Patience
+	Histogram
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case Patience:
+		return "patience"
+	case Histogram:
+		return "histogram"
+	default:
+		return "myers"
+	}
+}
+
+// ParseAlgorithm accepts the names git uses for --diff-algorithm.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "", "myers", "default":
+		return Myers, nil
+	case "patience":
+		return Patience, nil
+	case "histogram":
+		return Histogram, nil
+	default:
+		return Myers, fmt.Errorf("unknown diff algorithm %q", name)
+	}
+}
+
+// Options controls how two texts are compared and rendered.
+type Options struct {
+	// Builtin computes diffs in-process instead of asking the VCS.
+	Builtin   bool
+	Algorithm Algorithm
+	// Context is the number of unchanged lines around each change. Zero
+	// means the git default of three.
+	Context int
+
+	IgnoreAllSpace    bool
+	IgnoreSpaceChange bool
+	IgnoreBlankLines  bool
+	IgnoreCRAtEOL     bool
+
+	// WordDiff highlights the changed words inside modified lines.
+	WordDiff bool
+
+	// RenameThreshold is the minimum similarity, in percent, for a deleted
+	// and an added file to be paired as a rename. Zero means git's 50%.
+	RenameThreshold int
+	// FindCopies also pairs added files with unchanged sources (git -C).
+	FindCopies bool
+}
+
+// NeedsBuiltin reports whether opts ask for something only the in-process
+// engine can render.
+func (o Options) NeedsBuiltin() bool {
+	return o.Builtin || o.WordDiff
+}
+
+// IgnoresWhitespace reports whether any whitespace option is set.
+func (o Options) IgnoresWhitespace() bool {
+	return o.IgnoreAllSpace || o.IgnoreSpaceChange || o.IgnoreBlankLines || o.IgnoreCRAtEOL
+}
+
+// Threshold returns the effective rename similarity threshold.
+func (o Options) Threshold() int {
+	if o.RenameThreshold <= 0 || o.RenameThreshold > 100 {
+		return 50
+	}
+	return o.RenameThreshold
+}
+
+func (o Options) context() int {
+	if o.Context <= 0 {
+		return 3
+	}
+	return o.Context
+}
+
+// Lines splits text into lines, keeping the trailing "\n" on each line so a
+// missing newline at end of file counts as a difference.
+func Lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// binarySniffLen is how much of a blob is inspected for NUL bytes, the same
+// heuristic git uses to decide a file is binary.
+const binarySniffLen = 8000
+
+// IsBinary reports whether data looks like a binary file.
+func IsBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// Compute returns an edit script turning a into b. Lines are compared after
+// applying the whitespace options, but the script indexes the original
+// lines so they can be rendered untouched.
+func Compute(a, b []string, opts Options) []Edit {
+	ka, kb := intern(a, b, opts)
+	d := &differ{a: ka, b: kb, algo: opts.Algorithm}
+	d.run(0, len(ka), 0, len(kb))
+	return d.edits
+}
+
+// intern maps each normalized line to a small integer so the algorithms
+// compare ints instead of strings.
+func intern(a, b []string, opts Options) ([]int, []int) {
+	ids := make(map[string]int)
+	key := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			norm := normalize(line, opts)
+			id, ok := ids[norm]
+			if !ok {
+				id = len(ids)
+				ids[norm] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	return key(a), key(b)
+}
+
+func normalize(line string, opts Options) string {
+	if opts.IgnoreCRAtEOL {
+		if strings.HasSuffix(line, "\r\n") {
+			line = line[:len(line)-2] + "\n"
+		} else if strings.HasSuffix(line, "\r") {
+			line = line[:len(line)-1]
+		}
+	}
+	switch {
+	case opts.IgnoreAllSpace:
+		return strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+	case opts.IgnoreSpaceChange:
+		return strings.Join(strings.Fields(line), " ")
+	}
+	return line
+}
+
+// isBlank reports whether a line only holds whitespace.
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+type differ struct {
+	a, b  []int
+	algo  Algorithm
+	edits []Edit
+	// scratch holds bisect's paths, reused across calls.
+	scratch []int
+}
+
+func (d *differ) equal(i, j int) { d.edits = append(d.edits, Edit{Op: Equal, A: i, B: j}) }
+func (d *differ) delete(i int)   { d.edits = append(d.edits, Edit{Op: Delete, A: i, B: -1}) }
+func (d *differ) insert(j int)   { d.edits = append(d.edits, Edit{Op: Insert, A: -1, B: j}) }
+
+// run diffs a[a0:a1] against b[b0:b1], appending to d.edits in order.
+func (d *differ) run(a0, a1, b0, b1 int) {
+	a0, a1, b0, b1, suffix := d.trim(a0, a1, b0, b1)
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			d.insert(j)
+		}
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			d.delete(i)
+		}
+	case d.algo == Patience:
+		d.patience(a0, a1, b0, b1)
+	case d.algo == Histogram:
+		d.histogram(a0, a1, b0, b1)
+	default:
+		d.myers(a0, a1, b0, b1)
+	}
+
+	for k := 0; k < suffix; k++ {
+		d.equal(a1+k, b1+k)
+	}
+}
+
+// trim emits the common prefix of a[a0:a1] and b[b0:b1] and narrows the
+// ranges to what lies between it and the common suffix, whose length it
+// returns for the caller to emit last. Common prefixes and suffixes are by
+// far the most frequent case in source diffs, so they are stripped before
+// running the expensive part.
+func (d *differ) trim(a0, a1, b0, b1 int) (int, int, int, int, int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.equal(a0, b0)
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-1-suffix] == d.b[b1-1-suffix] {
+		suffix++
+	}
+	return a0, a1 - suffix, b0, b1 - suffix, suffix
+}
+
+// Rename records that a file was renamed or copied from another path.
+type Rename struct {
+	From string
+	// Similarity is the percentage of content kept from From.
+	Similarity int
+	Copy       bool
+}
+
+// Similarity estimates how much of old survives in new, in percent, by the
+// share of lines the two have in common. It is used for VCSs that record
+// renames without scoring them.
+func Similarity(old, new []byte) int {
+	a, b := Lines(string(old)), Lines(string(new))
+	if len(a)+len(b) == 0 {
+		return 100
+	}
+	common := 0
+	for _, e := range Compute(a, b, Options{}) {
+		if e.Op == Equal {
+			common++
+		}
+	}
+	return 200 * common / (len(a) + len(b))
+}
+
+// Stats counts the inserted and deleted lines of an edit script.
+func Stats(edits []Edit) (added, deleted int) {
+	for _, e := range edits {
+		switch e.Op {
+		case Insert:
+			added++
+		case Delete:
+			deleted++
+		}
+	}
+	return added, deleted
+}
+
+// Summary counts the changes of a whole comparison.
+type Summary struct {
+	Added, Deleted int
+	// ByFile holds each file's [added, deleted] counts, keyed by the new
+	// path of renamed files.
+	ByFile map[string][2]int
+	// Binary holds the files compared as binary.
+	Binary map[string]bool
+}
@@ -0,0 +1,578 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// apply rebuilds both inputs from an edit script so tests can check that a
+// script is valid without depending on which of several minimal scripts an
+// algorithm picks.
+func apply(t *testing.T, a, b []string, edits []Edit) {
+	t.Helper()
+	var gotA, gotB []string
+	for _, e := range edits {
+		switch e.Op {
+		case Equal:
+			if a[e.A] != b[e.B] {
+				t.Fatalf("equal edit joins different lines %q and %q", a[e.A], b[e.B])
+			}
+			gotA = append(gotA, a[e.A])
+			gotB = append(gotB, b[e.B])
+		case Delete:
+			gotA = append(gotA, a[e.A])
+		case Insert:
+			gotB = append(gotB, b[e.B])
+		}
+	}
+	if strings.Join(gotA, "") != strings.Join(a, "") {
+		t.Errorf("edit script does not reproduce old text: %q", gotA)
+	}
+	if strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Errorf("edit script does not reproduce new text: %q", gotB)
+	}
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a\n", []string{"a\n"}},
+		{"a\nb", []string{"a\n", "b"}},
+		{"a\n\nb\n", []string{"a\n", "\n", "b\n"}},
+	}
+
+	for _, tt := range tests {
+		got := Lines(tt.input)
+		if strings.Join(got, "|") != strings.Join(tt.expected, "|") || len(got) != len(tt.expected) {
+			t.Errorf("Lines(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		added   int
+		deleted int
+	}{
+		{"identical", "a\nb\nc\n", "a\nb\nc\n", 0, 0},
+		{"empty old", "", "a\nb\n", 2, 0},
+		{"empty new", "a\nb\n", "", 0, 2},
+		{"replace middle", "a\nb\nc\n", "a\nx\nc\n", 1, 1},
+		{"insert and delete", "a\nb\nc\nd\n", "b\nc\ne\nd\n", 1, 1},
+		{"classic", "a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n", 2, 3},
+		{"missing newline", "a\nb", "a\nb\n", 1, 1},
+	}
+
+	for _, algo := range []Algorithm{Myers, Patience, Histogram} {
+		for _, tt := range tests {
+			t.Run(algo.String()+"/"+tt.name, func(t *testing.T) {
+				a, b := Lines(tt.a), Lines(tt.b)
+				edits := Compute(a, b, Options{Algorithm: algo})
+				apply(t, a, b, edits)
+				added, deleted := Stats(edits)
+				if algo == Myers && (added != tt.added || deleted != tt.deleted) {
+					t.Errorf("Stats() = +%d -%d, want +%d -%d", added, deleted, tt.added, tt.deleted)
+				}
+			})
+		}
+	}
+}
+
+// TestComputeMinimal checks Myers against the shortest script's length,
+// n+m-2*LCS, on small random inputs.
+func TestComputeMinimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a'+r.Intn(3))) + "\n"
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := random(), random()
+		edits := Compute(a, b, Options{})
+		apply(t, a, b, edits)
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		if added, deleted := Stats(edits); added+deleted != len(a)+len(b)-2*lcs[0][0] {
+			t.Fatalf("Compute(%q, %q) = +%d -%d, want %d edits", a, b, added, deleted, len(a)+len(b)-2*lcs[0][0])
+		}
+	}
+}
+
+// TestComputeRewrite diffs two large files with nothing in common, which
+// takes as many edits as lines, in bounded memory.
+func TestComputeRewrite(t *testing.T) {
+	const n = 20000
+	a, b := make([]string, n), make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprintf("old %d\n", i)
+		b[i] = fmt.Sprintf("new %d\n", i)
+	}
+	for _, algo := range []Algorithm{Myers, Patience, Histogram} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		edits := Compute(a, b, Options{Algorithm: algo})
+		runtime.ReadMemStats(&after)
+
+		apply(t, a, b, edits)
+		if added, deleted := Stats(edits); added != n || deleted != n {
+			t.Errorf("%s: Stats() = +%d -%d, want +%d -%d", algo, added, deleted, n, n)
+		}
+		if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+			t.Errorf("%s: Compute() allocated %d MiB", algo, alloc>>20)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := Lines("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	b := Lines("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13")
+
+	expected := `@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+\ No newline at end of file
+`
+
+	got := Unified(a, b, Compute(a, b, Options{}), Options{})
+	if got != expected {
+		t.Errorf("Unified():\nGot:\n%s\nWant:\n%s", got, expected)
+	}
+}
+
+func TestUnifiedEmptySide(t *testing.T) {
+	b := Lines("only\n")
+	got := Unified(nil, b, Compute(nil, b, Options{}), Options{})
+	expected := "@@ -0,0 +1 @@\n+only\n"
+	if got != expected {
+		t.Errorf("Unified() = %q, want %q", got, expected)
+	}
+}
+
+func TestWhitespaceOptions(t *testing.T) {
+	a := Lines("if x {\n\tcall(a, b)\n}\r\n")
+	b := Lines("if x {\n    call(a,  b)  \n}\n")
+
+	tests := []struct {
+		name    string
+		opts    Options
+		changed bool
+	}{
+		{"exact", Options{}, true},
+		{"ignore space change", Options{IgnoreSpaceChange: true}, false},
+		{"ignore all space", Options{IgnoreAllSpace: true}, false},
+		{"ignore cr only", Options{IgnoreCRAtEOL: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, deleted := File{Path: "x", Old: []byte(strings.Join(a, "")), New: []byte(strings.Join(b, ""))}.Stats(tt.opts)
+			if changed := added+deleted > 0; changed != tt.changed {
+				t.Errorf("Stats() = +%d -%d, want changed=%v", added, deleted, tt.changed)
+			}
+		})
+	}
+}
+
+func TestIgnoreBlankLines(t *testing.T) {
+	f := File{
+		Path: "x",
+		Old:  []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"),
+		New:  []byte("a\n\nb\nc\nd\ne\nf\ng\nh\nI\nj\n"),
+	}
+
+	added, deleted := f.Stats(Options{IgnoreBlankLines: true})
+	if added != 1 || deleted != 1 {
+		t.Errorf("Stats() = +%d -%d, want +1 -1 (blank line ignored)", added, deleted)
+	}
+	added, deleted = f.Stats(Options{})
+	if added != 2 || deleted != 1 {
+		t.Errorf("Stats() = +%d -%d, want +2 -1", added, deleted)
+	}
+}
+
+func TestWordDiff(t *testing.T) {
+	oldLine, newLine := WordDiff("return foo(bar)\n", "return foo(baz)\n")
+	if oldLine != "return foo("+wordOn+"bar"+wordOff+")\n" {
+		t.Errorf("WordDiff() old = %q", oldLine)
+	}
+	if newLine != "return foo("+wordOn+"baz"+wordOff+")\n" {
+		t.Errorf("WordDiff() new = %q", newLine)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		file File
+		want string
+	}{
+		{
+			"deleted executable",
+			File{Path: "gone.sh", Old: []byte("bye\n"), NewMissing: true, OldMode: "100755"},
+			"diff --git a/gone.sh b/gone.sh\ndeleted file mode 100755\n--- a/gone.sh\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n",
+		},
+		{
+			"unknown mode left out",
+			File{Path: "new.txt", New: []byte("hi\n"), OldMissing: true},
+			"diff --git a/new.txt b/new.txt\n--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+hi\n",
+		},
+		{
+			"mode change",
+			File{Path: "run", Old: []byte("a\n"), New: []byte("a\n"), OldMode: "100644", NewMode: "100755"},
+			"diff --git a/run b/run\nold mode 100644\nnew mode 100755\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := Render(tt.file, Options{}); got != tt.want {
+			t.Errorf("%s: Render():\nGot:\n%s\nWant:\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkCompute(b *testing.B) {
+	var old, cur strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&old, "line %d\n", i)
+		if i%50 == 0 {
+			fmt.Fprintf(&cur, "changed %d\n", i)
+		} else {
+			fmt.Fprintf(&cur, "line %d\n", i)
+		}
+	}
+	a, bl := Lines(old.String()), Lines(cur.String())
+
+	for _, algo := range []Algorithm{Myers, Patience, Histogram} {
+		b.Run(algo.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Compute(a, bl, Options{Algorithm: algo})
+			}
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	if got := Similarity([]byte("a\nb\n"), []byte("a\nb\n")); got != 100 {
+		t.Errorf("Similarity(same) = %d, want 100", got)
+	}
+	if got := Similarity([]byte("a\nb\nc\nd\n"), []byte("a\nb\nx\ny\n")); got != 50 {
+		t.Errorf("Similarity(half) = %d, want 50", got)
+	}
+	if got := Similarity([]byte("a\n"), []byte("b\n")); got != 0 {
+		t.Errorf("Similarity(different) = %d, want 0", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	// A 3x2 GIF: header, logical screen descriptor and trailer are enough
+	// for DecodeConfig.
+	gif := []byte("GIF89a\x03\x00\x02\x00\x00\x00\x00;")
+	info := Describe(gif)
+	if info.MIME != "image/gif" || info.Width != 3 || info.Height != 2 || info.Size != len(gif) {
+		t.Errorf("Describe(gif) = %+v", info)
+	}
+	if !Describe(nil).Missing {
+		t.Error("Describe(nil) should mark the side missing")
+	}
+}
+
+func TestIsBinaryDiff(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"diff --git a/x b/x\nBinary files a/x and b/x differ\n", true},
+		{"diff --git a/x b/x\nGIT binary patch\nliteral 5\n", true},
+		{"diff -r 1234 x\nBinary file x has changed\n", true},
+		{"diff --git a/x b/x\n@@ -1 +1 @@\n-a\n+b\n", false},
+	}
+	for _, tt := range tests {
+		if got := IsBinaryDiff(tt.text); got != tt.want {
+			t.Errorf("IsBinaryDiff(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPatchSizes(t *testing.T) {
+	patch := "GIT binary patch\nliteral 12\nTcmZ?d00001\n\nliteral 7\nKcmZ?d00001\n"
+	oldSize, newSize, ok := PatchSizes(patch)
+	if !ok || oldSize != 7 || newSize != 12 {
+		t.Errorf("PatchSizes() = %d, %d, %v, want 7, 12, true", oldSize, newSize, ok)
+	}
+	if _, _, ok := PatchSizes("GIT binary patch\ndelta 3\nx\n\ndelta 4\ny\n"); ok {
+		t.Error("PatchSizes() should give up on deltas")
+	}
+}
+
+func TestHexDiff(t *testing.T) {
+	dump := HexDump([]byte("ABC\x00"))
+	if len(dump) != 1 || !strings.HasPrefix(dump[0], "00000000  41 42 43 00") || !strings.HasSuffix(dump[0], "|ABC.|\n") {
+		t.Errorf("HexDump() = %q", dump)
+	}
+
+	out := HexDiff([]byte("\x00\x01"), []byte("\x00\x02"), Options{})
+	if !strings.Contains(out, "-00000000  00 01") || !strings.Contains(out, "+00000000  00 02") {
+		t.Errorf("HexDiff() = %q", out)
+	}
+}
+
+func TestParents(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+	}{
+		{"@@ -1,2 +1,3 @@ func main()", 1},
+		{"@@@ -1,2 -1,3 +1,4 @@@", 2},
+		{"@@@@ -1 -1 -1 +1 @@@@", 3},
+		{"@@@ -1,2 +1,4 @@@", 0},
+		{"@@ text", 0},
+		{"+@@ -1 +1 @@", 0},
+	}
+	for _, tt := range tests {
+		if got := Parents(tt.line); got != tt.want {
+			t.Errorf("Parents(%q) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		line           string
+		parents        int
+		added, deleted bool
+		inResult       bool
+	}{
+		{"+x", 1, true, false, true},
+		{"-x", 1, false, true, false},
+		{" x", 1, false, false, true},
+		{"+++x", 1, true, false, true},
+		{"++x", 2, true, false, true},
+		{" +x", 2, true, false, true},
+		{"- x", 2, false, true, false},
+		{"  x", 2, false, false, true},
+		{"+x", 2, false, false, false},
+		{`\ No newline at end of file`, 1, false, false, false},
+	}
+	for _, tt := range tests {
+		added, deleted := Classify(tt.line, tt.parents)
+		if added != tt.added || deleted != tt.deleted {
+			t.Errorf("Classify(%q, %d) = %v, %v, want %v, %v", tt.line, tt.parents, added, deleted, tt.added, tt.deleted)
+		}
+		if got := InResult(tt.line, tt.parents); got != tt.inResult {
+			t.Errorf("InResult(%q, %d) = %v, want %v", tt.line, tt.parents, got, tt.inResult)
+		}
+	}
+}
+
+func TestQuotePath(t *testing.T) {
+	tests := []struct{ path, quoted string }{
+		{"main.go", "main.go"},
+		{"with space.go", "with space.go"},
+		{"café.go", `"caf\303\251.go"`},
+		{"tab\there", `"tab\there"`},
+		{`quote"back\slash`, `"quote\"back\\slash"`},
+		{"new\nline", `"new\nline"`},
+	}
+	for _, tt := range tests {
+		if got := QuotePath(tt.path); got != tt.quoted {
+			t.Errorf("QuotePath(%q) = %s, want %s", tt.path, got, tt.quoted)
+		}
+		if got := UnquotePath(tt.quoted); got != tt.path {
+			t.Errorf("UnquotePath(%s) = %q, want %q", tt.quoted, got, tt.path)
+		}
+	}
+	// Malformed quoting is left alone.
+	for _, s := range []string{`"open`, `"bad\q"`, `"x" y`} {
+		if got := UnquotePath(s); got != s {
+			t.Errorf("UnquotePath(%s) = %q, want it unchanged", s, got)
+		}
+	}
+}
+
+// headerCorpus pairs diff headers, as git and other tools print them, with
+// the old and new paths they name.
+var headerCorpus = []struct {
+	name     string
+	section  string
+	old, new string
+}{
+	{"plain", "diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@", "x.go", "x.go"},
+	{"space", "diff --git a/my file.go b/my file.go\n", "my file.go", "my file.go"},
+	{"contains b/", "diff --git a/a b/c.go b/a b/c.go\n", "a b/c.go", "a b/c.go"},
+	{"quoted", `diff --git "a/caf\303\251.go" "b/caf\303\251.go"` + "\n", "café.go", "café.go"},
+	{"quotePath off", "diff --git a/café.go b/café.go\n", "café.go", "café.go"},
+	{"tab", `diff --git "a/tab\there" "b/tab\there"` + "\n", "tab\there", "tab\there"},
+	{"mixed quoting", `diff --git a/plain "b/caf\303\251"` + "\nrename from plain\n" + `rename to "caf\303\251"` + "\n", "plain", "café"},
+	{"rename with b/", "diff --git a/x b/y.go b/z b/w.go\nsimilarity index 90%\nrename from x b/y.go\nrename to z b/w.go\n", "x b/y.go", "z b/w.go"},
+	{"renamed via ---/+++", "diff --git a/o b/p.go b/n b/p.go\n--- a/o b/p.go\t\n+++ b/n b/p.go\t\n@@ -1 +1 @@", "o b/p.go", "n b/p.go"},
+	{"new file", "diff --git a/n.go b/n.go\nnew file mode 100644\n--- /dev/null\n+++ b/n.go\n", "n.go", "n.go"},
+	{"no prefix", "diff --git x.go x.go\n--- x.go\n+++ x.go\n", "x.go", "x.go"},
+	{"mnemonic prefix", "diff --git c/x.go w/x.go\n--- c/x.go\n+++ w/x.go\n", "x.go", "x.go"},
+}
+
+func TestHeaderPaths(t *testing.T) {
+	for _, tt := range headerCorpus {
+		oldPath, newPath, ok := HeaderPaths(strings.Split(tt.section, "\n"), 0)
+		if !ok || oldPath != tt.old || newPath != tt.new {
+			t.Errorf("%s: HeaderPaths() = %q, %q, %v, want %q, %q", tt.name, oldPath, newPath, ok, tt.old, tt.new)
+		}
+	}
+	if _, _, ok := HeaderPaths([]string{"diff -r 1234 x"}, 0); ok {
+		t.Error("HeaderPaths() accepted an hg header")
+	}
+
+	for _, header := range []string{"diff --cc merged.go", `diff --combined "caf\303\251"`} {
+		path, ok := SectionPath([]string{header}, 0)
+		if want := UnquotePath(header[strings.LastIndex(header, " ")+1:]); !ok || path != want {
+			t.Errorf("SectionPath(%q) = %q, %v, want %q", header, path, ok, want)
+		}
+	}
+}
+
+// FuzzHeaderPaths checks that any path survives being written into a git
+// header by Render and read back, with and without the ---/+++ lines.
+func FuzzHeaderPaths(f *testing.F) {
+	for _, tt := range headerCorpus {
+		f.Add(tt.old, tt.new)
+	}
+	f.Fuzz(func(t *testing.T, oldPath, newPath string) {
+		if !validPath(oldPath) || !validPath(newPath) {
+			t.Skip()
+		}
+		out := Render(File{Path: newPath, OldPath: oldPath, Old: []byte("a\n"), New: []byte("b\n")}, Options{})
+		lines := strings.Split(out, "\n")
+		gotOld, gotNew, ok := HeaderPaths(lines, 0)
+		if !ok || gotOld != oldPath || gotNew != newPath {
+			t.Fatalf("HeaderPaths(%q) = %q, %q, %v", out, gotOld, gotNew, ok)
+		}
+		if oldPath == newPath {
+			// Alone, the header must be enough for a file that keeps its name.
+			gotOld, gotNew, ok = HeaderPaths(lines[:1], 0)
+			if !ok || gotOld != oldPath || gotNew != newPath {
+				t.Fatalf("HeaderPaths(%q) = %q, %q, %v", lines[0], gotOld, gotNew, ok)
+			}
+		}
+	})
+}
+
+// validPath rules out names git cannot track: empty ones, ones with a NUL,
+// and ones with empty or trailing-space components the header cannot carry.
+func validPath(p string) bool {
+	if p == "" || strings.ContainsRune(p, 0) || strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") ||
+		strings.Contains(p, "//") || strings.TrimSpace(p) != p {
+		return false
+	}
+	return true
+}
+
+func TestReadSections(t *testing.T) {
+	input := "Subject: a commit message\n\n" +
+		"\x1b[1mdiff --git a/a.go b/a.go\x1b[m\n" +
+		"--- a/a.go\n+++ b/a.go\n@@ -1 +1,2 @@\n\x1b[31m-x\x1b[m\n+y\n+z\n" +
+		"diff --git a/img.png b/img.png\nBinary files a/img.png and b/img.png differ\n" +
+		"diff --git a/old.go b/new.go\nsimilarity index 90%\nrename from old.go\nrename to new.go\n" +
+		"diff --cc merged.go\n@@@ -1,1 -1,1 +1,1 @@@\n- a\n -b\n++c\n" +
+		"diff -r 0123456789ab hg.txt\n--- a/hg.txt\n+++ b/hg.txt\n@@ -1 +1 @@\n-p\n+q"
+
+	var got []Section
+	if err := ReadSections(strings.NewReader(input), func(s Section) error {
+		got = append(got, s)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadSections() error: %v", err)
+	}
+
+	want := []Section{
+		{Path: "a.go", Added: 2, Deleted: 1},
+		{Path: "img.png", Binary: true},
+		{Path: "new.go", Rename: Rename{From: "old.go", Similarity: 90}},
+		{Path: "merged.go", Added: 1, Deleted: 2},
+		{Path: "hg.txt", Added: 1, Deleted: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ReadSections() found %d sections, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		w.Text = g.Text
+		if g != w {
+			t.Errorf("section %d = %+v, want %+v", i, g, w)
+		}
+	}
+	if !strings.HasPrefix(got[0].Text, "\x1b[1mdiff --git") || !strings.HasSuffix(got[0].Text, "+z\n") {
+		t.Errorf("section 0 text = %q, want the colored lines of a.go", got[0].Text)
+	}
+	if !strings.HasSuffix(got[4].Text, "+q\n") {
+		t.Errorf("last section text = %q, want a final newline", got[4].Text)
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "no ansi codes",
+			input:    "plain text",
+			expected: "plain text",
+		},
+		{
+			name:     "colored text",
+			input:    "\033[31mred text\033[0m",
+			expected: "red text",
+		},
+		{
+			name:     "multiple colors",
+			input:    "\033[32m+added\033[0m \033[31m-deleted\033[0m",
+			expected: "+added -deleted",
+		},
+		{
+			name:     "complex ansi",
+			input:    "\033[1;32m+\033[0m\033[32mline\033[0m",
+			expected: "+line",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := StripANSI(tt.input)
+			if result != tt.expected {
+				t.Errorf("StripANSI(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
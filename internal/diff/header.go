@@ -0,0 +1,218 @@
+package diff
+
+import "strings"
+
+// cEscapes are the escapes git uses when it C-quotes a path, and
+// cUnescapes their reverse.
+var (
+	cEscapes   = map[byte]byte{'\a': 'a', '\b': 'b', '\t': 't', '\n': 'n', '\v': 'v', '\f': 'f', '\r': 'r', '"': '"', '\\': '\\'}
+	cUnescapes = make(map[byte]byte, len(cEscapes))
+)
+
+func init() {
+	for raw, e := range cEscapes {
+		cUnescapes[e] = raw
+	}
+}
+
+// QuotePath quotes path the way git does with core.quotePath on: paths
+// holding a double quote, a backslash, a control character or a non-ASCII
+// byte are wrapped in double quotes with those bytes escaped. Other paths,
+// including ones with spaces, are returned as is.
+func QuotePath(path string) string {
+	needs := false
+	for i := 0; i < len(path); i++ {
+		if c := path[i]; c < 0x20 || c == '"' || c == '\\' || c >= 0x7f {
+			needs = true
+			break
+		}
+	}
+	if !needs {
+		return path
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if e, ok := cEscapes[c]; ok {
+			sb.WriteByte('\\')
+			sb.WriteByte(e)
+		} else if c < 0x20 || c >= 0x7f {
+			sb.WriteByte('\\')
+			sb.WriteByte('0' + c>>6)
+			sb.WriteByte('0' + c>>3&7)
+			sb.WriteByte('0' + c&7)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// GitName is path as git writes it in headers: behind a prefix such as
+// "a/", quoted along with it when needed.
+func GitName(prefix, path string) string {
+	return QuotePath(prefix + path)
+}
+
+// UnquotePath undoes QuotePath. A path that is not quoted is returned as
+// is, which also covers git's output with core.quotePath off.
+func UnquotePath(s string) string {
+	path, rest, ok := cutQuoted(s)
+	if !ok || rest != "" {
+		return s
+	}
+	return path
+}
+
+// cutQuoted decodes the C-quoted string at the start of s and returns what
+// follows it.
+func cutQuoted(s string) (path, rest string, ok bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", s, false
+	}
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return sb.String(), s[i+1:], true
+		case c != '\\':
+			sb.WriteByte(c)
+		case i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]):
+			sb.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 3
+		case i+1 < len(s) && cUnescapes[s[i+1]] != 0:
+			sb.WriteByte(cUnescapes[s[i+1]])
+			i++
+		default:
+			return "", s, false
+		}
+	}
+	return "", s, false
+}
+
+func isOctal(c byte) bool { return c >= '0' && c <= '7' }
+
+// HeaderPaths reads the old and new paths of the file section whose
+// "diff --git" header is lines[i]. Lines must be free of color codes.
+//
+// Unquoted names are ambiguous in the header when they contain spaces, so
+// like git it relies on both names being the same, and otherwise on the
+// "rename"/"copy" and "---"/"+++" lines that follow, which hold one name
+// each. Prefixes are dropped whether they are a/ and b/, mnemonic ones such
+// as c/ and w/, or missing because of --no-prefix.
+func HeaderPaths(lines []string, i int) (oldPath, newPath string, ok bool) {
+	rest, ok := strings.CutPrefix(lines[i], "diff --git ")
+	if !ok {
+		return "", "", false
+	}
+
+	prefixed := true
+	switch {
+	case strings.HasPrefix(rest, `"`):
+		a, after, ok := cutQuoted(rest)
+		if !ok || !strings.HasPrefix(after, " ") {
+			return "", "", false
+		}
+		oldPath, newPath = a, UnquotePath(after[1:])
+	case strings.HasSuffix(rest, `"`) && strings.Contains(rest, ` "`):
+		sp := strings.LastIndex(rest, ` "`)
+		oldPath, newPath = rest[:sp], UnquotePath(rest[sp+1:])
+	default:
+		if name, ok := sameName(rest, 2); ok {
+			oldPath, newPath = rest[:2]+name, rest[:2]+name
+		} else if name, ok := sameName(rest, 0); ok {
+			oldPath, newPath, prefixed = name, name, false
+		} else if a, b, ok := strings.Cut(rest, " b/"); ok {
+			oldPath, newPath = a, "b/"+b
+		} else {
+			return "", "", false
+		}
+	}
+	if prefixed {
+		oldPath, newPath = dropPrefix(oldPath), dropPrefix(newPath)
+	}
+
+	for _, line := range lines[i+1:] {
+		if strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "@@") {
+			break
+		}
+		if name, ok := cutName(line, "rename from ", "copy from "); ok {
+			oldPath = name
+		} else if name, ok := cutName(line, "rename to ", "copy to "); ok {
+			newPath = name
+		} else if name, ok := cutName(line, "--- "); ok && name != "/dev/null" {
+			oldPath = prefixedName(name, prefixed)
+		} else if name, ok := cutName(line, "+++ "); ok && name != "/dev/null" {
+			newPath = prefixedName(name, prefixed)
+		}
+	}
+	return oldPath, newPath, true
+}
+
+// SectionPath returns the path the file section starting at lines[i] is
+// listed under: the new path of a "diff --git" header, or the path of the
+// "diff --cc"/"diff --combined" header of a merge. Lines must be free of
+// color codes.
+func SectionPath(lines []string, i int) (string, bool) {
+	if path, ok := strings.CutPrefix(lines[i], "diff --cc "); ok {
+		return UnquotePath(path), true
+	}
+	if path, ok := strings.CutPrefix(lines[i], "diff --combined "); ok {
+		return UnquotePath(path), true
+	}
+	oldPath, newPath, ok := HeaderPaths(lines, i)
+	if newPath == "" {
+		newPath = oldPath
+	}
+	return newPath, ok
+}
+
+// sameName checks rest against "<prefix>NAME <prefix>NAME" for prefixes of
+// prefixLen bytes, the form git's header takes when a file keeps its name.
+func sameName(rest string, prefixLen int) (string, bool) {
+	n := len(rest) - 1 - 2*prefixLen
+	if n <= 0 || n%2 != 0 {
+		return "", false
+	}
+	n /= 2
+	a, b := rest[:prefixLen+n], rest[prefixLen+n+1:]
+	if rest[prefixLen+n] != ' ' || a[prefixLen:] != b[prefixLen:] {
+		return "", false
+	}
+	if prefixLen > 0 && (a[prefixLen-1] != '/' || b[prefixLen-1] != '/') {
+		return "", false
+	}
+	return a[prefixLen:], true
+}
+
+func dropPrefix(path string) string {
+	if len(path) > 2 && path[1] == '/' {
+		return path[2:]
+	}
+	return path
+}
+
+// cutName returns the unquoted name after any of the prefixes. git ends
+// "---"/"+++" names that hold a space with a tab, which is dropped.
+func cutName(line string, prefixes ...string) (string, bool) {
+	for _, p := range prefixes {
+		if name, ok := strings.CutPrefix(line, p); ok {
+			if !strings.HasPrefix(name, `"`) {
+				name = strings.TrimSuffix(name, "\t")
+			}
+			return UnquotePath(name), true
+		}
+	}
+	return "", false
+}
+
+func prefixedName(name string, prefixed bool) string {
+	if prefixed {
+		return dropPrefix(name)
+	}
+	return name
+}
@@ -0,0 +1,78 @@
+package diff
+
+// maxChainLen caps how often a line may occur in the old side and still be
+// used as an anchor, as in git's histogram diff. Very common lines such as
+// "}" make poor anchors.
+const maxChainLen = 64
+
+// histogram is git's extension of patience diff: instead of requiring
+// unique lines it anchors on the longest common region containing the
+// least frequent line, then recurses on both sides of it.
+func (d *differ) histogram(a0, a1, b0, b1 int) {
+	occurrences := make(map[int][]int)
+	for i := a0; i < a1; i++ {
+		occurrences[d.a[i]] = append(occurrences[d.a[i]], i)
+	}
+
+	bestA, bestB, bestLen := 0, 0, 0
+	bestCount := maxChainLen + 1
+	for j := b0; j < b1; {
+		positions := occurrences[d.b[j]]
+		next := j + 1
+		if len(positions) == 0 || len(positions) > bestCount {
+			j = next
+			continue
+		}
+		for _, i := range positions {
+			s, t := i, j
+			for s > a0 && t > b0 && d.a[s-1] == d.b[t-1] {
+				s--
+				t--
+			}
+			e, f := i+1, j+1
+			for e < a1 && f < b1 && d.a[e] == d.b[f] {
+				e++
+				f++
+			}
+			count := maxChainLen + 1
+			for k := s; k < e; k++ {
+				if c := len(occurrences[d.a[k]]); c < count {
+					count = c
+				}
+			}
+			if count < bestCount || (count == bestCount && e-s > bestLen) ||
+				(count == bestCount && e-s == bestLen && closer(s, bestA, a0, a1)) {
+				bestA, bestB, bestLen, bestCount = s, t, e-s, count
+			}
+			if f > next {
+				next = f
+			}
+		}
+		j = next
+	}
+
+	if bestLen == 0 {
+		d.myers(a0, a1, b0, b1)
+		return
+	}
+	d.run(a0, bestA, b0, bestB)
+	for k := 0; k < bestLen; k++ {
+		d.equal(bestA+k, bestB+k)
+	}
+	d.run(bestA+bestLen, a1, bestB+bestLen, b1)
+}
+
+// closer breaks ties between equally good anchors in favour of the one
+// nearer the middle of the region, which keeps the recursion balanced on
+// files with many similar changes.
+func closer(candidate, best, a0, a1 int) bool {
+	mid := (a0 + a1) / 2
+	return abs(candidate-mid) < abs(best-mid)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,157 @@
+package diff
+
+// myersMinCost is the fewest edits bisect looks through before it settles
+// for a good split over the best one. Past it, the budget grows with the
+// square root of the input, as in git.
+const myersMinCost = 256
+
+// myers is Myers' O((N+M)D) algorithm in its linear-space form: bisect
+// finds where a shortest edit script crosses its middle, searching from
+// both ends at once, and the parts before and after are diffed the same
+// way. Memory stays linear however much the inputs differ.
+func (d *differ) myers(a0, a1, b0, b1 int) {
+	a0, a1, b0, b1, suffix := d.trim(a0, a1, b0, b1)
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			d.insert(j)
+		}
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			d.delete(i)
+		}
+	default:
+		x, y := d.bisect(a0, a1, b0, b1)
+		d.myers(a0, x, b0, y)
+		d.myers(x, a1, y, b1)
+	}
+	for k := 0; k < suffix; k++ {
+		d.equal(a1+k, b1+k)
+	}
+}
+
+// bisect returns a point the edit script of a[a0:a1] and b[b0:b1] passes
+// through, other than both ends. The ranges must be non-empty and differ in
+// their first and last lines. When the inputs are too far apart to search
+// to the middle in budget, it returns the point the forward search got
+// furthest to instead, which keeps the cost down at the price of a script
+// that may not be the shortest.
+func (d *differ) bisect(a0, a1, b0, b1 int) (x, y int) {
+	a, b := d.a[a0:a1], d.b[b0:b1]
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	if cap(d.scratch) < 4*maxD+4 {
+		d.scratch = make([]int, 4*maxD+4)
+	}
+	fwd, rev := d.scratch[:2*maxD+2], d.scratch[2*maxD+2:4*maxD+4]
+	for i := range fwd {
+		fwd[i], rev[i] = -1, -1
+	}
+	fwd[offset+1], rev[offset+1] = 0, 0
+
+	budget := max(myersMinCost, isqrt(n+m))
+	delta := n - m
+	// With an odd delta the searches meet on a forward step, otherwise on
+	// a reverse one.
+	front := delta%2 != 0
+	// Diagonals whose paths ran off the edge are not looked at again.
+	kStart1, kEnd1, kStart2, kEnd2 := 0, 0, 0, 0
+
+	for step := 0; step < maxD; step++ {
+		if step == budget {
+			return d.furthest(a0, b0, n, m, fwd, offset, step-1-kStart1, step-1-kEnd1)
+		}
+		for k := -step + kStart1; k <= step-kEnd1; k += 2 {
+			i := offset + k
+			var x1 int
+			if k == -step || (k != step && fwd[i-1] < fwd[i+1]) {
+				x1 = fwd[i+1]
+			} else {
+				x1 = fwd[i-1] + 1
+			}
+			y1 := x1 - k
+			for x1 < n && y1 < m && a[x1] == b[y1] {
+				x1++
+				y1++
+			}
+			fwd[i] = x1
+			switch {
+			case x1 > n:
+				kEnd1 += 2
+			case y1 > m:
+				kStart1 += 2
+			case front:
+				j := offset + delta - k
+				if j >= 0 && j < len(rev) && rev[j] != -1 && x1 >= n-rev[j] {
+					return a0 + x1, b0 + y1
+				}
+			}
+		}
+		for k := -step + kStart2; k <= step-kEnd2; k += 2 {
+			i := offset + k
+			var x2 int
+			if k == -step || (k != step && rev[i-1] < rev[i+1]) {
+				x2 = rev[i+1]
+			} else {
+				x2 = rev[i-1] + 1
+			}
+			y2 := x2 - k
+			for x2 < n && y2 < m && a[n-x2-1] == b[m-y2-1] {
+				x2++
+				y2++
+			}
+			rev[i] = x2
+			switch {
+			case x2 > n:
+				kEnd2 += 2
+			case y2 > m:
+				kStart2 += 2
+			case !front:
+				j := offset + delta - k
+				if j >= 0 && j < len(fwd) && fwd[j] != -1 {
+					x1 := fwd[j]
+					y1 := x1 - (j - offset)
+					if x1 >= n-x2 {
+						return a0 + x1, b0 + y1
+					}
+				}
+			}
+		}
+	}
+	// Not reached for non-empty ranges; deleting everything, then
+	// inserting, is a valid split all the same.
+	return a1, b0
+}
+
+// furthest returns the end of the forward path on diagonals -lo..hi that
+// got furthest into the inputs without reaching their end, or the split
+// that deletes everything first when there is none.
+func (d *differ) furthest(a0, b0, n, m int, fwd []int, offset, lo, hi int) (x, y int) {
+	best, bx, by := 0, n, 0
+	for k := -lo; k <= hi; k += 2 {
+		x1 := fwd[offset+k]
+		y1 := x1 - k
+		if x1 < 0 || x1 > n || y1 < 0 || y1 > m || x1 == n && y1 == m {
+			continue
+		}
+		if x1+y1 > best {
+			best, bx, by = x1+y1, x1, y1
+		}
+	}
+	return a0 + bx, b0 + by
+}
+
+// isqrt returns the integer square root of n.
+func isqrt(n int) int {
+	r := 0
+	for bit := 1 << 30; bit > 0; bit >>= 2 {
+		if r+bit <= n {
+			n -= r + bit
+			r = r>>1 + bit
+		} else {
+			r >>= 1
+		}
+	}
+	return r
+}
@@ -0,0 +1,73 @@
+package diff
+
+import "sort"
+
+// patience anchors the diff on lines that occur exactly once on each side,
+// keeping the longest run of them that appears in the same order, and
+// recurses between the anchors. Regions without unique lines fall back to
+// Myers.
+func (d *differ) patience(a0, a1, b0, b1 int) {
+	type count struct{ inA, inB, posA, posB int }
+	counts := make(map[int]*count)
+	for i := a0; i < a1; i++ {
+		c := counts[d.a[i]]
+		if c == nil {
+			c = &count{}
+			counts[d.a[i]] = c
+		}
+		c.inA++
+		c.posA = i
+	}
+	for j := b0; j < b1; j++ {
+		if c := counts[d.b[j]]; c != nil {
+			c.inB++
+			c.posB = j
+		}
+	}
+
+	var unique [][2]int
+	for i := a0; i < a1; i++ {
+		if c := counts[d.a[i]]; c.inA == 1 && c.inB == 1 {
+			unique = append(unique, [2]int{i, c.posB})
+		}
+	}
+	if len(unique) == 0 {
+		d.myers(a0, a1, b0, b1)
+		return
+	}
+
+	i, j := a0, b0
+	for _, anchor := range increasingRun(unique) {
+		d.run(i, anchor[0], j, anchor[1])
+		d.equal(anchor[0], anchor[1])
+		i, j = anchor[0]+1, anchor[1]+1
+	}
+	d.run(i, a1, j, b1)
+}
+
+// increasingRun returns the longest subsequence of pairs (already ordered by
+// their first element) whose second elements increase, using patience
+// sorting.
+func increasingRun(pairs [][2]int) [][2]int {
+	var tops []int // index into pairs of the top card of each pile
+	prev := make([]int, len(pairs))
+	for idx, p := range pairs {
+		pile := sort.Search(len(tops), func(k int) bool { return pairs[tops[k]][1] > p[1] })
+		if pile > 0 {
+			prev[idx] = tops[pile-1]
+		} else {
+			prev[idx] = -1
+		}
+		if pile == len(tops) {
+			tops = append(tops, idx)
+		} else {
+			tops[pile] = idx
+		}
+	}
+
+	run := make([][2]int, len(tops))
+	for k, idx := len(tops)-1, tops[len(tops)-1]; k >= 0; k, idx = k-1, prev[idx] {
+		run[k] = pairs[idx]
+	}
+	return run
+}
@@ -0,0 +1,125 @@
+package diff
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ansiRe matches ANSI escape sequences.
+var ansiRe = regexp.MustCompile(`[\x1b\x9b][[\]()#;?]*(?:(?:(?:[a-zA-Z\d]*(?:;[a-zA-Z\d]*)*)?\x07)|(?:(?:\d{1,4}(?:;\d{0,4})*)?[\dA-PRZcf-ntqry=><~]))`)
+
+// StripANSI removes the color codes and other escape sequences from s, as
+// printed by a diff run with colors.
+func StripANSI(s string) string {
+	if strings.IndexByte(s, '\x1b') < 0 && strings.IndexByte(s, '\x9b') < 0 {
+		return s
+	}
+	return ansiRe.ReplaceAllString(s, "")
+}
+
+// Section is the part of a multi-file diff about one file, with the facts
+// the file list shows about it.
+type Section struct {
+	Path string
+	// Text is the section as read, color codes included, ending in a
+	// newline. It is what a diff limited to Path prints.
+	Text           string
+	Added, Deleted int
+	Rename         Rename // From is empty unless renamed or copied
+	Binary, LFS    bool
+}
+
+// sectionStart reports whether a line free of color codes begins a file's
+// section: git's "diff --git", "diff --cc" and "diff --combined" headers,
+// or hg's "diff -r" one.
+func sectionStart(clean string) bool {
+	return strings.HasPrefix(clean, "diff --git ") ||
+		strings.HasPrefix(clean, "diff --cc ") ||
+		strings.HasPrefix(clean, "diff --combined ") ||
+		strings.HasPrefix(clean, "diff -r ")
+}
+
+// ReadSections reads a diff of many files from r and calls fn with each
+// file's section as soon as the next one begins, so a long stream can be
+// shown while it is still arriving. Text before the first section, such as
+// a commit message, is skipped. It stops at the first error from r or fn.
+func ReadSections(r io.Reader, fn func(Section) error) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	var raw, clean []string
+	flush := func() error {
+		if len(raw) == 0 {
+			return nil
+		}
+		s := parseSection(raw, clean)
+		raw, clean = raw[:0], clean[:0]
+		if s.Path == "" {
+			return nil
+		}
+		return fn(s)
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			line = strings.TrimSuffix(line, "\n")
+			c := StripANSI(line)
+			if sectionStart(c) {
+				if ferr := flush(); ferr != nil {
+					return ferr
+				}
+			}
+			if len(raw) > 0 || sectionStart(c) {
+				raw = append(raw, line)
+				clean = append(clean, c)
+			}
+		}
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseSection counts the changes of one section, whose header is raw[0].
+func parseSection(raw, clean []string) Section {
+	var s Section
+	if path, ok := SectionPath(clean, 0); ok {
+		s.Path = path
+	} else if parts := strings.Fields(clean[0]); strings.HasPrefix(clean[0], "diff -r ") && len(parts) >= 3 {
+		// hg format: "diff -r <rev> <file>" or "diff -r <rev1> -r <rev2> <file>"
+		// The file path is always the last whitespace-separated field.
+		s.Path = parts[len(parts)-1]
+	}
+	s.Text = strings.Join(raw, "\n") + "\n"
+
+	var similarity int
+	parents := 0 // prefix columns of the current hunk, 0 outside hunks
+	for _, line := range clean[1:] {
+		if n := Parents(line); n > 0 {
+			parents = n
+		} else if n, ok := strings.CutPrefix(line, "similarity index "); ok {
+			similarity, _ = strconv.Atoi(strings.TrimSuffix(n, "%"))
+		} else if from, ok := strings.CutPrefix(line, "rename from "); ok {
+			s.Rename = Rename{From: UnquotePath(from), Similarity: similarity}
+		} else if from, ok := strings.CutPrefix(line, "copy from "); ok {
+			s.Rename = Rename{From: UnquotePath(from), Similarity: similarity, Copy: true}
+		} else if IsBinaryDiff(line) {
+			s.Binary = true
+		} else {
+			if len(line) > 0 && strings.HasPrefix(line[1:], "version https://git-lfs") {
+				s.LFS = true
+			}
+			added, deleted := Classify(line, parents)
+			if added {
+				s.Added++
+			} else if deleted {
+				s.Deleted++
+			}
+		}
+	}
+	return s
+}
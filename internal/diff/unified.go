@@ -0,0 +1,308 @@
+package diff
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"unicode"
+)
+
+// File is one path's contents on both sides of a comparison.
+type File struct {
+	Path string
+	// OldPath is the old side's path when the file was renamed or copied.
+	OldPath string
+	Old     []byte
+	New     []byte
+	// OldMissing and NewMissing mark a side on which the file does not
+	// exist, i.e. the file was added or deleted.
+	OldMissing bool
+	NewMissing bool
+	// OldMode and NewMode are git's modes for the sides, such as "100644",
+	// "100755" or "120000", or empty when the backend does not know them.
+	OldMode string
+	NewMode string
+}
+
+// Mode returns git's mode for a file: a symlink, an executable or a
+// regular file.
+func Mode(info fs.FileInfo) string {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		return "120000"
+	case info.Mode()&0o111 != 0:
+		return "100755"
+	}
+	return "100644"
+}
+
+// Render produces a git-style diff for f so the rest of difi can treat it
+// exactly like `git diff` output.
+func Render(f File, opts Options) string {
+	var sb strings.Builder
+	oldPath := f.Path
+	if f.OldPath != "" {
+		oldPath = f.OldPath
+	}
+	fmt.Fprintf(&sb, "diff --git %s %s\n", GitName("a/", oldPath), GitName("b/", f.Path))
+	// Modes are only printed when known; a wrong one would be worse.
+	switch {
+	case f.OldMissing:
+		if f.NewMode != "" {
+			fmt.Fprintf(&sb, "new file mode %s\n", f.NewMode)
+		}
+	case f.NewMissing:
+		if f.OldMode != "" {
+			fmt.Fprintf(&sb, "deleted file mode %s\n", f.OldMode)
+		}
+	case f.OldMode != "" && f.NewMode != "" && f.OldMode != f.NewMode:
+		fmt.Fprintf(&sb, "old mode %s\nnew mode %s\n", f.OldMode, f.NewMode)
+	}
+	if oldPath != f.Path {
+		fmt.Fprintf(&sb, "similarity index %d%%\n", Similarity(f.Old, f.New))
+		fmt.Fprintf(&sb, "rename from %s\nrename to %s\n", QuotePath(oldPath), QuotePath(f.Path))
+	}
+
+	oldName, newName := GitName("a/", oldPath), GitName("b/", f.Path)
+	if f.OldMissing {
+		oldName = "/dev/null"
+	}
+	if f.NewMissing {
+		newName = "/dev/null"
+	}
+
+	if IsBinary(f.Old) || IsBinary(f.New) {
+		fmt.Fprintf(&sb, "Binary files %s and %s differ\n", oldName, newName)
+		return sb.String()
+	}
+
+	if string(f.Old) == string(f.New) {
+		// A pure rename or mode change, or an empty file added or deleted,
+		// has no hunks, and git prints no ---/+++ lines.
+		return sb.String()
+	}
+
+	a, b := Lines(string(f.Old)), Lines(string(f.New))
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	sb.WriteString(Unified(a, b, Compute(a, b, opts), opts))
+	return sb.String()
+}
+
+// Stats counts the lines Render would show as added and deleted. Binary
+// files count as zero, like numstat's "-".
+func (f File) Stats(opts Options) (added, deleted int) {
+	if IsBinary(f.Old) || IsBinary(f.New) {
+		return 0, 0
+	}
+	a, b := Lines(string(f.Old)), Lines(string(f.New))
+	edits := Compute(a, b, opts)
+	for _, h := range hunks(a, b, edits, opts) {
+		hunkAdded, hunkDeleted := Stats(edits[h.start:h.end])
+		added += hunkAdded
+		deleted += hunkDeleted
+	}
+	return added, deleted
+}
+
+// Unified renders an edit script as unified diff hunks. The "---"/"+++"
+// header is left to the caller.
+func Unified(a, b []string, edits []Edit, opts Options) string {
+	var sb strings.Builder
+	for _, h := range hunks(a, b, edits, opts) {
+		oldStart, oldLen, newStart, newLen := h.bounds(edits)
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldStart, oldLen), hunkRange(newStart, newLen))
+
+		var words map[int]string
+		if opts.WordDiff {
+			words = highlightWords(a, b, edits, h)
+		}
+		for i := h.start; i < h.end; i++ {
+			e := edits[i]
+			switch e.Op {
+			case Equal:
+				writeLine(&sb, ' ', a[e.A])
+			case Delete:
+				writeLine(&sb, '-', pick(words, i, a[e.A]))
+			case Insert:
+				writeLine(&sb, '+', pick(words, i, b[e.B]))
+			}
+		}
+	}
+	return sb.String()
+}
+
+func pick(words map[int]string, i int, line string) string {
+	if w, ok := words[i]; ok {
+		return w
+	}
+	return line
+}
+
+type hunk struct{ start, end int }
+
+// hunks groups changes with their surrounding context, merging groups whose
+// context would touch. With IgnoreBlankLines, changes that only add or
+// remove blank lines do not open a hunk of their own.
+func hunks(a, b []string, edits []Edit, opts Options) []hunk {
+	context := opts.context()
+	var out []hunk
+	for i, e := range edits {
+		switch {
+		case e.Op == Equal:
+			continue
+		case opts.IgnoreBlankLines && e.Op == Delete && isBlank(a[e.A]):
+			continue
+		case opts.IgnoreBlankLines && e.Op == Insert && isBlank(b[e.B]):
+			continue
+		}
+		start, end := i-context, i+1+context
+		if start < 0 {
+			start = 0
+		}
+		if end > len(edits) {
+			end = len(edits)
+		}
+		if len(out) > 0 && out[len(out)-1].end >= start {
+			out[len(out)-1].end = end
+		} else {
+			out = append(out, hunk{start: start, end: end})
+		}
+	}
+	return out
+}
+
+// bounds returns the 1-based start line and length of the hunk on each side.
+func (h hunk) bounds(edits []Edit) (oldStart, oldLen, newStart, newLen int) {
+	for _, e := range edits[:h.start] {
+		if e.Op != Insert {
+			oldStart++
+		}
+		if e.Op != Delete {
+			newStart++
+		}
+	}
+	for _, e := range edits[h.start:h.end] {
+		if e.Op != Insert {
+			oldLen++
+		}
+		if e.Op != Delete {
+			newLen++
+		}
+	}
+	if oldLen > 0 {
+		oldStart++
+	}
+	if newLen > 0 {
+		newStart++
+	}
+	return oldStart, oldLen, newStart, newLen
+}
+
+func hunkRange(start, length int) string {
+	if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+func writeLine(sb *strings.Builder, prefix byte, line string) {
+	sb.WriteByte(prefix)
+	sb.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// Reverse video keeps word highlights readable on top of whatever colors
+// the diff pane uses for added and deleted lines.
+const (
+	wordOn  = "\x1b[7m"
+	wordOff = "\x1b[27m"
+)
+
+// highlightWords pairs up the deleted and inserted lines of each change
+// block in h and marks the words that differ between them. The result maps
+// an edit index to the highlighted line.
+func highlightWords(a, b []string, edits []Edit, h hunk) map[int]string {
+	out := make(map[int]string)
+	for i := h.start; i < h.end; {
+		if edits[i].Op != Delete {
+			i++
+			continue
+		}
+		dels := i
+		for i < h.end && edits[i].Op == Delete {
+			i++
+		}
+		ins := i
+		for i < h.end && edits[i].Op == Insert {
+			i++
+		}
+		for k := 0; dels+k < ins && ins+k < i; k++ {
+			oldLine, newLine := WordDiff(a[edits[dels+k].A], b[edits[ins+k].B])
+			out[dels+k] = oldLine
+			out[ins+k] = newLine
+		}
+	}
+	return out
+}
+
+// WordDiff compares two versions of a line word by word and returns both
+// with the changed words highlighted.
+func WordDiff(oldLine, newLine string) (string, string) {
+	oldBody, oldEOL := splitEOL(oldLine)
+	newBody, newEOL := splitEOL(newLine)
+	a, b := tokenize(oldBody), tokenize(newBody)
+
+	var oldOut, newOut strings.Builder
+	for _, e := range Compute(a, b, Options{}) {
+		switch e.Op {
+		case Equal:
+			oldOut.WriteString(a[e.A])
+			newOut.WriteString(b[e.B])
+		case Delete:
+			oldOut.WriteString(wordOn + a[e.A] + wordOff)
+		case Insert:
+			newOut.WriteString(wordOn + b[e.B] + wordOff)
+		}
+	}
+	return oldOut.String() + oldEOL, newOut.String() + newEOL
+}
+
+func splitEOL(line string) (string, string) {
+	if strings.HasSuffix(line, "\n") {
+		return line[:len(line)-1], "\n"
+	}
+	return line, ""
+}
+
+// tokenize splits a line into words, runs of whitespace and single
+// punctuation characters.
+func tokenize(line string) []string {
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		default:
+			return 0
+		}
+	}
+
+	var tokens []string
+	start := 0
+	prev := -1
+	for i, r := range line {
+		c := class(r)
+		if i > start && (c != prev || c == 0) {
+			tokens = append(tokens, line[start:i])
+			start = i
+		}
+		prev = c
+	}
+	if start < len(line) {
+		tokens = append(tokens, line[start:])
+	}
+	return tokens
+}
@@ -0,0 +1,105 @@
+// Package diffcache keeps recently loaded per-file diffs in memory, so
+// moving back and forth through the tree does not ask the VCS again.
+package diffcache
+
+import (
+	"container/list"
+	"os"
+	"sync"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// Key identifies a diff. A file edited since its diff was cached gets a
+// new ModTime and so misses; everything else, such as a moved branch, has
+// to be invalidated with Clear.
+type Key struct {
+	Target  string
+	Path    string
+	OldPath string
+	Opts    diff.Options
+	// ModTime is the working file's modification time in nanoseconds, or
+	// zero when it does not exist.
+	ModTime int64
+}
+
+// ModTime stamps file for a Key.
+func ModTime(file string) int64 {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().UnixNano()
+}
+
+// Cache is a least-recently-used cache of diffs bounded by their total
+// size. It is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	order    *list.List // of *entry, most recently used first
+	entries  map[Key]*list.Element
+}
+
+type entry struct {
+	key  Key
+	diff string
+}
+
+// New returns a cache holding up to maxBytes of diff text.
+func New(maxBytes int) *Cache {
+	return &Cache{maxBytes: maxBytes, order: list.New(), entries: make(map[Key]*list.Element)}
+}
+
+// Get returns the diff cached under k and marks it recently used.
+func (c *Cache) Get(k Key) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[k]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*entry).diff, true
+}
+
+// Put caches d under k, evicting the least recently used diffs to make
+// room. A diff larger than the whole cache is not kept.
+func (c *Cache) Put(k Key, d string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[k]; ok {
+		c.remove(el)
+	}
+	if len(d) > c.maxBytes {
+		return
+	}
+	c.entries[k] = c.order.PushFront(&entry{key: k, diff: d})
+	c.size += len(d)
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.size -= len(e.diff)
+}
+
+// Clear drops every cached diff.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[Key]*list.Element)
+	c.size = 0
+}
+
+// Len returns the number of cached diffs.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
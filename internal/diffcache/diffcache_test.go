@@ -0,0 +1,77 @@
+package diffcache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+func TestEviction(t *testing.T) {
+	c := New(10)
+	a, b, d := Key{Path: "a"}, Key{Path: "b"}, Key{Path: "d"}
+	c.Put(a, "aaaa")
+	c.Put(b, "bbbb")
+	// Using a makes b the least recently used.
+	if got, ok := c.Get(a); !ok || got != "aaaa" {
+		t.Fatalf("Get(a) = %q, %v", got, ok)
+	}
+	c.Put(d, "dddd")
+	if _, ok := c.Get(b); ok {
+		t.Error("b survived eviction")
+	}
+	if _, ok := c.Get(a); !ok {
+		t.Error("a was evicted")
+	}
+
+	// Replacing an entry accounts for its new size.
+	c.Put(a, "a")
+	c.Put(b, "bbbb")
+	if c.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", c.Len())
+	}
+
+	c.Put(Key{Path: "big"}, strings.Repeat("x", 11))
+	if _, ok := c.Get(Key{Path: "big"}); ok || c.Len() != 3 {
+		t.Errorf("oversized diff cached, Len() = %d", c.Len())
+	}
+
+	c.Clear()
+	if _, ok := c.Get(a); ok || c.Len() != 0 {
+		t.Error("Clear() kept entries")
+	}
+}
+
+func TestKey(t *testing.T) {
+	c := New(100)
+	k := Key{Target: "HEAD", Path: "a.go"}
+	c.Put(k, "diff")
+
+	ws := k
+	ws.Opts = diff.Options{IgnoreAllSpace: true}
+	if _, ok := c.Get(ws); ok {
+		t.Error("diff found under other options")
+	}
+
+	file := filepath.Join(t.TempDir(), "a.go")
+	if ModTime(file) != 0 {
+		t.Error("ModTime(missing) != 0")
+	}
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	k.ModTime = ModTime(file)
+	c.Put(k, "diff")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	edited := k
+	edited.ModTime = ModTime(file)
+	if _, ok := c.Get(edited); ok {
+		t.Error("diff found after the file changed")
+	}
+}
@@ -0,0 +1,224 @@
+// Package diffview holds a file's diff ready to be shown. Each line is
+// classified and numbered once, when the diff arrives, so drawing the part
+// of it on screen costs the same however long the diff is.
+package diffview
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// Kind is what a line of a diff is.
+type Kind uint8
+
+const (
+	Other   Kind = iota // anything else, such as "\ No newline at end of file"
+	Header              // a file header of a later section, not shown
+	Hunk                // a hunk header, not shown
+	Context             // in both sides
+	Added               // only in the new side
+	Deleted             // only in the old side
+)
+
+// Line is the index entry of a line of a diff.
+type Line struct {
+	Kind Kind
+	// Old and New are the line's numbers in the old and new file. A line
+	// missing from a side has the number of the line before it there.
+	Old, New int
+}
+
+// Diff is a file's diff from its first hunk on, with the index of its
+// lines. The zero Diff is empty.
+type Diff struct {
+	lines []string // as printed, colors and all
+	index []Line
+
+	// Added and Deleted count the changed lines.
+	Added, Deleted int
+}
+
+// New indexes content, dropping the file headers before the first hunk.
+func New(content string) Diff {
+	var d Diff
+	old, cur, parents := 0, 0, 0
+	var prev [2]string // the two lines before, for svn and fossil headers
+	for line := range strings.SplitSeq(content, "\n") {
+		clean := strip(line)
+		if d.lines == nil && !strings.HasPrefix(clean, "@@") {
+			continue
+		}
+		l := Line{Kind: Other}
+		switch {
+		case strings.HasPrefix(clean, "@@"):
+			l.Kind = Hunk
+			if n, o, c, ok := hunkStarts(clean); ok {
+				parents, old, cur = n, o, c
+			}
+		case isHeader(clean, prev):
+			l.Kind = Header
+		default:
+			switch a, del := diff.Classify(clean, parents); {
+			case a:
+				l.Kind = Added
+				d.Added++
+			case del:
+				l.Kind = Deleted
+				d.Deleted++
+			case diff.InResult(clean, parents):
+				l.Kind = Context
+			}
+			if diff.InResult(clean, parents) {
+				cur++
+			}
+			// The first parent's column tells whether the line is in it.
+			if parents > 0 && len(clean) > 0 &&
+				(clean[0] == '-' || clean[0] == ' ' && diff.InResult(clean, parents)) {
+				old++
+			}
+		}
+		l.Old, l.New = max(old-1, 0), max(cur-1, 0)
+		d.lines = append(d.lines, line)
+		d.index = append(d.index, l)
+		prev[0], prev[1] = prev[1], clean
+	}
+	return d
+}
+
+// hunkStarts reads the number of parents and the first line numbers of the
+// first parent and of the result from a hunk header.
+func hunkStarts(header string) (parents, old, cur int, ok bool) {
+	parents = diff.Parents(header)
+	fields := strings.Fields(header)
+	if parents == 0 || len(fields) < parents+2 {
+		return 0, 0, 0, false
+	}
+	start := func(field string) int {
+		n, _, _ := strings.Cut(field[1:], ",")
+		v, _ := strconv.Atoi(n)
+		return v
+	}
+	return parents, start(fields[1]), start(fields[parents+1]), true
+}
+
+// isHeader reports whether a line after the first hunk starts, or belongs
+// to, the header of another file's section. prev holds the lines before
+// it, as an svn or fossil "---"/"+++" pair follows a row of "=" and has no
+// a/ and b/ prefixes to tell it from removed or added lines.
+func isHeader(clean string, prev [2]string) bool {
+	for _, p := range []string{
+		"diff --git", "diff --cc ", "diff --combined ", "diff -r ",
+		"index ", "new file mode", "old mode",
+		"--- a/", "--- /dev/", "+++ b/", "+++ /dev/",
+		"Index: ", "=====",
+	} {
+		if strings.HasPrefix(clean, p) {
+			return true
+		}
+	}
+	if !strings.HasPrefix(clean, "--- ") && !strings.HasPrefix(clean, "+++ ") {
+		return false
+	}
+	return strings.HasPrefix(prev[0], "=====") || strings.HasPrefix(prev[1], "=====")
+}
+
+// Len returns the number of lines.
+func (d Diff) Len() int {
+	return len(d.lines)
+}
+
+// Line returns line i as printed.
+func (d Diff) Line(i int) string {
+	return d.lines[i]
+}
+
+// Text returns line i without colors.
+func (d Diff) Text(i int) string {
+	return strip(d.lines[i])
+}
+
+// strip removes colors from line, passing over the many lines without any.
+func strip(line string) string {
+	if strings.IndexByte(line, '\x1b') < 0 && strings.IndexByte(line, '\x9b') < 0 {
+		return line
+	}
+	return ansi.Strip(line)
+}
+
+// Info returns the index entry of line i.
+func (d Diff) Info(i int) Line {
+	return d.index[i]
+}
+
+// FileLine returns the line of the new file to open an editor at for line
+// i, or 0 when there is none.
+func (d Diff) FileLine(i int) int {
+	if i < 0 || i >= len(d.index) {
+		return 0
+	}
+	return max(d.index[i].New, 1)
+}
+
+// Frame is what of a diff is on screen and how it is drawn.
+type Frame struct {
+	Offset, Height, Width int
+	Cursor                int
+	// Selected highlights the cursor's line.
+	Selected bool
+	// Numbers is how lines are numbered: "relative" to the cursor,
+	// "absolute" within the diff, "hybrid", which is relative with the
+	// file's line number at the cursor, or "hidden".
+	Numbers string
+
+	NumberStyle, SelectedStyle lipgloss.Style
+}
+
+// Render draws the lines of the frame, one per row, skipping headers. Only
+// the lines in the frame are looked at.
+func (d Diff) Render(f Frame) string {
+	end := min(f.Offset+f.Height, len(d.lines))
+	maxLineWidth := max(f.Width-7, 1)
+
+	var sb strings.Builder
+	for i := max(f.Offset, 0); i < end; i++ {
+		if k := d.index[i].Kind; k == Header || k == Hunk {
+			continue
+		}
+
+		var numStr string
+		switch {
+		case f.Numbers == "hidden":
+		case i == f.Cursor && f.Numbers == "hybrid":
+			numStr = strconv.Itoa(d.FileLine(i))
+		case i == f.Cursor && f.Numbers == "relative":
+			numStr = "0"
+		case f.Numbers == "absolute":
+			numStr = strconv.Itoa(i + 1)
+		default:
+			numStr = strconv.Itoa(abs(i - f.Cursor))
+		}
+		if numStr != "" {
+			sb.WriteString(f.NumberStyle.Render(numStr))
+		}
+
+		if f.Selected && i == f.Cursor {
+			sb.WriteString(f.SelectedStyle.Render("  " + d.Text(i)))
+		} else {
+			sb.WriteString("  " + ansi.Truncate(d.lines[i], maxLineWidth, ""))
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,194 @@
+package diffview
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	content := "diff --git a/a.go b/a.go\n" +
+		"--- a/a.go\n" +
+		"+++ b/a.go\n" +
+		"\x1b[36m@@ -10,4 +10,4 @@ func f()\x1b[m\n" +
+		" ten\n" +
+		"\x1b[31m-eleven\x1b[m\n" +
+		"\x1b[32m+ELEVEN\x1b[m\n" +
+		" twelve\n" +
+		"\\ No newline at end of file\n" +
+		"Index: b.c\n" +
+		"===================================================================\n" +
+		"--- b.c\t(revision 1)\n" +
+		"+++ b.c\t(working copy)\n" +
+		"@@ -1 +1,2 @@\n" +
+		" one\n" +
+		"+two"
+	d := New(content)
+
+	want := []Line{
+		{Hunk, 9, 9},
+		{Context, 10, 10},
+		{Deleted, 11, 10},
+		{Added, 11, 11},
+		{Context, 12, 12},
+		{Other, 12, 12},
+		{Header, 12, 12},
+		{Header, 12, 12},
+		{Header, 12, 12},
+		{Header, 12, 12},
+		{Hunk, 0, 0},
+		{Context, 1, 1},
+		{Added, 1, 2},
+	}
+	if d.Len() != len(want) {
+		t.Fatalf("Len() = %d, want %d", d.Len(), len(want))
+	}
+	for i, w := range want {
+		if got := d.Info(i); got != w {
+			t.Errorf("Info(%d) = %+v for %q, want %+v", i, got, d.Text(i), w)
+		}
+	}
+	if d.Added != 2 || d.Deleted != 1 {
+		t.Errorf("Added, Deleted = %d, %d, want 2, 1", d.Added, d.Deleted)
+	}
+	if got := d.Text(2); got != "-eleven" {
+		t.Errorf("Text(2) = %q, want %q", got, "-eleven")
+	}
+	for i, w := range map[int]int{0: 9, 2: 10, 3: 11, 10: 1, 12: 2, 99: 0} {
+		if got := d.FileLine(i); got != w {
+			t.Errorf("FileLine(%d) = %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestNewCombined(t *testing.T) {
+	d := New("@@@ -5,2 -7,2 +5,3 @@@\n  same\n- ours\n +theirs\n++both\n")
+	want := []Line{
+		{Hunk, 4, 4},
+		{Context, 5, 5},
+		{Deleted, 6, 5},
+		{Added, 7, 6},
+		{Added, 7, 7},
+		{Other, 7, 7},
+	}
+	for i, w := range want {
+		if got := d.Info(i); got != w {
+			t.Errorf("Info(%d) = %+v for %q, want %+v", i, got, d.Text(i), w)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	d := New("@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\ndiff --git a/b b/b\n@@ -1 +1 @@\n-x\n+y")
+	tests := []struct {
+		name  string
+		frame Frame
+		want  string
+	}{
+		{
+			"relative",
+			Frame{Offset: 0, Height: 4, Width: 40, Cursor: 2, Numbers: "relative"},
+			"1   one\n0  -two\n1  +TWO",
+		},
+		{
+			"hybrid",
+			Frame{Offset: 1, Height: 3, Width: 40, Cursor: 3, Numbers: "hybrid"},
+			"2   one\n1  -two\n2  +TWO",
+		},
+		{
+			"window skips headers",
+			Frame{Offset: 4, Height: 4, Width: 40, Cursor: 7, Numbers: "absolute"},
+			"5   three\n8  -x",
+		},
+		{
+			"hidden and truncated",
+			Frame{Offset: 1, Height: 1, Width: 9, Numbers: "hidden"},
+			"   o",
+		},
+	}
+	for _, tt := range tests {
+		if got := d.Render(tt.frame); got != tt.want {
+			t.Errorf("%s: Render() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := (Diff{}).Render(Frame{Height: 10, Width: 40}); got != "" {
+		t.Errorf("Render() of an empty diff = %q", got)
+	}
+}
+
+// generated returns a colored diff of about n lines in hunks of ten.
+func generated(n int) string {
+	var sb strings.Builder
+	sb.WriteString("diff --git a/gen.go b/gen.go\n--- a/gen.go\n+++ b/gen.go\n")
+	for line := 1; line <= n; line += 10 {
+		fmt.Fprintf(&sb, "\x1b[36m@@ -%d,9 +%d,9 @@\x1b[m\n", line, line)
+		for j := 0; j < 3; j++ {
+			fmt.Fprintf(&sb, " context line %08d\n", line+j)
+		}
+		fmt.Fprintf(&sb, "\x1b[31m-removed line %08d\x1b[m\n", line+3)
+		fmt.Fprintf(&sb, "\x1b[32m+added line %08d\x1b[m\n", line+3)
+		for j := 4; j < 9; j++ {
+			fmt.Fprintf(&sb, " context line %08d\n", line+j)
+		}
+	}
+	return sb.String()
+}
+
+// frame is a screenful in the middle of d with the cursor on it.
+func frame(d Diff) Frame {
+	mid := d.Len() / 2
+	return Frame{Offset: mid, Height: 50, Width: 120, Cursor: mid + 10, Selected: true, Numbers: "hybrid"}
+}
+
+// TestRenderCost checks that drawing a screenful does not depend on how
+// long the diff is.
+func TestRenderCost(t *testing.T) {
+	small, large := New(generated(1000)), New(generated(100000))
+	allocs := func(d Diff) float64 {
+		f := frame(d)
+		return testing.AllocsPerRun(20, func() { d.Render(f) })
+	}
+	if s, l := allocs(small), allocs(large); l > s {
+		t.Errorf("Render() allocates %v times on a 100k-line diff and %v on a 1k-line one", l, s)
+	}
+}
+
+func BenchmarkNew(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		content := generated(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				New(content)
+			}
+		})
+	}
+}
+
+// BenchmarkRender draws a frame of 50 lines; its cost should stay flat as
+// the diff grows.
+func BenchmarkRender(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		d := New(generated(n))
+		f := frame(d)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				d.Render(f)
+			}
+		})
+	}
+}
+
+// BenchmarkScroll moves the cursor down a screenful of a 100k-line diff,
+// drawing each step as the pane does.
+func BenchmarkScroll(b *testing.B) {
+	d := New(generated(100000))
+	f := frame(d)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Cursor = f.Offset + i%f.Height
+		d.Render(f)
+		d.FileLine(f.Cursor)
+	}
+}
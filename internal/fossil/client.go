@@ -0,0 +1,286 @@
+// Package fossil is the Fossil SCM backend. Targets are check-in names as
+// `fossil diff --from` takes them: "current" (the default, the checked-out
+// version), a hash prefix, a tag or branch name, or "A..B" to compare two
+// check-ins without the working checkout.
+package fossil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/backend"
+	"github.com/oug-t/difi/internal/diff"
+)
+
+var fossilRoot string
+
+// indexPrefix starts each file section of `fossil diff`, followed by a line
+// of "=" and the "---"/"+++" pair.
+const indexPrefix = "Index: "
+
+// changeStates are the `fossil changes` classifications listed as changed
+// files. EXTRA (unmanaged) files and MERGED_WITH lines are left out.
+var changeStates = map[string]bool{
+	"EDITED": true, "ADDED": true, "DELETED": true, "MISSING": true, "RENAMED": true,
+	"CONFLICT": true, "EXECUTABLE": true, "UNEXEC": true, "SYMLINK": true, "UNLINK": true,
+	"UPDATED_BY_MERGE": true, "ADDED_BY_MERGE": true, "DELETED_BY_MERGE": true,
+	"UPDATED_BY_INTEGRATE": true, "ADDED_BY_INTEGRATE": true, "DELETED_BY_INTEGRATE": true,
+}
+
+func getFossilRoot() string {
+	if fossilRoot != "" {
+		return fossilRoot
+	}
+	out, err := exec.Command("fossil", "info").Output()
+	if err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if root, ok := strings.CutPrefix(scanner.Text(), "local-root:"); ok {
+			fossilRoot = filepath.Clean(strings.TrimSpace(root))
+			break
+		}
+	}
+	return fossilRoot
+}
+
+func fossilCmd(args ...string) *exec.Cmd {
+	return fossilCmdContext(context.Background(), args...)
+}
+
+// fossilCmdContext is fossilCmd for operations that are cancelled with ctx: fossil is
+// killed when ctx is done.
+func fossilCmdContext(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "fossil", args...)
+	if root := getFossilRoot(); root != "" {
+		cmd.Dir = root
+	}
+	return cmd
+}
+
+func GetCurrentBranch() string {
+	out, err := fossilCmd("branch", "current").Output()
+	if err != nil {
+		return "trunk"
+	}
+	if branch := strings.TrimSpace(string(out)); branch != "" {
+		return branch
+	}
+	return "trunk"
+}
+
+func GetRepoName() string {
+	root := getFossilRoot()
+	if root == "" {
+		return "Repo"
+	}
+	return filepath.Base(root)
+}
+
+// revisions splits a target into the two check-ins it compares. An empty
+// newRev stands for the working checkout.
+func revisions(targetBranch string) (oldRev, newRev string) {
+	if targetBranch == "" {
+		return "current", ""
+	}
+	if a, b, ok := strings.Cut(targetBranch, ".."); ok {
+		return a, b
+	}
+	return targetBranch, ""
+}
+
+// diffArgs builds `fossil diff` against the target. -i keeps fossil from
+// running a configured external diff-command, and -N shows the contents of
+// added and deleted files.
+func diffArgs(targetBranch string, opts diff.Options) []string {
+	args := []string{"diff", "-i", "-N"}
+	if oldRev, newRev := revisions(targetBranch); oldRev != "current" || newRev != "" {
+		args = append(args, "--from", oldRev)
+		if newRev != "" {
+			args = append(args, "--to", newRev)
+		}
+	}
+	if opts.IgnoreAllSpace {
+		args = append(args, "-w")
+	}
+	return args
+}
+
+// ListChangedFiles returns the changed files: from `fossil changes` for the
+// working checkout, from the diff's headers for other targets.
+func ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	if oldRev, newRev := revisions(targetBranch); oldRev == "current" && newRev == "" {
+		out, err := fossilCmdContext(ctx, "changes").Output()
+		if err != nil {
+			return nil, fmt.Errorf("fossil changes error: %w", err)
+		}
+		return parseChanges(string(out)), nil
+	}
+
+	text, err := fullDiff(ctx, targetBranch, diff.Options{})
+	if err != nil {
+		return nil, err
+	}
+	files := ParseFilesFromDiff(text)
+	sort.Strings(files)
+	return files, nil
+}
+
+// parseChanges reads `fossil changes` output: a classification, spaces and
+// the path.
+func parseChanges(out string) []string {
+	files := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		state, path, ok := strings.Cut(line, " ")
+		if !ok || !changeStates[state] {
+			continue
+		}
+		files = append(files, strings.TrimSpace(path))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// RenamesByFile cannot be supported and always returns an empty map:
+// `fossil changes` names only the new path of a renamed file, and `fossil
+// diff` does not print the old one either. The diff of a renamed file
+// still compares it with its old contents, which fossil finds on its own.
+func RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	return map[string]diff.Rename{}, nil
+}
+
+// needsBuiltin reports whether opts ask for more than fossil diff offers:
+// it has no choice of algorithm and ignores whitespace only with -w.
+func needsBuiltin(opts diff.Options) bool {
+	return opts.NeedsBuiltin() || opts.Algorithm != diff.Myers ||
+		opts.IgnoreSpaceChange || opts.IgnoreBlankLines || opts.IgnoreCRAtEOL
+}
+
+func DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	return func() tea.Msg {
+		if needsBuiltin(opts) {
+			out, err := BuiltinDiff(ctx, targetBranch, path, oldPath, opts)
+			if err != nil {
+				return DiffMsg{Err: err}
+			}
+			return DiffMsg{Content: out}
+		}
+
+		out, err := fossilCmdContext(ctx, append(diffArgs(targetBranch, opts), "--", path)...).Output()
+		if err != nil {
+			return DiffMsg{Err: err}
+		}
+		return DiffMsg{Content: string(out)}
+	}
+}
+
+// BuiltinDiff reads the file at the target check-in with `fossil cat` and
+// diffs it in-process.
+func BuiltinDiff(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) (string, error) {
+	f, err := FileContents(ctx, targetBranch, path, oldPath)
+	if err != nil {
+		return "", err
+	}
+	return diff.Render(f, opts), nil
+}
+
+// FileContents loads both versions of path for the target. The new side is
+// the working checkout unless the target is a range.
+func FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	oldRev, newRev := revisions(targetBranch)
+	return backend.FileContents(ctx, Cat, getFossilRoot(), oldRev, newRev, path, oldPath)
+}
+
+// WorkingFile returns where a repository path lives in the checkout.
+func WorkingFile(path string) string {
+	return filepath.Join(getFossilRoot(), path)
+}
+
+// Cat returns the contents of path at rev, or nil when the file does not
+// exist in that check-in.
+func Cat(ctx context.Context, rev, path string) ([]byte, error) {
+	cmd := fossilCmdContext(ctx, "cat", "-r", rev, "--", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(stderr.String(), "no such file") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("fossil cat error: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if out == nil {
+		out = []byte{}
+	}
+	return out, nil
+}
+
+func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	c := backend.EditorCmd(getFossilRoot(), path, lineNumber, targetBranch, editor)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return EditorFinishedMsg{Err: err}
+	})
+}
+
+// fullDiff runs `fossil diff` over the whole checkout. fossil has no --stat
+// for diffs, so the stats are counted from it.
+func fullDiff(ctx context.Context, targetBranch string, opts diff.Options) (string, error) {
+	out, err := fossilCmdContext(ctx, diffArgs(targetBranch, opts)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("fossil diff error: %w", err)
+	}
+	return string(out), nil
+}
+
+// Stats counts the changes of one full diff. The binary files are the
+// ones fossil refuses to diff.
+func Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	text, err := fullDiff(ctx, targetBranch, opts)
+	if err != nil {
+		return diff.Summary{}, err
+	}
+	byFile := countLines(text)
+	added, deleted := backend.Totals(byFile)
+	return diff.Summary{Added: added, Deleted: deleted, ByFile: byFile, Binary: backend.BinaryFiles(text, sectionPath)}, nil
+}
+
+// countLines counts the added and deleted lines of each file in a fossil
+// diff.
+func countLines(text string) map[string][2]int {
+	return backend.CountLines(text, func(line string) (string, bool) {
+		return strings.CutPrefix(line, indexPrefix)
+	})
+}
+
+// DiffMsg carries a file's diff, or the error that kept it from loading.
+type DiffMsg struct {
+	Content string
+	Err     error
+}
+
+type EditorFinishedMsg struct{ Err error }
+
+// sectionPath returns the file the section starting at lines[i] is about:
+// an "Index:" line, or a git-style header in normalized piped diffs.
+func sectionPath(lines []string, i int) (string, bool) {
+	if path, ok := strings.CutPrefix(lines[i], indexPrefix); ok {
+		return path, true
+	}
+	return diff.SectionPath(lines, i)
+}
+
+func ParseFilesFromDiff(diffText string) []string {
+	return backend.ParseFiles(diffText, sectionPath)
+}
+
+func ExtractFileDiff(diffText, targetPath string) string {
+	return backend.ExtractFile(diffText, targetPath, sectionPath)
+}
@@ -0,0 +1,198 @@
+package fossil
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// Output of `fossil diff -i -N` with a modified, an added and a binary file.
+const fossilDiff = `Index: src/main.c
+==================================================================
+--- src/main.c
++++ src/main.c
+@@ -1,3 +1,3 @@
+ int main() {
+--- return 1;
++-- return 0;
+ }
+Index: notes.txt
+==================================================================
+--- notes.txt
++++ notes.txt
+@@ -0,0 +1,2 @@
++one
++two
+Index: logo.png
+==================================================================
+cannot compute difference between binary files
+`
+
+func TestParseFilesFromDiff(t *testing.T) {
+	got := ParseFilesFromDiff(fossilDiff)
+	want := []string{"src/main.c", "notes.txt", "logo.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFilesFromDiff() = %q, want %q", got, want)
+	}
+}
+
+func TestExtractFileDiff(t *testing.T) {
+	got := ExtractFileDiff(fossilDiff, "src/main.c")
+	if !strings.HasPrefix(got, "Index: src/main.c\n") || !strings.HasSuffix(got, "\n }") {
+		t.Errorf("ExtractFileDiff(src/main.c) =\n%s", got)
+	}
+	if !diff.IsBinaryDiff(ExtractFileDiff(fossilDiff, "logo.png")) {
+		t.Error("logo.png not detected as binary")
+	}
+	if diff.IsBinaryDiff(got) {
+		t.Error("src/main.c detected as binary")
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	got := countLines(fossilDiff)
+	want := map[string][2]int{"src/main.c": {1, 1}, "notes.txt": {2, 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("countLines() = %v, want %v", got, want)
+	}
+}
+
+func TestParseChanges(t *testing.T) {
+	out := `EDITED     src/main.c
+ADDED      docs/new file.md
+DELETED    old.c
+MERGED_WITH 1234567890abcdef
+EXTRA      scratch.txt
+RENAMED    renamed.c
+`
+	got := parseChanges(out)
+	want := []string{"docs/new file.md", "old.c", "renamed.c", "src/main.c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseChanges() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffArgs(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"current", "diff -i -N"},
+		{"trunk", "diff -i -N --from trunk"},
+		{"release..trunk", "diff -i -N --from release --to trunk"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(diffArgs(tt.target, diff.Options{}), " "); got != tt.want {
+			t.Errorf("diffArgs(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+// checkout creates a throwaway repository, commits files to it and opens
+// it in a checkout, which becomes the current directory.
+func checkout(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("fossil"); err != nil {
+		t.Skip("fossil not installed")
+	}
+	base := t.TempDir()
+	t.Setenv("HOME", base)
+	t.Setenv("FOSSIL_USER", "test")
+	repo := filepath.Join(base, "repo.fossil")
+	wc := filepath.Join(base, "wc")
+	if err := os.Mkdir(wc, 0755); err != nil {
+		t.Fatal(err)
+	}
+	run(t, base, "init", repo)
+	run(t, wc, "open", repo)
+
+	for name, content := range files {
+		writeFile(t, wc, name, content)
+		run(t, wc, "add", name)
+	}
+	run(t, wc, "commit", "-m", "initial", "--no-warnings")
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(wc); err != nil {
+		t.Fatal(err)
+	}
+	fossilRoot = ""
+	t.Cleanup(func() {
+		fossilRoot = ""
+		_ = os.Chdir(origDir)
+	})
+	return wc
+}
+
+func run(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("fossil", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("fossil %v: %v\n%s", args, err, out)
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	wc := checkout(t, map[string]string{
+		"main.c":     "int main() {\n\treturn 1;\n}\n",
+		"lib/util.c": "void util() {}\n",
+	})
+	writeFile(t, wc, "main.c", "int main() {\n\treturn 0;\n}\n")
+	writeFile(t, wc, "added.txt", "new\n")
+	run(t, wc, "add", "added.txt")
+	run(t, wc, "rm", "lib/util.c")
+
+	files, err := ListChangedFiles(context.Background(), "current", diff.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"added.txt", "lib/util.c", "main.c"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("ListChangedFiles() = %q, want %q", files, want)
+	}
+
+	msg := DiffCmd(context.Background(), "current", "main.c", "", diff.Options{})().(DiffMsg)
+	if !strings.Contains(msg.Content, "Index: main.c") || !strings.Contains(msg.Content, "+\treturn 0;") {
+		t.Errorf("DiffCmd() =\n%s", msg.Content)
+	}
+
+	s, err := Stats(context.Background(), "current", diff.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ByFile["main.c"] != [2]int{1, 1} || s.ByFile["added.txt"] != [2]int{1, 0} || s.Added != 2 || s.Deleted != 1 {
+		t.Errorf("Stats() = %+v", s)
+	}
+
+	out, err := BuiltinDiff(context.Background(), "current", "main.c", "", diff.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "-\treturn 1;") {
+		t.Errorf("BuiltinDiff() =\n%s", out)
+	}
+
+	if got := GetCurrentBranch(); got != "trunk" {
+		t.Errorf("GetCurrentBranch() = %q, want trunk", got)
+	}
+}
@@ -1,22 +1,31 @@
 package git
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/backend"
+	"github.com/oug-t/difi/internal/diff"
 )
 
-var ansiRe = regexp.MustCompile(`[\x1b\x9b][[\\]()#;?]*(?:(?:(?:[a-zA-Z\d]*(?:;[a-zA-Z\d]*)*)?\x07)|(?:(?:\d{1,4}(?:;\d{0,4})*)?[\dA-PRZcf-ntqry=><~]))`)
-var hunkHeaderRe = regexp.MustCompile(`^.*?@@ \-\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
-
 func gitCmd(args ...string) *exec.Cmd {
+	return gitCmdContext(context.Background(), args...)
+}
+
+// gitCmdContext is gitCmd for operations that are cancelled with ctx: git
+// is killed when ctx is done.
+func gitCmdContext(ctx context.Context, args ...string) *exec.Cmd {
 	fullArgs := append([]string{"--no-pager"}, args...)
-	cmd := exec.Command("git", fullArgs...)
+	cmd := exec.CommandContext(ctx, "git", fullArgs...)
 	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
 	return cmd
 }
@@ -42,191 +51,325 @@ func GetRepoName() string {
 	return "Repo"
 }
 
-func ListChangedFiles(targetBranch string) ([]string, error) {
-	cmd := gitCmd("diff", "--name-only", targetBranch)
-	out, err := cmd.Output()
+// ListChangedFiles returns the changed paths. A renamed or copied file is
+// listed once, under its new name.
+func ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	files, _, err := nameStatus(ctx, targetBranch, opts)
+	return files, err
+}
+
+// RenamesByFile maps the new path of each renamed or copied file to where
+// it came from.
+func RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	_, renames, err := nameStatus(ctx, targetBranch, opts)
+	return renames, err
+}
+
+// nameStatus runs `git diff --name-status -z` with rename detection. With
+// -z, paths are never quoted and each field is NUL-terminated: "M\0path\0"
+// or "R087\0old\0new\0".
+func nameStatus(ctx context.Context, targetBranch string, opts diff.Options) ([]string, map[string]diff.Rename, error) {
+	args := append([]string{"diff", "--name-status", "-z"}, renameArgs(opts)...)
+	out, err := gitCmdContext(ctx, append(args, targetBranch)...).Output()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	files := []string{}
+	renames := make(map[string]diff.Rename)
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" || i+1 >= len(fields) {
+			continue
+		}
+		if (status[0] == 'R' || status[0] == 'C') && i+2 < len(fields) {
+			from, to := fields[i+1], fields[i+2]
+			similarity, _ := strconv.Atoi(status[1:])
+			renames[to] = diff.Rename{From: from, Similarity: similarity, Copy: status[0] == 'C'}
+			files = append(files, to)
+			i += 2
+			continue
+		}
+		files = append(files, fields[i+1])
+		i++
 	}
-	files := strings.Split(strings.TrimSpace(string(out)), "\n")
-	if len(files) == 1 && files[0] == "" {
-		return []string{}, nil
+	return files, renames, nil
+}
+
+// renameArgs maps the rename options onto git's -M/-C flags.
+func renameArgs(opts diff.Options) []string {
+	args := []string{fmt.Sprintf("--find-renames=%d%%", opts.Threshold())}
+	if opts.FindCopies {
+		args = append(args, fmt.Sprintf("--find-copies=%d%%", opts.Threshold()))
 	}
-	return files, nil
+	return args
 }
 
-func DiffCmd(targetBranch, path string) tea.Cmd {
+// DiffCmd loads the diff of path. For a renamed or copied file, oldPath
+// names the source so git can pair the two sides; otherwise it is empty.
+func DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
 	return func() tea.Msg {
-		out, err := gitCmd("diff", "--color=always", targetBranch, "--", path).Output()
+		if opts.NeedsBuiltin() {
+			out, err := BuiltinDiff(ctx, targetBranch, path, oldPath, opts)
+			if err != nil {
+				return DiffMsg{Err: err}
+			}
+			return DiffMsg{Content: out}
+		}
+
+		args := append(diffArgs(opts), targetBranch, "--", path)
+		if oldPath != "" {
+			args = append(args, oldPath)
+		}
+		out, err := gitCmdContext(ctx, args...).Output()
 		if err != nil {
-			return DiffMsg{Content: "Error fetching diff: " + err.Error()}
+			return DiffMsg{Err: err}
 		}
 		return DiffMsg{Content: string(out)}
 	}
 }
 
-func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
-	var args []string
-	if lineNumber > 0 {
-		args = append(args, fmt.Sprintf("+%d", lineNumber))
+// diffArgs starts the git diff command line that shows changes under opts.
+func diffArgs(opts diff.Options) []string {
+	// --submodule=short keeps the "Subproject commit" form difi parses,
+	// whatever diff.submodule is configured to.
+	args := []string{"diff", "--color=always", "--submodule=short"}
+	if opts.Algorithm != diff.Myers {
+		args = append(args, "--diff-algorithm="+opts.Algorithm.String())
 	}
-	args = append(args, path)
+	args = append(args, whitespaceArgs(opts)...)
+	return append(args, renameArgs(opts)...)
+}
 
-	c := exec.Command(editor, args...)
-	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
-	c.Env = append(os.Environ(), fmt.Sprintf("DIFI_TARGET=%s", targetBranch))
+// StreamDiff starts a single diff of every changed file and returns its
+// output as git writes it. Closing the reader waits for git and returns
+// its error, so it must be closed even after reading to the end.
+func StreamDiff(ctx context.Context, targetBranch string, opts diff.Options) (io.ReadCloser, error) {
+	return backend.Stream(gitCmdContext(ctx, append(diffArgs(opts), targetBranch)...))
+}
 
-	return tea.ExecProcess(c, func(err error) tea.Msg {
-		return EditorFinishedMsg{Err: err}
-	})
+// whitespaceArgs maps the whitespace options onto git diff flags.
+func whitespaceArgs(opts diff.Options) []string {
+	var args []string
+	if opts.IgnoreAllSpace {
+		args = append(args, "--ignore-all-space")
+	}
+	if opts.IgnoreSpaceChange {
+		args = append(args, "--ignore-space-change")
+	}
+	if opts.IgnoreBlankLines {
+		args = append(args, "--ignore-blank-lines")
+	}
+	if opts.IgnoreCRAtEOL {
+		args = append(args, "--ignore-cr-at-eol")
+	}
+	return args
 }
 
-func DiffStats(targetBranch string) (added int, deleted int, err error) {
-	cmd := gitCmd("diff", "--numstat", targetBranch)
-	out, err := cmd.Output()
+// BuiltinDiff fetches both versions of path with a single cat-file call and
+// diffs them in-process. oldPath is the rename source, if any.
+func BuiltinDiff(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) (string, error) {
+	f, err := FileContents(ctx, targetBranch, path, oldPath)
 	if err != nil {
-		return 0, 0, fmt.Errorf("git diff stats error: %w", err)
+		return "", err
 	}
+	return diff.Render(f, opts), nil
+}
 
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
+// FileContents loads both versions of path for the target. The new side is
+// the working tree unless the target names two revisions.
+func FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	oldRev, newRev, err := diffSides(ctx, targetBranch)
+	if err != nil {
+		return diff.File{}, err
+	}
+
+	if oldPath == "" {
+		oldPath = path
+	}
+	specs := []string{oldRev + ":" + oldPath}
+	if newRev != "" {
+		specs = append(specs, newRev+":"+path)
+	}
+	blobs, err := CatFile(ctx, specs)
+	if err != nil {
+		return diff.File{}, err
+	}
+
+	f := diff.File{Path: path, OldPath: oldPath, Old: blobs[0], OldMissing: blobs[0] == nil}
+	if newRev != "" {
+		f.New, f.NewMissing = blobs[1], blobs[1] == nil
+	} else {
+		file := filepath.Join(repoRoot(), path)
+		data, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return diff.File{}, err
 		}
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
+		f.New, f.NewMissing = data, os.IsNotExist(err)
+		// Only the working tree's mode is known without asking git.
+		if info, err := os.Lstat(file); err == nil {
+			f.NewMode = diff.Mode(info)
 		}
+	}
+	return f, nil
+}
 
-		if parts[0] != "-" {
-			if n, err := strconv.Atoi(parts[0]); err == nil {
-				added += n
-			}
+// diffSides works out what `git diff <target>` compares: a revision against
+// the working tree, or both ends of an "A..B" or "A...B" range. An empty
+// newRev stands for the working tree.
+func diffSides(ctx context.Context, target string) (oldRev, newRev string, err error) {
+	orHead := func(rev string) string {
+		if rev == "" {
+			return "HEAD"
 		}
-		if parts[1] != "-" {
-			if n, err := strconv.Atoi(parts[1]); err == nil {
-				deleted += n
-			}
+		return rev
+	}
+	if a, b, ok := strings.Cut(target, "..."); ok {
+		out, err := gitCmdContext(ctx, "merge-base", orHead(a), orHead(b)).Output()
+		if err != nil {
+			return "", "", fmt.Errorf("git merge-base error: %w", err)
 		}
+		return strings.TrimSpace(string(out)), orHead(b), nil
 	}
-	return added, deleted, nil
+	if a, b, ok := strings.Cut(target, ".."); ok {
+		return orHead(a), orHead(b), nil
+	}
+	return orHead(target), "", nil
+}
+
+func repoRoot() string {
+	out, err := gitCmd("rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "."
+	}
+	return strings.TrimSpace(string(out))
 }
 
-func DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
-	cmd := gitCmd("diff", "--numstat", targetBranch)
+// CatFile reads several "<rev>:<path>" objects through one
+// `git cat-file --batch` process. Objects that do not exist come back as
+// nil, so callers can tell a missing file from an empty one.
+func CatFile(ctx context.Context, specs []string) ([][]byte, error) {
+	cmd := gitCmdContext(ctx, "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(strings.Join(specs, "\n") + "\n")
 	out, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("git diff numstat error: %w", err)
+		return nil, fmt.Errorf("git cat-file error: %w", err)
 	}
 
-	result := make(map[string][2]int)
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
+	r := bufio.NewReader(bytes.NewReader(out))
+	blobs := make([][]byte, len(specs))
+	for i := range specs {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: truncated output: %w", err)
 		}
-		parts := strings.Fields(line)
-		if len(parts) < 3 {
+		header = strings.TrimSuffix(header, "\n")
+		if strings.HasSuffix(header, " missing") || strings.HasSuffix(header, " ambiguous") {
+			// "<spec> missing", where the spec's path may hold spaces
 			continue
 		}
-		var a, d int
-		if parts[0] != "-" {
-			a, _ = strconv.Atoi(parts[0])
+		// "<object> <type> <size>"
+		fields := strings.Fields(header)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("git cat-file: bad header %q", header)
 		}
-		if parts[1] != "-" {
-			d, _ = strconv.Atoi(parts[1])
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: bad header %q", header)
 		}
-		filePath := strings.Join(parts[2:], " ")
-		if idx := strings.LastIndex(filePath, " => "); idx != -1 {
-			filePath = filePath[idx+4:]
+		blob := make([]byte, size)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return nil, fmt.Errorf("git cat-file: truncated object: %w", err)
 		}
-		result[filePath] = [2]int{a, d}
+		if _, err := r.Discard(1); err != nil {
+			return nil, fmt.Errorf("git cat-file: truncated object: %w", err)
+		}
+		blobs[i] = blob
 	}
-	return result, nil
+	return blobs, nil
 }
 
-func CalculateFileLine(diffContent string, visualLineIndex int) int {
-	lines := strings.Split(diffContent, "\n")
-	if visualLineIndex >= len(lines) {
-		return 0
+func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	c := backend.EditorCmd("", path, lineNumber, targetBranch, editor)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return EditorFinishedMsg{Err: err}
+	})
+}
+
+// Stats counts the changes from one `git diff --numstat`. With whitespace
+// options set, files whose changes are all whitespace are left out of
+// ByFile. The binary files are the ones numstat counts as "-".
+func Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	byFile, binary, err := numstat(ctx, targetBranch, opts)
+	if err != nil {
+		return diff.Summary{}, fmt.Errorf("git diff numstat error: %w", err)
 	}
+	added, deleted := backend.Totals(byFile)
+	return diff.Summary{Added: added, Deleted: deleted, ByFile: byFile, Binary: binary}, nil
+}
 
-	currentLineNo := 0
-	lastWasHunk := false
-	inHeader := true
+// numstat runs `git diff --numstat -z`. Each entry is "added\tdeleted\tpath\0",
+// or "added\tdeleted\t\0old\0new\0" for renames; binary files count "-".
+func numstat(ctx context.Context, targetBranch string, opts diff.Options) (map[string][2]int, map[string]bool, error) {
+	args := append([]string{"diff", "--numstat", "-z"}, whitespaceArgs(opts)...)
+	args = append(args, renameArgs(opts)...)
+	out, err := gitCmdContext(ctx, append(args, targetBranch)...).Output()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for i := 0; i <= visualLineIndex; i++ {
-		line := lines[i]
-		matches := hunkHeaderRe.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			startLine, _ := strconv.Atoi(matches[1])
-			currentLineNo = startLine
-			lastWasHunk = true
-			inHeader = false
+	result := make(map[string][2]int)
+	binary := make(map[string]bool)
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) < 3 {
 			continue
 		}
-
-		lastWasHunk = false
-		cleanLine := stripAnsi(line)
-
-		if inHeader {
-			continue
+		var a, d int
+		if parts[0] != "-" {
+			a, _ = strconv.Atoi(parts[0])
 		}
-
-		if strings.HasPrefix(cleanLine, " ") || strings.HasPrefix(cleanLine, "+") {
-			currentLineNo++
+		if parts[1] != "-" {
+			d, _ = strconv.Atoi(parts[1])
+		}
+		filePath := parts[2]
+		if filePath == "" && i+2 < len(fields) {
+			filePath = fields[i+2]
+			i += 2
+		}
+		result[filePath] = [2]int{a, d}
+		if parts[0] == "-" && parts[1] == "-" {
+			binary[filePath] = true
 		}
 	}
-
-	if currentLineNo == 0 {
-		return 1
-	}
-	if lastWasHunk {
-		return currentLineNo - 1
-	}
-	return currentLineNo - 1
+	return result, binary, nil
 }
 
-func stripAnsi(str string) string {
-	return ansiRe.ReplaceAllString(str, "")
+// DiffMsg carries a file's diff, or the error that kept it from loading.
+type DiffMsg struct {
+	Content string
+	Err     error
 }
 
-type DiffMsg struct{ Content string }
 type EditorFinishedMsg struct{ Err error }
 
 func ParseFilesFromDiff(diffText string) []string {
-	var files []string
-	seen := make(map[string]bool)
-	lines := strings.Split(diffText, "\n")
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff --git a/") {
-			parts := strings.SplitN(line, " b/", 2)
-			if len(parts) == 2 {
-				file := strings.TrimPrefix(parts[0], "diff --git a/")
-				if !seen[file] {
-					seen[file] = true
-					files = append(files, file)
-				}
-			}
-		}
-	}
-	return files
+	return backend.ParseFiles(diffText, sectionPath)
 }
 
 func ExtractFileDiff(diffText, targetPath string) string {
-	lines := strings.Split(diffText, "\n")
-	var out []string
-	inTarget := false
-	targetHeader := fmt.Sprintf("diff --git a/%s b/%s", targetPath, targetPath)
+	return backend.ExtractFile(diffText, targetPath, sectionPath)
+}
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff --git ") {
-			inTarget = strings.HasPrefix(line, targetHeader)
-		}
-		if inTarget {
-			out = append(out, line)
-		}
+// sectionPath returns the file of the section a "diff" header starts,
+// listing renamed files under their new name. A header whose paths cannot
+// be read still ends the section before it.
+func sectionPath(lines []string, i int) (string, bool) {
+	if !strings.HasPrefix(lines[i], "diff ") {
+		return "", false
 	}
-	return strings.Join(out, "\n")
+	path, _ := diff.SectionPath(lines, i)
+	return path, true
 }
@@ -0,0 +1,547 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/submodule"
+)
+
+// initRepo creates a throwaway repository with one commit and changes into
+// it for the duration of the test.
+func initRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		runGit(t, dir, args...)
+	}
+
+	run("init", "-q")
+	for name, content := range files {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+	run("add", "-A")
+	run("commit", "-q", "-m", "initial")
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change to repo: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(originalDir); err != nil {
+			t.Errorf("Failed to restore directory: %v", err)
+		}
+	})
+	return dir
+}
+
+// runGit runs git in dir with a fixed identity and no user configuration.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=difi", "GIT_AUTHOR_EMAIL=difi@example.com",
+		"GIT_COMMITTER_NAME=difi", "GIT_COMMITTER_EMAIL=difi@example.com",
+		"GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestCatFile(t *testing.T) {
+	initRepo(t, map[string]string{"a.txt": "hello\n", "empty.txt": "", "with space.txt": "spaced\n"})
+
+	blobs, err := CatFile(context.Background(), []string{"HEAD:a.txt", "HEAD:empty.txt", "HEAD:missing.txt", "HEAD:with space.txt", "HEAD:gone file.txt"})
+	if err != nil {
+		t.Fatalf("CatFile() error: %v", err)
+	}
+	if string(blobs[0]) != "hello\n" {
+		t.Errorf("CatFile() a.txt = %q, want %q", blobs[0], "hello\n")
+	}
+	if blobs[1] == nil || len(blobs[1]) != 0 {
+		t.Errorf("CatFile() empty.txt = %#v, want empty non-nil blob", blobs[1])
+	}
+	if blobs[2] != nil {
+		t.Errorf("CatFile() missing.txt = %q, want nil", blobs[2])
+	}
+	if string(blobs[3]) != "spaced\n" {
+		t.Errorf("CatFile() with space.txt = %q, want %q", blobs[3], "spaced\n")
+	}
+	if blobs[4] != nil {
+		t.Errorf("CatFile() gone file.txt = %q, want nil", blobs[4])
+	}
+}
+
+func TestBuiltinDiffWorkingTree(t *testing.T) {
+	dir := initRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc main() { run() }\n")
+
+	out, err := BuiltinDiff(context.Background(), "HEAD", "main.go", "", diff.Options{})
+	if err != nil {
+		t.Fatalf("BuiltinDiff() error: %v", err)
+	}
+	if !strings.Contains(out, "-func main() {}\n+func main() { run() }\n") {
+		t.Errorf("BuiltinDiff() = %q, want the changed line", out)
+	}
+
+	// Must agree with git on the line numbers the cursor maps to.
+	gitOut, err := gitCmd("diff", "HEAD", "--", "main.go").Output()
+	if err != nil {
+		t.Fatalf("git diff failed: %v", err)
+	}
+	builtinHunk := out[strings.Index(out, "@@"):]
+	gitHunk := string(gitOut[strings.Index(string(gitOut), "@@"):])
+	if builtinHunk != gitHunk {
+		t.Errorf("BuiltinDiff() hunk differs from git:\nGot:\n%s\nWant:\n%s", builtinHunk, gitHunk)
+	}
+}
+
+func TestCancelled(t *testing.T) {
+	dir := initRepo(t, map[string]string{"main.go": "package main\n"})
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc main() {}\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if msg := DiffCmd(ctx, "HEAD", "main.go", "", diff.Options{})().(DiffMsg); msg.Err == nil {
+		t.Errorf("DiffCmd(cancelled) = %q, want an error", msg.Content)
+	}
+	if _, err := BuiltinDiff(ctx, "HEAD", "main.go", "", diff.Options{}); err == nil {
+		t.Error("BuiltinDiff(cancelled) succeeded")
+	}
+	if _, err := Stats(ctx, "HEAD", diff.Options{}); err == nil {
+		t.Error("Stats(cancelled) succeeded")
+	}
+}
+
+func TestDiffSides(t *testing.T) {
+	tests := []struct {
+		target   string
+		old, new string
+	}{
+		{"HEAD", "HEAD", ""},
+		{"main", "main", ""},
+		{"main..topic", "main", "topic"},
+		{"..topic", "HEAD", "topic"},
+	}
+
+	for _, tt := range tests {
+		old, cur, err := diffSides(context.Background(), tt.target)
+		if err != nil {
+			t.Fatalf("diffSides(%q) error: %v", tt.target, err)
+		}
+		if old != tt.old || cur != tt.new {
+			t.Errorf("diffSides(%q) = %q, %q, want %q, %q", tt.target, old, cur, tt.old, tt.new)
+		}
+	}
+}
+
+func TestStatsIgnoresWhitespaceOnlyFiles(t *testing.T) {
+	dir := initRepo(t, map[string]string{"ws.go": "a\nb\n", "real.go": "x\n"})
+	writeFile(t, filepath.Join(dir, "ws.go"), "a  \nb\n")
+	writeFile(t, filepath.Join(dir, "real.go"), "y\n")
+
+	all, err := Stats(context.Background(), "HEAD", diff.Options{})
+	if err != nil {
+		t.Fatalf("Stats() error: %v", err)
+	}
+	if len(all.ByFile) != 2 || all.Added != 2 || all.Deleted != 2 {
+		t.Errorf("Stats() = %+v, want both files", all)
+	}
+
+	ignoring, err := Stats(context.Background(), "HEAD", diff.Options{IgnoreAllSpace: true})
+	if err != nil {
+		t.Fatalf("Stats(-w) error: %v", err)
+	}
+	if _, ok := ignoring.ByFile["ws.go"]; ok {
+		t.Errorf("Stats(-w) = %+v, want ws.go left out", ignoring)
+	}
+	if ignoring.ByFile["real.go"] != [2]int{1, 1} {
+		t.Errorf("Stats(-w).ByFile[real.go] = %v, want [1 1]", ignoring.ByFile["real.go"])
+	}
+}
+
+func TestRenamesByFile(t *testing.T) {
+	body := "one\ntwo\nthree\nfour\nfive\n"
+	dir := initRepo(t, map[string]string{"src/a/x.go": body, "keep.go": "k\n"})
+	if err := os.Remove(filepath.Join(dir, "src/a/x.go")); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "src/b/x.go"), body+"six\n")
+	// Renames are only detected between tracked paths.
+	if out, err := gitCmd("add", "-A").CombinedOutput(); err != nil {
+		t.Fatalf("git add failed: %v\n%s", err, out)
+	}
+
+	files, err := ListChangedFiles(context.Background(), "HEAD", diff.Options{})
+	if err != nil {
+		t.Fatalf("ListChangedFiles() error: %v", err)
+	}
+	if len(files) != 1 || files[0] != "src/b/x.go" {
+		t.Errorf("ListChangedFiles() = %v, want [src/b/x.go]", files)
+	}
+
+	renames, err := RenamesByFile(context.Background(), "HEAD", diff.Options{})
+	if err != nil {
+		t.Fatalf("RenamesByFile() error: %v", err)
+	}
+	r, ok := renames["src/b/x.go"]
+	if !ok || r.From != "src/a/x.go" || r.Copy || r.Similarity < 50 {
+		t.Errorf("RenamesByFile() = %v, want src/a/x.go renamed to src/b/x.go", renames)
+	}
+
+	// numstat prints this as "src/{a => b}/x.go" without -z.
+	stats, err := Stats(context.Background(), "HEAD", diff.Options{})
+	if err != nil {
+		t.Fatalf("Stats() error: %v", err)
+	}
+	if stats.ByFile["src/b/x.go"] != [2]int{1, 0} {
+		t.Errorf("Stats().ByFile = %v, want src/b/x.go: [1 0]", stats.ByFile)
+	}
+
+	out, err := BuiltinDiff(context.Background(), "HEAD", "src/b/x.go", "src/a/x.go", diff.Options{})
+	if err != nil {
+		t.Fatalf("BuiltinDiff() error: %v", err)
+	}
+	if !strings.Contains(out, "rename from src/a/x.go\nrename to src/b/x.go\n") || !strings.Contains(out, "+six\n") {
+		t.Errorf("BuiltinDiff() = %q, want a rename with the added line", out)
+	}
+
+	strict, err := RenamesByFile(context.Background(), "HEAD", diff.Options{RenameThreshold: 100})
+	if err != nil {
+		t.Fatalf("RenamesByFile(100%%) error: %v", err)
+	}
+	if len(strict) != 0 {
+		t.Errorf("RenamesByFile(100%%) = %v, want no renames", strict)
+	}
+}
+
+func TestExtractFileDiffRenamed(t *testing.T) {
+	input := `diff --git a/old.go b/new.go
+similarity index 90%
+rename from old.go
+rename to new.go
+--- a/old.go
++++ b/new.go
+@@ -1 +1 @@
+-a
++b
+diff --git a/other.go b/other.go
+--- a/other.go
++++ b/other.go
+@@ -1 +1 @@
+-c
++d`
+
+	files := ParseFilesFromDiff(input)
+	if strings.Join(files, ",") != "new.go,other.go" {
+		t.Errorf("ParseFilesFromDiff() = %v, want [new.go other.go]", files)
+	}
+	out := ExtractFileDiff(input, "new.go")
+	if !strings.Contains(out, "rename from old.go") || strings.Contains(out, "other.go") {
+		t.Errorf("ExtractFileDiff(new.go) = %q", out)
+	}
+}
+
+func TestColoredDiff(t *testing.T) {
+	dir := initRepo(t, map[string]string{"a.go": "a\n", "b.go": "b\n"})
+	writeFile(t, filepath.Join(dir, "a.go"), "A\n")
+	writeFile(t, filepath.Join(dir, "b.go"), "B\n")
+
+	colored := runGit(t, dir, "-c", "color.diff=always", "diff")
+	if !strings.Contains(colored, "\x1b[") {
+		t.Fatalf("git diff printed no colors:\n%s", colored)
+	}
+	if files := ParseFilesFromDiff(colored); !slices.Equal(files, []string{"a.go", "b.go"}) {
+		t.Errorf("ParseFilesFromDiff() = %v, want [a.go b.go]", files)
+	}
+	if out := ExtractFileDiff(colored, "b.go"); !strings.Contains(out, "B") || strings.Contains(out, "a.go") {
+		t.Errorf("ExtractFileDiff(b.go) = %q", out)
+	}
+}
+
+func TestCombinedDiff(t *testing.T) {
+	dir := initRepo(t, map[string]string{"a.txt": "one\ntwo\nthree\n", "b.txt": "b\n"})
+	runGit(t, dir, "checkout", "-q", "-b", "side")
+	writeFile(t, filepath.Join(dir, "a.txt"), "one\ntwo\nthree side\n")
+	runGit(t, dir, "commit", "-qam", "side")
+	runGit(t, dir, "checkout", "-q", "-")
+	writeFile(t, filepath.Join(dir, "a.txt"), "one main\ntwo\nthree\n")
+	runGit(t, dir, "commit", "-qam", "main")
+	runGit(t, dir, "merge", "-q", "side")
+	// An evil merge: a line neither parent has.
+	writeFile(t, filepath.Join(dir, "a.txt"), "one main\ntwo\nthree side\nfour\n")
+	runGit(t, dir, "commit", "-q", "--amend", "-am", "merge")
+
+	show := runGit(t, dir, "show", "--cc", "--format=", "HEAD")
+	if !strings.Contains(show, "diff --cc a.txt") {
+		t.Fatalf("git show --cc printed no combined diff:\n%s", show)
+	}
+
+	files := ParseFilesFromDiff(show)
+	if strings.Join(files, ",") != "a.txt" {
+		t.Errorf("ParseFilesFromDiff() = %v, want [a.txt]", files)
+	}
+	out := ExtractFileDiff(show, "a.txt")
+	if !strings.HasPrefix(out, "diff --cc a.txt") || !strings.Contains(out, "@@@") {
+		t.Errorf("ExtractFileDiff(a.txt) = %q", out)
+	}
+}
+
+func TestUnusualPaths(t *testing.T) {
+	names := []string{"café.go", "with space.go", "a b/c.go", "tab\there.go", `quote"d.go`}
+	files := make(map[string]string)
+	for _, name := range names {
+		files[name] = "1\n2\n3\n4\nold\n"
+	}
+	dir := initRepo(t, files)
+	for _, name := range names {
+		writeFile(t, filepath.Join(dir, name), "1\n2\n3\n4\nnew\n")
+	}
+	runGit(t, dir, "mv", "with space.go", "a b/space.go")
+
+	for _, quotePath := range []string{"true", "false"} {
+		out := runGit(t, dir, "-c", "core.quotePath="+quotePath, "diff", "--find-renames", "HEAD")
+		got := ParseFilesFromDiff(out)
+		want := []string{"a b/c.go", "a b/space.go", "café.go", `quote"d.go`, "tab\there.go"}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("quotePath=%s: ParseFilesFromDiff() = %q, want %q", quotePath, got, want)
+		}
+		for _, name := range want {
+			section := ExtractFileDiff(out, name)
+			if strings.Count(section, "diff --git") != 1 || !strings.Contains(section, "+new") {
+				t.Errorf("quotePath=%s: ExtractFileDiff(%q) = %q", quotePath, name, section)
+			}
+		}
+	}
+}
+
+func TestStatsBinary(t *testing.T) {
+	dir := initRepo(t, map[string]string{"logo.bin": "\x00\x01", "main.go": "a\n"})
+	writeFile(t, filepath.Join(dir, "logo.bin"), "\x00\x02\x03")
+	writeFile(t, filepath.Join(dir, "main.go"), "b\n")
+
+	s, err := Stats(context.Background(), "HEAD", diff.Options{})
+	if err != nil {
+		t.Fatalf("Stats() error: %v", err)
+	}
+	if !s.Binary["logo.bin"] || s.Binary["main.go"] {
+		t.Errorf("Stats().Binary = %v, want only logo.bin", s.Binary)
+	}
+
+	f, err := FileContents(context.Background(), "HEAD", "logo.bin", "")
+	if err != nil {
+		t.Fatalf("FileContents() error: %v", err)
+	}
+	if string(f.Old) != "\x00\x01" || string(f.New) != "\x00\x02\x03" {
+		t.Errorf("FileContents() = %q, %q", f.Old, f.New)
+	}
+}
+
+func TestLFS(t *testing.T) {
+	dir := initRepo(t, map[string]string{
+		".gitattributes": "*.png filter=lfs diff=lfs merge=lfs -text\n",
+		"logo.png":       "pointer\n",
+		"main.go":        "a\n",
+	})
+
+	tracked, err := LFSFiles([]string{"logo.png", "main.go"})
+	if err != nil {
+		t.Fatalf("LFSFiles() error: %v", err)
+	}
+	if !tracked["logo.png"] || tracked["main.go"] {
+		t.Errorf("LFSFiles() = %v, want only logo.png", tracked)
+	}
+
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	if data, err := LFSObject(oid); err != nil || data != nil {
+		t.Errorf("LFSObject() = %q, %v, want nil for an object not downloaded", data, err)
+	}
+	writeFile(t, filepath.Join(dir, ".git", "lfs", "objects", oid[0:2], oid[2:4], oid), "PNG")
+	// The object directory is resolved once per repository, so a later read
+	// needs no git.
+	t.Setenv("PATH", "")
+	if data, err := LFSObject(oid); err != nil || string(data) != "PNG" {
+		t.Errorf("LFSObject() = %q, %v, want the cached object", data, err)
+	}
+}
+
+func TestSubmodule(t *testing.T) {
+	dir := initRepo(t, map[string]string{"README": "parent\n"})
+	sub := filepath.Join(dir, "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, sub, "init", "-q")
+	runGit(t, sub, "commit", "-q", "--allow-empty", "-m", "first")
+	old := strings.TrimSpace(runGit(t, sub, "rev-parse", "HEAD"))
+	runGit(t, dir, "add", "sub")
+	runGit(t, dir, "commit", "-q", "-m", "add sub")
+
+	runGit(t, sub, "commit", "-q", "--allow-empty", "-m", "second")
+	runGit(t, sub, "commit", "-q", "--allow-empty", "-m", "third")
+	cur := strings.TrimSpace(runGit(t, sub, "rev-parse", "HEAD"))
+
+	msg := DiffCmd(context.Background(), "HEAD", "sub", "", diff.Options{})()
+	changes := SubmoduleChanges("sub", diff.StripANSI(msg.(DiffMsg).Content))
+	if len(changes) != 1 || changes[0].Old != old || changes[0].New != cur {
+		t.Fatalf("SubmoduleChanges() = %+v, want %s -> %s", changes, old, cur)
+	}
+
+	log, err := SubmoduleLog(changes[0])
+	if err != nil {
+		t.Fatalf("SubmoduleLog() error: %v", err)
+	}
+	if len(log.Commits) != 2 || log.Rewound || !strings.HasSuffix(log.Commits[0], " third") {
+		t.Errorf("SubmoduleLog() = %+v, want second and third", log)
+	}
+
+	back, err := SubmoduleLog(submodule.Change{Path: "sub", Old: cur, New: old})
+	if err != nil {
+		t.Fatalf("SubmoduleLog(rewound) error: %v", err)
+	}
+	if !back.Rewound || len(back.Commits) != 2 {
+		t.Errorf("SubmoduleLog(rewound) = %+v, want two dropped commits", back)
+	}
+}
+
+func TestUnmergedFiles(t *testing.T) {
+	dir := initRepo(t, map[string]string{"a.txt": "base\n", "b.txt": "same\n"})
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, filepath.Join(dir, "a.txt"), "theirs\n")
+	runGit(t, dir, "commit", "-q", "-am", "theirs")
+	runGit(t, dir, "checkout", "-q", "-")
+	writeFile(t, filepath.Join(dir, "a.txt"), "ours\n")
+	runGit(t, dir, "commit", "-q", "-am", "ours")
+
+	// The merge is expected to fail with a conflict.
+	_ = exec.Command("git", "-C", dir, "-c", "user.name=difi", "-c", "user.email=difi@example.com", "merge", "-q", "feature").Run()
+
+	files, err := UnmergedFiles()
+	if err != nil {
+		t.Fatalf("UnmergedFiles() error: %v", err)
+	}
+	if len(files) != 1 || files[0] != "a.txt" {
+		t.Fatalf("UnmergedFiles() = %v, want [a.txt]", files)
+	}
+	if base, err := MergeBase("a.txt"); err != nil || string(base) != "base\n" {
+		t.Errorf("MergeBase() = %q, %v, want %q", base, err, "base\n")
+	}
+
+	writeFile(t, WorkingFile("a.txt"), "resolved\n")
+	if err := MarkResolved("a.txt"); err != nil {
+		t.Fatalf("MarkResolved() error: %v", err)
+	}
+	if files, _ := UnmergedFiles(); len(files) != 0 {
+		t.Errorf("UnmergedFiles() after MarkResolved = %v, want none", files)
+	}
+}
+
+func TestStreamDiff(t *testing.T) {
+	body := "one\ntwo\nthree\nfour\nfive\n"
+	dir := initRepo(t, map[string]string{"old.go": body, "main.go": "a\n", "ws.go": "x\n"})
+	runGit(t, dir, "mv", "old.go", "new.go")
+	writeFile(t, filepath.Join(dir, "new.go"), body+"six\n")
+	writeFile(t, filepath.Join(dir, "main.go"), "b\nc\n")
+	writeFile(t, filepath.Join(dir, "ws.go"), "x \n")
+
+	r, err := StreamDiff(context.Background(), "HEAD", diff.Options{})
+	if err != nil {
+		t.Fatalf("StreamDiff() error: %v", err)
+	}
+	sections := map[string]diff.Section{}
+	var order []string
+	err = diff.ReadSections(r, func(s diff.Section) error {
+		sections[s.Path] = s
+		order = append(order, s.Path)
+		return nil
+	})
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatalf("reading StreamDiff() error: %v", err)
+	}
+	if want := []string{"main.go", "new.go", "ws.go"}; !slices.Equal(order, want) {
+		t.Fatalf("StreamDiff() files = %v, want %v", order, want)
+	}
+	if s := sections["main.go"]; s.Added != 2 || s.Deleted != 1 {
+		t.Errorf("main.go stats = +%d -%d, want +2 -1", s.Added, s.Deleted)
+	}
+	if s := sections["new.go"]; s.Rename.From != "old.go" || s.Added != 1 {
+		t.Errorf("new.go = %+v, want renamed from old.go with one added line", s)
+	}
+
+	// Each section is what the per-file diff would have printed.
+	for path, s := range sections {
+		msg := DiffCmd(context.Background(), "HEAD", path, s.Rename.From, diff.Options{})().(DiffMsg)
+		if msg.Err != nil || msg.Content != s.Text {
+			t.Errorf("section of %s = %q, DiffCmd() = %q, %v", path, s.Text, msg.Content, msg.Err)
+		}
+	}
+
+	bad, err := StreamDiff(context.Background(), "no-such-rev", diff.Options{})
+	if err != nil {
+		t.Fatalf("StreamDiff(no-such-rev) error: %v", err)
+	}
+	_ = diff.ReadSections(bad, func(diff.Section) error { return nil })
+	var exitErr *exec.ExitError
+	if err := bad.Close(); !errors.As(err, &exitErr) || len(exitErr.Stderr) == 0 {
+		t.Errorf("Close() = %v, want an exit error with stderr", err)
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	dir := initRepo(t, map[string]string{"tracked.log": "t\n"})
+	writeFile(t, filepath.Join(dir, ".gitignore"), "*.log\nbuild/\n")
+	paths := []string{
+		filepath.Join(dir, "debug.log"),
+		filepath.Join(dir, "build"),
+		filepath.Join(dir, "src"),
+		filepath.Join(dir, "tracked.log"),
+	}
+	if err := os.Mkdir(paths[1], 0755); err != nil {
+		t.Fatal(err)
+	}
+	ignored, err := Ignored(paths)
+	if err != nil {
+		t.Fatalf("Ignored() error: %v", err)
+	}
+	if !ignored[paths[0]] || !ignored[paths[1]] || len(ignored) != 2 {
+		t.Errorf("Ignored() = %v, want debug.log and build", ignored)
+	}
+
+	none, err := Ignored(paths[2:])
+	if err != nil || len(none) != 0 {
+		t.Errorf("Ignored(src, tracked.log) = %v, %v, want nothing", none, err)
+	}
+}
@@ -0,0 +1,49 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// UnmergedFiles lists the paths git could not merge.
+func UnmergedFiles() ([]string, error) {
+	out, err := gitCmd("diff", "--name-only", "-z", "--diff-filter=U").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff error: %w", err)
+	}
+	files := []string{}
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// WorkingFile returns where a repository path lives in the working tree.
+func WorkingFile(path string) string {
+	return filepath.Join(repoRoot(), path)
+}
+
+// MergeBase returns path as it was in the merge's common ancestor, which git
+// keeps in stage 1 of the index. It is nil when there is no such stage, as
+// when both sides added the file.
+func MergeBase(path string) ([]byte, error) {
+	blobs, err := CatFile(context.Background(), []string{":1:" + path})
+	if err != nil {
+		return nil, err
+	}
+	return blobs[0], nil
+}
+
+// MarkResolved stages path, which is how git records a resolved conflict.
+func MarkResolved(path string) error {
+	cmd := gitCmd("add", "--", path)
+	cmd.Dir = repoRoot()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git add error: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
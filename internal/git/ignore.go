@@ -0,0 +1,31 @@
+package git
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// Ignored returns the paths among paths, absolute or relative to the
+// current directory, that .gitignore and the other exclude files leave out.
+// Tracked files are never ignored.
+func Ignored(paths []string) (map[string]bool, error) {
+	cmd := gitCmd("check-ignore", "-z", "--stdin")
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	out, err := cmd.Output()
+	// Exit status 1 means none of the paths are ignored.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ignored := make(map[string]bool)
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path != "" {
+			ignored[path] = true
+		}
+	}
+	return ignored, nil
+}
@@ -0,0 +1,88 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// LFSFiles returns the paths among files that are tracked by Git LFS, i.e.
+// whose filter attribute is "lfs". Paths are relative to the repository
+// root, like the rest of difi's paths.
+func LFSFiles(files []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(files) == 0 {
+		return result, nil
+	}
+
+	cmd := gitCmd("check-attr", "-z", "--stdin", "filter")
+	cmd.Dir = repoRoot()
+	cmd.Stdin = strings.NewReader(strings.Join(files, "\x00") + "\x00")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git check-attr error: %w", err)
+	}
+
+	// With -z the output is "path\0attribute\0value\0" per path.
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		if fields[i+2] == "lfs" {
+			result[fields[i]] = true
+		}
+	}
+	return result, nil
+}
+
+// lfsDirs caches the LFS object directory by the working directory git
+// resolves it from, so that showing a tree of LFS images asks git once.
+var lfsDirs = struct {
+	mu sync.Mutex
+	m  map[string]string
+}{m: make(map[string]string)}
+
+// lfsObjectDir returns the directory the local LFS cache keeps objects in.
+// Worktrees share their main repository's.
+func lfsObjectDir() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	lfsDirs.mu.Lock()
+	defer lfsDirs.mu.Unlock()
+	if dir, ok := lfsDirs.m[wd]; ok {
+		return dir, nil
+	}
+
+	out, err := gitCmd("rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse error: %w", err)
+	}
+	// A relative answer is relative to the working directory.
+	gitDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(wd, gitDir)
+	}
+	dir := filepath.Join(gitDir, "lfs", "objects")
+	lfsDirs.m[wd] = dir
+	return dir, nil
+}
+
+// LFSObject reads an object from the local LFS cache. It returns nil when
+// the object has not been downloaded.
+func LFSObject(oid string) ([]byte, error) {
+	if len(oid) < 5 {
+		return nil, nil
+	}
+	dir, err := lfsObjectDir()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, oid[0:2], oid[2:4], oid))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
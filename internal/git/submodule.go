@@ -0,0 +1,76 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/oug-t/difi/internal/submodule"
+)
+
+// emptyTree is the id of the tree with no entries, which every git
+// repository knows. Diffing against it shows a whole tree as added.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// submoduleLogLimit caps how many commits are listed for one bump.
+const submoduleLogLimit = 50
+
+// SubmoduleChanges recognises a submodule pointer change in the diff of
+// path.
+func SubmoduleChanges(path, diffText string) []submodule.Change {
+	if c, ok := submodule.ParseGit(path, diffText); ok {
+		return []submodule.Change{c}
+	}
+	return nil
+}
+
+// SubmoduleLog lists the commits a submodule bump brings in, or drops when
+// the submodule was moved back to an older commit.
+func SubmoduleLog(c submodule.Change) (submodule.Log, error) {
+	if c.Removed() {
+		return submodule.Log{}, nil
+	}
+	if c.Added() {
+		commits, err := submoduleLog(c.Path, c.New)
+		return submodule.Log{Commits: commits}, err
+	}
+
+	commits, err := submoduleLog(c.Path, c.Old+".."+c.New)
+	if err != nil || len(commits) > 0 || c.Old == c.New {
+		return submodule.Log{Commits: commits}, err
+	}
+	dropped, err := submoduleLog(c.Path, c.New+".."+c.Old)
+	return submodule.Log{Commits: dropped, Rewound: len(dropped) > 0}, err
+}
+
+func submoduleLog(path, revs string) ([]string, error) {
+	dir := filepath.Join(repoRoot(), path)
+	out, err := gitCmd("-C", dir, "log", "--oneline", "--no-decorate",
+		fmt.Sprintf("-n%d", submoduleLogLimit), revs).Output()
+	if err != nil {
+		return nil, fmt.Errorf("submodule %s is not checked out or lacks these commits", path)
+	}
+	var commits []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+// SubmoduleArgs returns the directory and difi arguments for reviewing a
+// submodule bump on its own. A dirty submodule is compared against its
+// working tree.
+func SubmoduleArgs(c submodule.Change) (dir string, args []string) {
+	dir = filepath.Join(repoRoot(), c.Path)
+	old := c.Old
+	if c.Added() {
+		old = emptyTree
+	}
+	target := old + ".." + c.New
+	if c.Dirty {
+		target = old
+	}
+	return dir, []string{"--vcs", "git", target}
+}
@@ -1,19 +1,23 @@
 package hg
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/backend"
+	"github.com/oug-t/difi/internal/diff"
 )
 
 var hgRoot string
-var ansiRe = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
-var hunkHeaderRe = regexp.MustCompile(`^.*?@@ \-\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
 
 func getHgRoot() string {
 	if hgRoot != "" {
@@ -29,7 +33,13 @@ func getHgRoot() string {
 }
 
 func hgCmd(args ...string) *exec.Cmd {
-	cmd := exec.Command("hg", args...)
+	return hgCmdContext(context.Background(), args...)
+}
+
+// hgCmdContext is hgCmd for operations that are cancelled with ctx: hg is
+// killed when ctx is done.
+func hgCmdContext(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "hg", args...)
 	cmd.Env = append(os.Environ(), "HGRCPATH="+os.DevNull)
 	if root := getHgRoot(); root != "" {
 		cmd.Dir = root
@@ -58,114 +68,289 @@ func GetRepoName() string {
 	return "Repo"
 }
 
-func ListChangedFiles(targetBranch string) ([]string, error) {
-	var cmd *exec.Cmd
-	if targetBranch == "tip" || targetBranch == "." || targetBranch == "" {
-		cmd = hgCmd("status", "--no-status")
-	} else {
-		cmd = hgCmd("status", "--rev", targetBranch, "--no-status")
+// ListChangedFiles returns the changed paths. A renamed file is listed
+// once, under its new name.
+func ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	files, _, err := status(ctx, targetBranch, opts)
+	return files, err
+}
+
+// RenamesByFile maps the new path of each copied or renamed file to its
+// source.
+func RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	_, renames, err := status(ctx, targetBranch, opts)
+	return renames, err
+}
+
+// status runs `hg status --copies`, where each added file that was copied
+// is followed by an indented line naming its source. A copy whose source
+// was removed is a rename. hg records copies without scoring them, so the
+// similarity is computed here; a pair below the threshold is listed as an
+// added file and, for a rename, a removed one.
+func status(ctx context.Context, targetBranch string, opts diff.Options) ([]string, map[string]diff.Rename, error) {
+	args := []string{"status", "--copies"}
+	if targetBranch != "tip" && targetBranch != "." && targetBranch != "" {
+		args = append(args, "--rev", targetBranch)
+	}
+	out, err := hgCmdContext(ctx, args...).Output()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	out, err := cmd.Output()
+	var paths []string
+	renames := make(map[string]diff.Rename)
+	removed := make(map[string]bool)
+	last := ""
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) < 3 {
+			continue
+		}
+		if line[0] == ' ' {
+			if last != "" {
+				renames[last] = diff.Rename{From: strings.TrimSpace(line), Copy: true}
+			}
+			continue
+		}
+		last = ""
+		path := line[2:]
+		switch line[0] {
+		case 'R':
+			removed[path] = true
+		case 'A':
+			last = path
+		}
+		paths = append(paths, path)
+	}
+
+	for path, r := range renames {
+		if removed[r.From] {
+			r.Copy = false
+			renames[path] = r
+		}
+		if r.Copy && !opts.FindCopies {
+			delete(renames, path)
+		}
+	}
+	if err := score(ctx, targetBranch, renames, opts); err != nil {
+		return nil, nil, err
+	}
+
+	files := []string{}
+	sources := make(map[string]bool)
+	for _, r := range renames {
+		if !r.Copy {
+			sources[r.From] = true
+		}
+	}
+	for _, path := range paths {
+		if !sources[path] {
+			files = append(files, path)
+		}
+	}
+	return files, renames, nil
+}
+
+// score sets the similarity of each pair in renames, dropping the pairs
+// below the threshold. The sources are read with one `hg cat`.
+func score(ctx context.Context, targetBranch string, renames map[string]diff.Rename, opts diff.Options) error {
+	if len(renames) == 0 {
+		return nil
+	}
+	var sources []string
+	for _, r := range renames {
+		sources = append(sources, r.From)
+	}
+	old, err := catFiles(ctx, revOrParent(targetBranch), sources)
+	if err != nil {
+		return err
+	}
+	root := getHgRoot()
+	for path, r := range renames {
+		data, _ := os.ReadFile(filepath.Join(root, path))
+		r.Similarity = diff.Similarity(old[r.From], data)
+		if r.Similarity < opts.Threshold() {
+			delete(renames, path)
+			continue
+		}
+		renames[path] = r
+	}
+	return nil
+}
+
+// catFiles reads paths as of rev. A single `hg cat` writes each of them to
+// a file of its own in a temporary directory. Paths missing from rev are
+// left out.
+func catFiles(ctx context.Context, rev string, paths []string) (map[string][]byte, error) {
+	dir, err := os.MkdirTemp("", "difi-hg-cat-")
 	if err != nil {
 		return nil, err
 	}
-	files := strings.Split(strings.TrimSpace(string(out)), "\n")
-	if len(files) == 1 && files[0] == "" {
-		return []string{}, nil
+	defer os.RemoveAll(dir)
+
+	args := append([]string{"cat", "--rev", rev, "--output", filepath.Join(dir, "%p"), "--"}, paths...)
+	if err := hgCmdContext(ctx, args...).Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return nil, fmt.Errorf("hg cat error: %w", err)
+		}
+	}
+	files := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path))); err == nil {
+			files[path] = data
+		}
 	}
 	return files, nil
 }
 
-func DiffCmd(targetBranch, path string) tea.Cmd {
+func revOrParent(targetBranch string) string {
+	if targetBranch == "tip" || targetBranch == "" {
+		return "."
+	}
+	return targetBranch
+}
+
+// DiffCmd loads the diff of path. For a renamed or copied file, oldPath
+// names the source and the diff is taken in git format so hg reports the
+// rename; otherwise it is empty.
+func DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
 	return func() tea.Msg {
-		var cmd *exec.Cmd
-		if targetBranch == "tip" || targetBranch == "." || targetBranch == "" {
-			cmd = hgCmd("diff", "--color=always", path)
-		} else {
-			cmd = hgCmd("diff", "--color=always", "--rev", targetBranch, path)
+		// hg diff has no choice of algorithm, so anything but the default
+		// goes through the builtin engine.
+		if opts.NeedsBuiltin() || opts.Algorithm != diff.Myers {
+			out, err := BuiltinDiff(ctx, targetBranch, path, oldPath, opts)
+			if err != nil {
+				return DiffMsg{Err: err}
+			}
+			return DiffMsg{Content: out}
 		}
 
+		args := append([]string{"diff", "--color=always"}, whitespaceArgs(opts)...)
+		if oldPath != "" {
+			args = append(args, "--git")
+		}
+		if targetBranch != "tip" && targetBranch != "." && targetBranch != "" {
+			args = append(args, "--rev", targetBranch)
+		}
+		args = append(args, path)
+		if oldPath != "" {
+			args = append(args, oldPath)
+		}
+		cmd := hgCmdContext(ctx, args...)
+
 		out, err := cmd.Output()
 		if err != nil {
-			return DiffMsg{Content: "Error fetching diff: " + err.Error()}
+			return DiffMsg{Err: err}
 		}
 		return DiffMsg{Content: string(out)}
 	}
 }
 
-func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
-	var args []string
-	if lineNumber > 0 {
-		args = append(args, fmt.Sprintf("+%d", lineNumber))
+// StreamDiff starts a single diff of every changed file, in git format so
+// copies and renames are marked, and returns its output as hg writes it.
+// Closing the reader waits for hg and returns its error.
+func StreamDiff(ctx context.Context, targetBranch string, opts diff.Options) (io.ReadCloser, error) {
+	args := append([]string{"diff", "--color=always", "--git"}, whitespaceArgs(opts)...)
+	if targetBranch != "tip" && targetBranch != "." && targetBranch != "" {
+		args = append(args, "--rev", targetBranch)
 	}
-	args = append(args, path)
+	return backend.Stream(hgCmdContext(ctx, args...))
+}
 
-	c := exec.Command(editor, args...)
-	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
-	if root := getHgRoot(); root != "" {
-		c.Dir = root
+// whitespaceArgs maps the whitespace options onto hg diff flags. hg has no
+// flag for carriage returns alone; ignoring whitespace at end of line is
+// the closest match.
+func whitespaceArgs(opts diff.Options) []string {
+	var args []string
+	if opts.IgnoreAllSpace {
+		args = append(args, "--ignore-all-space")
 	}
-
-	c.Env = append(os.Environ(), fmt.Sprintf("DIFI_TARGET=%s", targetBranch))
-
-	return tea.ExecProcess(c, func(err error) tea.Msg {
-		return EditorFinishedMsg{Err: err}
-	})
+	if opts.IgnoreSpaceChange {
+		args = append(args, "--ignore-space-change")
+	}
+	if opts.IgnoreBlankLines {
+		args = append(args, "--ignore-blank-lines")
+	}
+	if opts.IgnoreCRAtEOL {
+		args = append(args, "--ignore-space-at-eol")
+	}
+	return args
 }
 
-func DiffStats(targetBranch string) (added int, deleted int, err error) {
-	var cmd *exec.Cmd
-	if targetBranch == "tip" || targetBranch == "." || targetBranch == "" {
-		cmd = hgCmd("diff", "--stat")
-	} else {
-		cmd = hgCmd("diff", "--rev", targetBranch, "--stat")
+// statCmd builds `hg diff --git --stat` against the target with whitespace
+// flags. Git mode marks binary files "Bin" instead of counting them.
+func statCmd(ctx context.Context, targetBranch string, opts diff.Options) *exec.Cmd {
+	args := append([]string{"diff", "--git"}, whitespaceArgs(opts)...)
+	if targetBranch != "tip" && targetBranch != "." && targetBranch != "" {
+		args = append(args, "--rev", targetBranch)
 	}
+	return hgCmdContext(ctx, append(args, "--stat")...)
+}
 
-	out, err := cmd.Output()
+// BuiltinDiff reads the file at the target revision with `hg cat` and diffs
+// it in-process against the working copy. oldPath is the rename source, if
+// any.
+func BuiltinDiff(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) (string, error) {
+	f, err := FileContents(ctx, targetBranch, path, oldPath)
 	if err != nil {
-		return 0, 0, fmt.Errorf("hg diff stats error: %w", err)
+		return "", err
 	}
+	return diff.Render(f, opts), nil
+}
 
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "changed") && (strings.Contains(line, "insertion") || strings.Contains(line, "deletion")) {
-			reAdded := regexp.MustCompile(`(\d+) insertion[s]?\(\+\)`)
-			if matches := reAdded.FindStringSubmatch(line); len(matches) > 1 {
-				if n, err := strconv.Atoi(matches[1]); err == nil {
-					added = n
-				}
-			}
+// FileContents loads path at the target revision and from the working copy.
+func FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	return backend.FileContents(ctx, Cat, getHgRoot(), revOrParent(targetBranch), "", path, oldPath)
+}
 
-			reDeleted := regexp.MustCompile(`(\d+) deletion[s]?\(\-\)`)
-			if matches := reDeleted.FindStringSubmatch(line); len(matches) > 1 {
-				if n, err := strconv.Atoi(matches[1]); err == nil {
-					deleted = n
-				}
-			}
-			break
+// Cat returns the contents of path at rev, or nil when the file does not
+// exist in that revision.
+func Cat(ctx context.Context, rev, path string) ([]byte, error) {
+	out, err := hgCmdContext(ctx, "cat", "--rev", rev, path).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("hg cat error: %w", err)
+	}
+	if out == nil {
+		out = []byte{}
 	}
-	return added, deleted, nil
+	return out, nil
 }
 
-func DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
-	var cmd *exec.Cmd
-	if targetBranch == "tip" || targetBranch == "." || targetBranch == "" {
-		cmd = hgCmd("diff", "--stat")
-	} else {
-		cmd = hgCmd("diff", "--rev", targetBranch, "--stat")
-	}
+func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	c := backend.EditorCmd(getHgRoot(), path, lineNumber, targetBranch, editor)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return EditorFinishedMsg{Err: err}
+	})
+}
 
-	out, err := cmd.Output()
+var (
+	insertionsRe = regexp.MustCompile(`(\d+) insertions?\(\+\)`)
+	deletionsRe  = regexp.MustCompile(`(\d+) deletions?\(-\)`)
+)
+
+// Stats counts the changes from one `hg diff --stat`: the totals from its
+// summary line, each file's from the +/- of its line, and the binary files
+// from their "Bin" mark. With whitespace options set, files whose changes
+// are all whitespace are left out of ByFile.
+func Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	out, err := statCmd(ctx, targetBranch, opts).Output()
 	if err != nil {
-		return nil, fmt.Errorf("hg diff stat error: %w", err)
+		return diff.Summary{}, fmt.Errorf("hg diff stat error: %w", err)
 	}
 
-	result := make(map[string][2]int)
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, line := range lines {
+	s := diff.Summary{ByFile: make(map[string][2]int), Binary: make(map[string]bool)}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
 		if strings.Contains(line, "changed") && (strings.Contains(line, "insertion") || strings.Contains(line, "deletion")) {
+			if m := insertionsRe.FindStringSubmatch(line); m != nil {
+				s.Added, _ = strconv.Atoi(m[1])
+			}
+			if m := deletionsRe.FindStringSubmatch(line); m != nil {
+				s.Deleted, _ = strconv.Atoi(m[1])
+			}
 			continue
 		}
 		pipeIdx := strings.LastIndex(line, "|")
@@ -174,6 +359,15 @@ func DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
 		}
 		filePath := strings.TrimSpace(line[:pipeIdx])
 		changesPart := strings.TrimSpace(line[pipeIdx+1:])
+		if filePath == "" {
+			continue
+		}
+		if strings.HasPrefix(changesPart, "Bin") {
+			// Like git's numstat, a binary file counts no lines.
+			s.ByFile[filePath] = [2]int{}
+			s.Binary[filePath] = true
+			continue
+		}
 		var a, d int
 		for _, ch := range changesPart {
 			if ch == '+' {
@@ -182,95 +376,38 @@ func DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
 				d++
 			}
 		}
-		if filePath != "" {
-			result[filePath] = [2]int{a, d}
-		}
-	}
-	return result, nil
-}
-
-func CalculateFileLine(diffContent string, visualLineIndex int) int {
-	lines := strings.Split(diffContent, "\n")
-	if visualLineIndex >= len(lines) {
-		return 0
-	}
-
-	currentLineNo := 0
-	lastWasHunk := false
-	inHeader := true
-
-	for i := 0; i <= visualLineIndex; i++ {
-		line := lines[i]
-		matches := hunkHeaderRe.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			startLine, _ := strconv.Atoi(matches[1])
-			currentLineNo = startLine
-			lastWasHunk = true
-			inHeader = false
-			continue
-		}
-
-		lastWasHunk = false
-		cleanLine := stripAnsi(line)
-
-		if inHeader {
-			continue
-		}
-
-		if strings.HasPrefix(cleanLine, " ") || strings.HasPrefix(cleanLine, "+") {
-			currentLineNo++
-		}
-	}
-
-	if currentLineNo == 0 {
-		return 1
+		s.ByFile[filePath] = [2]int{a, d}
 	}
-	if lastWasHunk {
-		return currentLineNo - 1
-	}
-	return currentLineNo - 1
+	return s, nil
 }
 
-func stripAnsi(str string) string {
-	return ansiRe.ReplaceAllString(str, "")
+// DiffMsg carries a file's diff, or the error that kept it from loading.
+type DiffMsg struct {
+	Content string
+	Err     error
 }
 
-type DiffMsg struct{ Content string }
 type EditorFinishedMsg struct{ Err error }
 
 func ParseFilesFromDiff(diffText string) []string {
-	var files []string
-	seen := make(map[string]bool)
-	lines := strings.Split(diffText, "\n")
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff -r ") {
-			parts := strings.Fields(line)
-			if len(parts) >= 3 {
-				file := parts[len(parts)-1]
-				if !seen[file] {
-					seen[file] = true
-					files = append(files, file)
-				}
-			}
-		}
-	}
-	return files
+	return backend.ParseFiles(diffText, sectionPath)
 }
 
 func ExtractFileDiff(diffText, targetPath string) string {
-	lines := strings.Split(diffText, "\n")
-	var out []string
-	inTarget := false
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "diff -r ") {
-			parts := strings.Fields(line)
-			inTarget = len(parts) > 0 && parts[len(parts)-1] == targetPath
-		}
-		if inTarget {
-			out = append(out, line)
-		}
+	return backend.ExtractFile(diffText, targetPath, sectionPath)
+}
+
+// sectionPath returns the file the section starting at lines[i] is about:
+// `hg diff --git` headers are read like git's, plain ones end in the path.
+func sectionPath(lines []string, i int) (string, bool) {
+	if path, ok := diff.SectionPath(lines, i); ok {
+		return path, true
+	}
+	if !strings.HasPrefix(lines[i], "diff -r ") {
+		return "", false
+	}
+	if parts := strings.Fields(lines[i]); len(parts) >= 3 {
+		return parts[len(parts)-1], true
 	}
-	return strings.Join(out, "\n")
+	return "", true
 }
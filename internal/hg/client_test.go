@@ -1,106 +1,16 @@
 package hg
 
 import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
-)
-
-func TestStripAnsi(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		{
-			name:     "no ansi codes",
-			input:    "plain text",
-			expected: "plain text",
-		},
-		{
-			name:     "colored text",
-			input:    "\033[31mred text\033[0m",
-			expected: "red text",
-		},
-		{
-			name:     "multiple colors",
-			input:    "\033[32m+added\033[0m \033[31m-deleted\033[0m",
-			expected: "+added -deleted",
-		},
-		{
-			name:     "complex ansi",
-			input:    "\033[1;32m+\033[0m\033[32mline\033[0m",
-			expected: "+line",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := stripAnsi(tt.input)
-			if result != tt.expected {
-				t.Errorf("stripAnsi(%q) = %q, want %q", tt.input, result, tt.expected)
-			}
-		})
-	}
-}
 
-func TestCalculateFileLine(t *testing.T) {
-	diffContent := `diff -r 123456 file.go
---- a/file.go	Tue Jan 01 00:00:00 2024 +0000
-+++ b/file.go	Tue Jan 01 00:00:01 2024 +0000
-@@ -10,7 +10,8 @@
- func main() {
--	fmt.Println("old")
-+	fmt.Println("new")
-+	fmt.Println("added")
- }
- `
-
-	tests := []struct {
-		name              string
-		visualLineIndex   int
-		expectedLineNo    int
-	}{
-		{
-			name:            "header line",
-			visualLineIndex: 0,
-			expectedLineNo:  1,
-		},
-		{
-			name:            "hunk header",
-			visualLineIndex: 3,
-			expectedLineNo:  9,
-		},
-		{
-			name:            "context line",
-			visualLineIndex: 4,
-			expectedLineNo:  10,
-		},
-		{
-			name:            "deleted line",
-			visualLineIndex: 5,
-			expectedLineNo:  10,
-		},
-		{
-			name:            "added line 1",
-			visualLineIndex: 6,
-			expectedLineNo:  11,
-		},
-		{
-			name:            "added line 2",
-			visualLineIndex: 7,
-			expectedLineNo:  12,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := CalculateFileLine(diffContent, tt.visualLineIndex)
-			if result != tt.expectedLineNo {
-				t.Errorf("CalculateFileLine(%d) = %d, want %d", tt.visualLineIndex, result, tt.expectedLineNo)
-			}
-		})
-	}
-}
+	"github.com/oug-t/difi/internal/diff"
+)
 
 func TestParseFilesFromDiff(t *testing.T) {
 	diffText := `diff -r 123456 file1.go
@@ -210,4 +120,74 @@ func TestExtractFileDiffNotFound(t *testing.T) {
 	if strings.TrimSpace(result) != "" {
 		t.Errorf("ExtractFileDiff() for nonexistent file = %q, want empty", result)
 	}
-}
\ No newline at end of file
+}
+
+// initRepo creates a throwaway repository with one commit and changes into
+// it for the duration of the test.
+func initRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("hg"); err != nil {
+		t.Skip("hg not installed")
+	}
+	dir := t.TempDir()
+	runHg(t, dir, "init")
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runHg(t, dir, "commit", "-A", "-q", "-m", "initial")
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	hgRoot = ""
+	t.Cleanup(func() {
+		os.Chdir(originalDir)
+		hgRoot = ""
+	})
+	return dir
+}
+
+func runHg(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("hg", append([]string{"--config", "ui.username=difi"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HGRCPATH="+os.DevNull)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("hg %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func TestRenameThreshold(t *testing.T) {
+	lines := strings.Repeat("line\n", 20)
+	dir := initRepo(t, map[string]string{"kept.txt": lines, "rewritten.txt": lines})
+	runHg(t, dir, "mv", "kept.txt", "moved.txt")
+	runHg(t, dir, "mv", "rewritten.txt", "replaced.txt")
+	if err := os.WriteFile(filepath.Join(dir, "replaced.txt"), []byte("something else\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	files, err := ListChangedFiles(ctx, "tip", diff.Options{})
+	if err != nil {
+		t.Fatalf("ListChangedFiles() error: %v", err)
+	}
+	slices.Sort(files)
+	// The rewritten file scores below the threshold, so its source stays
+	// listed as removed.
+	if want := []string{"moved.txt", "replaced.txt", "rewritten.txt"}; !slices.Equal(files, want) {
+		t.Errorf("ListChangedFiles() = %v, want %v", files, want)
+	}
+	renames, err := RenamesByFile(ctx, "tip", diff.Options{})
+	if err != nil {
+		t.Fatalf("RenamesByFile() error: %v", err)
+	}
+	if len(renames) != 1 || renames["moved.txt"].From != "kept.txt" || renames["moved.txt"].Similarity != 100 {
+		t.Errorf("RenamesByFile() = %+v, want only moved.txt from kept.txt", renames)
+	}
+}
@@ -0,0 +1,42 @@
+package hg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// UnmergedFiles lists the paths `hg resolve --list` reports as unresolved.
+func UnmergedFiles() ([]string, error) {
+	out, err := hgCmd("resolve", "--list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("hg resolve error: %w", err)
+	}
+	files := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if path, ok := strings.CutPrefix(line, "U "); ok {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// WorkingFile returns where a repository path lives in the working copy.
+func WorkingFile(path string) string {
+	return filepath.Join(getHgRoot(), path)
+}
+
+// MergeBase returns path as it was in the common ancestor of the working
+// copy's two parents. It is nil when the ancestor lacks the file.
+func MergeBase(path string) ([]byte, error) {
+	return Cat(context.Background(), "ancestor(p1(), p2())", WorkingFile(path))
+}
+
+// MarkResolved records path as resolved.
+func MarkResolved(path string) error {
+	if out, err := hgCmd("resolve", "--mark", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("hg resolve error: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package hg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Ignored returns the files among paths, which are absolute, that .hgignore
+// leaves out. hg only answers for files, so directories are never reported.
+func Ignored(paths []string) (map[string]bool, error) {
+	var files []string
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	args := append([]string{"status", "--ignored", "--no-status", "--print0", "--"}, files...)
+	out, err := hgCmd(args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	ignored := make(map[string]bool)
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path != "" {
+			// hg prints paths relative to the root, where it runs.
+			ignored[filepath.Join(getHgRoot(), path)] = true
+		}
+	}
+	return ignored, nil
+}
@@ -0,0 +1,75 @@
+package hg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/oug-t/difi/internal/submodule"
+)
+
+// subrepoLogLimit caps how many changesets are listed for one subrepo.
+const subrepoLogLimit = 50
+
+// SubmoduleChanges reads subrepo revision changes out of the diff of
+// .hgsubstate. Any other path has none.
+func SubmoduleChanges(path, diffText string) []submodule.Change {
+	if filepath.Base(path) != ".hgsubstate" {
+		return nil
+	}
+	changes := submodule.ParseSubstate(diffText)
+	// .hgsubstate paths are relative to the directory holding it.
+	if dir := filepath.Dir(path); dir != "." {
+		for i := range changes {
+			changes[i].Path = filepath.ToSlash(filepath.Join(dir, changes[i].Path))
+		}
+	}
+	return changes
+}
+
+// SubmoduleLog lists the changesets between the old and new subrepo
+// revisions, or those dropped when the subrepo moved back.
+func SubmoduleLog(c submodule.Change) (submodule.Log, error) {
+	if c.Removed() {
+		return submodule.Log{}, nil
+	}
+	if c.Added() {
+		commits, err := subrepoLog(c.Path, "::"+c.New)
+		return submodule.Log{Commits: commits}, err
+	}
+
+	commits, err := subrepoLog(c.Path, fmt.Sprintf("only(%s, %s)", c.New, c.Old))
+	if err != nil || len(commits) > 0 || c.Old == c.New {
+		return submodule.Log{Commits: commits}, err
+	}
+	dropped, err := subrepoLog(c.Path, fmt.Sprintf("only(%s, %s)", c.Old, c.New))
+	return submodule.Log{Commits: dropped, Rewound: len(dropped) > 0}, err
+}
+
+func subrepoLog(path, revset string) ([]string, error) {
+	dir := filepath.Join(getHgRoot(), path)
+	out, err := hgCmd("-R", dir, "log", "-r", revset, "--limit", fmt.Sprint(subrepoLogLimit),
+		"--template", "{node|short} {desc|firstline}\n").Output()
+	if err != nil {
+		return nil, fmt.Errorf("subrepo %s is not checked out or lacks these changesets", path)
+	}
+	var commits []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+// SubmoduleArgs returns the directory and difi arguments for reviewing a
+// subrepo change on its own. The hg backend diffs a revision against the
+// working copy, which is checked out at the new state.
+func SubmoduleArgs(c submodule.Change) (dir string, args []string) {
+	dir = filepath.Join(getHgRoot(), c.Path)
+	old := c.Old
+	if c.Added() {
+		old = "null"
+	}
+	return dir, []string{"--vcs", "hg", old}
+}
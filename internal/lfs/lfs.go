@@ -0,0 +1,117 @@
+// Package lfs recognises Git LFS pointer files, the small text stubs git
+// stores in place of large objects.
+package lfs
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// Pointer is the content of an LFS pointer file.
+type Pointer struct {
+	OID  string // sha256 hex digest of the object
+	Size int64
+}
+
+const specPrefix = "version https://git-lfs"
+
+// Parse reads an LFS pointer. ok is false when text is not one.
+func Parse(text string) (p Pointer, ok bool) {
+	return parse(text, true)
+}
+
+// parse reads an LFS pointer, requiring its version line only when
+// needVersion is set. Without it, the oid and size must both be there.
+func parse(text string, needVersion bool) (p Pointer, ok bool) {
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sawVersion, sawSize := false, false
+	for sc.Scan() {
+		key, value, _ := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		switch key {
+		case "version":
+			if !strings.HasPrefix(sc.Text(), specPrefix) {
+				return Pointer{}, false
+			}
+			sawVersion = true
+		case "oid":
+			p.OID = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Pointer{}, false
+			}
+			p.Size, sawSize = n, true
+		case "":
+		default:
+			// The spec allows extension keys; anything else is not a
+			// pointer.
+			if !strings.HasPrefix(key, "ext-") {
+				return Pointer{}, false
+			}
+		}
+	}
+	if p.OID == "" || (needVersion && !sawVersion) || (!sawVersion && !sawSize) {
+		return Pointer{}, false
+	}
+	return p, true
+}
+
+// Change is an LFS-tracked file whose object changed. A nil side means the
+// file does not exist there.
+type Change struct {
+	Old, New *Pointer
+}
+
+// ParseDiff recognises the diff of an LFS pointer file. Pointers are only a
+// few lines long, so with any context the hunk holds both pointers whole;
+// without context, as with -U0, the unchanged version line is missing.
+// diffText must not contain color codes.
+func ParseDiff(diffText string) (Change, bool) {
+	var old, new strings.Builder
+	inHunk := false
+	for _, line := range strings.Split(diffText, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			continue
+		case strings.HasPrefix(line, "diff --git "):
+			// The next file's header.
+			inHunk = false
+			continue
+		}
+		if !inHunk || line == "" {
+			continue
+		}
+		switch line[0] {
+		case ' ':
+			old.WriteString(line[1:] + "\n")
+			new.WriteString(line[1:] + "\n")
+		case '-':
+			old.WriteString(line[1:] + "\n")
+		case '+':
+			new.WriteString(line[1:] + "\n")
+		}
+	}
+
+	var c Change
+	if p, ok := parse(old.String(), false); ok {
+		c.Old = &p
+	}
+	if p, ok := parse(new.String(), false); ok {
+		c.New = &p
+	}
+	oldEmpty, newEmpty := old.Len() == 0, new.Len() == 0
+	if (c.Old == nil && !oldEmpty) || (c.New == nil && !newEmpty) || (c.Old == nil && c.New == nil) {
+		return Change{}, false
+	}
+	return c, true
+}
+
+// ShortOID abbreviates an object id for display.
+func ShortOID(oid string) string {
+	if len(oid) > 10 {
+		return oid[:10] + "…"
+	}
+	return oid
+}
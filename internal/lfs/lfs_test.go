@@ -0,0 +1,66 @@
+package lfs
+
+import "testing"
+
+const oldOID = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+const newOID = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestParse(t *testing.T) {
+	p, ok := Parse("version https://git-lfs.github.com/spec/v1\noid sha256:" + oldOID + "\nsize 12345\n")
+	if !ok || p.OID != oldOID || p.Size != 12345 {
+		t.Errorf("Parse() = %+v, %v", p, ok)
+	}
+	if _, ok := Parse("package main\n"); ok {
+		t.Error("Parse() accepted a regular file")
+	}
+}
+
+func TestParseDiff(t *testing.T) {
+	text := `diff --git a/assets/logo.png b/assets/logo.png
+index 1111111..2222222 100644
+--- a/assets/logo.png
++++ b/assets/logo.png
+@@ -1,3 +1,3 @@
+ version https://git-lfs.github.com/spec/v1
+-oid sha256:` + oldOID + `
+-size 12345
++oid sha256:` + newOID + `
++size 23456
+`
+	c, ok := ParseDiff(text)
+	if !ok {
+		t.Fatal("ParseDiff() did not recognise a pointer diff")
+	}
+	if c.Old == nil || c.Old.OID != oldOID || c.Old.Size != 12345 {
+		t.Errorf("ParseDiff() old = %+v", c.Old)
+	}
+	if c.New == nil || c.New.OID != newOID || c.New.Size != 23456 {
+		t.Errorf("ParseDiff() new = %+v", c.New)
+	}
+
+	added := `@@ -0,0 +1,3 @@
++version https://git-lfs.github.com/spec/v1
++oid sha256:` + newOID + `
++size 10
+`
+	c, ok = ParseDiff(added)
+	if !ok || c.Old != nil || c.New == nil {
+		t.Errorf("ParseDiff(added) = %+v, %v", c, ok)
+	}
+
+	if _, ok := ParseDiff("@@ -1 +1 @@\n-a\n+b\n"); ok {
+		t.Error("ParseDiff() accepted a regular diff")
+	}
+
+	// -U0 leaves out the unchanged version line.
+	noContext := `@@ -2,2 +2,2 @@
+-oid sha256:` + oldOID + `
+-size 12345
++oid sha256:` + newOID + `
++size 23456
+`
+	c, ok = ParseDiff(noContext)
+	if !ok || c.Old == nil || c.Old.Size != 12345 || c.New == nil || c.New.OID != newOID {
+		t.Errorf("ParseDiff(-U0) = %+v, %v", c, ok)
+	}
+}
@@ -0,0 +1,249 @@
+// Package mbox splits patch series, as written by git format-patch or saved
+// from a mailing list, into their individual patches.
+package mbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/patch"
+)
+
+// Patch is one message of a series.
+type Patch struct {
+	Subject string
+	Author  string
+	Date    time.Time
+	// Message is the commit message, without the subject line.
+	Message string
+	// Diff is the patch itself, from its first file header on, in git's
+	// format: a unified or context diff is rewritten like a piped one.
+	Diff string
+}
+
+// fromRe matches the separator line that starts each message of an mbox:
+// "From <sender or sha> <asctime date>". git format-patch always writes
+// "From <sha> Mon Sep 17 00:00:00 2001".
+var fromRe = regexp.MustCompile(`^From \S+ +\w{3} \w{3} +\d{1,2} \d{1,2}:\d{2}:\d{2}(?: \S+)? \d{4}\s*$`)
+
+// subjectPrefixRe matches the "[PATCH v2 1/3]" tag of a subject.
+var subjectPrefixRe = regexp.MustCompile(`^(?:(?:Re|RE|Fwd):\s*)*\[[^\]]*\]\s*`)
+
+// IsSeries reports whether text is an mbox rather than a bare diff.
+func IsSeries(text string) bool {
+	line, _, _ := strings.Cut(strings.TrimLeft(text, "\r\n"), "\n")
+	return fromRe.MatchString(strings.TrimRight(line, "\r"))
+}
+
+// Parse splits an mbox into patches. Messages without a diff, such as the
+// cover letter of a series, are left out.
+func Parse(text string) []Patch {
+	var patches []Patch
+	for _, raw := range split(text) {
+		if p, ok := parseMessage(raw); ok {
+			patches = append(patches, p)
+		}
+	}
+	return patches
+}
+
+// Join gathers the diffs of a series into a single diff with one run of
+// sections per file, so the whole series can be browsed file by file. The
+// sections of a file changed by several patches follow each other in
+// series order; they are not merged into one.
+func Join(patches []Patch) string {
+	var order []string
+	byPath := make(map[string]*strings.Builder)
+	eachSection(patches, func(_ int, s diff.Section) {
+		sb, ok := byPath[s.Path]
+		if !ok {
+			sb = &strings.Builder{}
+			byPath[s.Path] = sb
+			order = append(order, s.Path)
+		}
+		sb.WriteString(s.Text)
+	})
+	var out strings.Builder
+	for _, path := range order {
+		out.WriteString(byPath[path].String())
+	}
+	return out.String()
+}
+
+// Files maps each path the series changes to the numbers, from 1, of the
+// patches that change it.
+func Files(patches []Patch) map[string][]int {
+	files := make(map[string][]int)
+	eachSection(patches, func(i int, s diff.Section) {
+		if n := files[s.Path]; len(n) == 0 || n[len(n)-1] != i+1 {
+			files[s.Path] = append(n, i+1)
+		}
+	})
+	return files
+}
+
+// eachSection calls fn with every file section of every patch, in order.
+func eachSection(patches []Patch, fn func(i int, s diff.Section)) {
+	for i, p := range patches {
+		_ = diff.ReadSections(strings.NewReader(p.Diff), func(s diff.Section) error {
+			fn(i, s)
+			return nil
+		})
+	}
+}
+
+// split cuts an mbox at its "From " separator lines, dropping them.
+func split(text string) []string {
+	var msgs []string
+	var cur []string
+	started := false
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if fromRe.MatchString(strings.TrimRight(line, "\r\n")) {
+			if started {
+				msgs = append(msgs, strings.Join(cur, ""))
+			}
+			cur = cur[:0]
+			started = true
+			continue
+		}
+		if started {
+			cur = append(cur, line)
+		}
+	}
+	if started {
+		msgs = append(msgs, strings.Join(cur, ""))
+	}
+	return msgs
+}
+
+func parseMessage(raw string) (Patch, bool) {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return Patch{}, false
+	}
+
+	var dec mime.WordDecoder
+	p := Patch{}
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	p.Subject = subjectPrefixRe.ReplaceAllString(subject, "")
+
+	from := msg.Header.Get("From")
+	if addr, err := (&mail.AddressParser{WordDecoder: &dec}).Parse(from); err == nil {
+		p.Author = addr.Name
+		if p.Author == "" {
+			p.Author = addr.Address
+		}
+	} else {
+		p.Author = from
+	}
+	p.Date, _ = msg.Header.Date()
+
+	body, err := decodeBody(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return Patch{}, false
+	}
+	p.Message, p.Diff = splitBody(strings.ReplaceAll(string(body), "\r\n", "\n"))
+	if p.Diff == "" {
+		return Patch{}, false
+	}
+	p.Diff = patch.Normalize(p.Diff, patch.AutoStrip)
+	return p, true
+}
+
+// decodeBody undoes the transfer encoding of a message. The text parts of a
+// multipart message, such as a patch sent as an attachment, are joined.
+func decodeBody(contentType, encoding string, r io.Reader) ([]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		var out bytes.Buffer
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return out.Bytes(), nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if t := part.Header.Get("Content-Type"); t != "" && !strings.HasPrefix(t, "text/") {
+				continue
+			}
+			data, err := decodeBody(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(data)
+			if len(data) > 0 && data[len(data)-1] != '\n' {
+				out.WriteByte('\n')
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+	return io.ReadAll(r)
+}
+
+// splitBody separates the commit message from the diff. The message ends
+// at the "---" line before the diffstat, the diff at the "-- " line that
+// starts the signature.
+func splitBody(body string) (message, diffText string) {
+	lines := strings.SplitAfter(body, "\n")
+	start := -1
+	for i := range lines {
+		if diffStart(lines, i) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return strings.TrimSpace(body), ""
+	}
+
+	// A removed "- " line also reads "-- ", so only the last one counts.
+	end := len(lines)
+	for i := len(lines) - 1; i > start; i-- {
+		if strings.TrimRight(lines[i], "\n") == "-- " {
+			end = i
+			break
+		}
+	}
+
+	msgEnd := start
+	for i := 0; i < start; i++ {
+		if strings.TrimRight(lines[i], "\n") == "---" {
+			msgEnd = i
+			break
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines[:msgEnd], "")), strings.Join(lines[start:end], "")
+}
+
+// diffStart reports whether line i starts a diff: a "diff " command line,
+// or the header of a file of a unified or context diff without one.
+func diffStart(lines []string, i int) bool {
+	if strings.HasPrefix(lines[i], "diff ") {
+		return true
+	}
+	if i+1 == len(lines) {
+		return false
+	}
+	return strings.HasPrefix(lines[i], "--- ") && strings.HasPrefix(lines[i+1], "+++ ") ||
+		strings.HasPrefix(lines[i], "*** ") && strings.HasPrefix(lines[i+1], "--- ")
+}
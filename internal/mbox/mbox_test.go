@@ -0,0 +1,181 @@
+package mbox
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sig is the signature format-patch ends each message with; its "-- "
+// line has a trailing space.
+const sig = "-- \n2.43.0\n"
+
+var series = `From 8f3c1a2b4d5e6f708192a3b4c5d6e7f801234567 Mon Sep 17 00:00:00 2001
+From: Ada Lovelace <ada@example.com>
+Date: Tue, 3 Mar 2026 10:15:00 +0100
+Subject: [PATCH 0/2] Cover letter
+
+Two small fixes.
+
+` + sig + `
+
+From 1111111111111111111111111111111111111111 Mon Sep 17 00:00:00 2001
+From: Ada Lovelace <ada@example.com>
+Date: Tue, 3 Mar 2026 10:15:00 +0100
+Subject: [PATCH 1/2] Fix the greeting
+ that wrapped
+
+The greeting was wrong.
+---
+ hello.txt | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/hello.txt b/hello.txt
+index 1111111..2222222 100644
+--- a/hello.txt
++++ b/hello.txt
+@@ -1,2 +1,2 @@
+` + "-- \n" + `+hello
+ world
+` + sig + `
+
+From 2222222222222222222222222222222222222222 Mon Sep 17 00:00:00 2001
+From: =?UTF-8?q?Ren=C3=A9?= <rene@example.com>
+Date: Wed, 4 Mar 2026 08:00:00 +0000
+Subject: [PATCH v2 2/2] =?UTF-8?q?Add=20caf=C3=A9?=
+Content-Type: text/plain; charset=UTF-8
+Content-Transfer-Encoding: quoted-printable
+
+---
+ cafe.txt | 1 +
+ 1 file changed, 1 insertion(+)
+
+diff --git a/cafe.txt b/cafe.txt
+new file mode 100644
+--- /dev/null
++++ b/cafe.txt
+@@ -0,0 +1 @@
++caf=C3=A9
+` + sig
+
+func TestIsSeries(t *testing.T) {
+	if !IsSeries(series) {
+		t.Error("IsSeries(format-patch output) = false")
+	}
+	if IsSeries("diff --git a/x b/x\n") {
+		t.Error("IsSeries(diff) = true")
+	}
+	if IsSeries("From: someone\n") {
+		t.Error("IsSeries(header) = true")
+	}
+}
+
+func TestParse(t *testing.T) {
+	patches := Parse(series)
+	if len(patches) != 2 {
+		t.Fatalf("Parse() found %d patches, want 2 (cover letter skipped)", len(patches))
+	}
+
+	p := patches[0]
+	if p.Subject != "Fix the greeting that wrapped" {
+		t.Errorf("Subject = %q", p.Subject)
+	}
+	if p.Author != "Ada Lovelace" || p.Date.Day() != 3 {
+		t.Errorf("Author, Date = %q, %v", p.Author, p.Date)
+	}
+	if p.Message != "The greeting was wrong." {
+		t.Errorf("Message = %q", p.Message)
+	}
+	if !strings.HasPrefix(p.Diff, "diff --git a/hello.txt") || !strings.HasSuffix(p.Diff, " world\n") {
+		t.Errorf("Diff = %q", p.Diff)
+	}
+	if !strings.Contains(p.Diff, "\n-- \n+hello") {
+		t.Error("Diff lost a removed \"- \" line mistaken for the signature")
+	}
+
+	p = patches[1]
+	if p.Subject != "Add café" || p.Author != "René" {
+		t.Errorf("Subject, Author = %q, %q", p.Subject, p.Author)
+	}
+	if !strings.Contains(p.Diff, "+café\n") {
+		t.Errorf("Diff not decoded: %q", p.Diff)
+	}
+
+	joined := Join(patches)
+	if strings.Count(joined, "diff --git") != 2 {
+		t.Errorf("Join() = %q", joined)
+	}
+}
+
+func TestJoinByFile(t *testing.T) {
+	section := func(path, change string) string {
+		return "diff --git a/" + path + " b/" + path + "\n--- a/" + path + "\n+++ b/" + path + "\n@@ -1 +1 @@\n" + change + "\n"
+	}
+	patches := []Patch{
+		{Diff: section("a.go", "-1\n+2") + section("b.go", "-x\n+y")},
+		{Diff: section("c.go", "-p\n+q")},
+		{Diff: section("a.go", "-2\n+3")},
+	}
+	want := section("a.go", "-1\n+2") + section("a.go", "-2\n+3") + section("b.go", "-x\n+y") + section("c.go", "-p\n+q")
+	if got := Join(patches); got != want {
+		t.Errorf("Join() = %q, want %q", got, want)
+	}
+	files := Files(patches)
+	if got := files["a.go"]; !slices.Equal(got, []int{1, 3}) {
+		t.Errorf("Files()[a.go] = %v, want [1 3]", got)
+	}
+	if got := files["c.go"]; !slices.Equal(got, []int{2}) {
+		t.Errorf("Files()[c.go] = %v, want [2]", got)
+	}
+}
+
+// TestParseUnified reads a series whose patches are plain unified diffs,
+// which come out in git's format.
+func TestParseUnified(t *testing.T) {
+	text := `From bob@example.com Thu Mar  5 09:00:00 2026
+From: Bob <bob@example.com>
+Subject: [PATCH] tweak
+
+Tweak it.
+---
+--- orig/src/x.c
++++ new/src/x.c
+@@ -1 +1 @@
+-a
++b
+`
+	patches := Parse(text)
+	if len(patches) != 1 {
+		t.Fatalf("Parse() found %d patches, want 1", len(patches))
+	}
+	if p := patches[0]; !strings.HasPrefix(p.Diff, "diff --git a/src/x.c b/src/x.c\n") || p.Message != "Tweak it." {
+		t.Errorf("Parse() = %+v", p)
+	}
+}
+
+func TestParseAttachment(t *testing.T) {
+	text := `From alice@example.com Thu Mar  5 09:00:00 2026
+From: Alice <alice@example.com>
+Subject: Re: [RFC] tweak
+Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+See attached.
+--b
+Content-Type: text/x-patch
+Content-Transfer-Encoding: base64
+
+ZGlmZiAtLWdpdCBhL3ggYi94Ci0tLSBhL3gKKysrIGIveApAQCAtMSArMSBAQAotYQor
+Ygo=
+--b--
+`
+	patches := Parse(text)
+	if len(patches) != 1 {
+		t.Fatalf("Parse() found %d patches, want 1", len(patches))
+	}
+	if patches[0].Subject != "tweak" || !strings.HasSuffix(patches[0].Diff, "-a\n+b\n") {
+		t.Errorf("Parse() = %+v", patches[0])
+	}
+}
@@ -0,0 +1,389 @@
+// Package patch reads diffs that were not produced by git or hg: GNU
+// `diff -u`/`diff -ruN` output, `svn diff` and `p4 diff -du` with their
+// "Index:"/"====" headers, bare "---"/"+++" patches and classic context
+// diffs. Normalize rewrites them as git-style diffs, which is what the rest
+// of difi parses.
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// AutoStrip lets Normalize guess how many leading path components to drop.
+const AutoStrip = -1
+
+// nativeRe matches the file headers of the formats difi reads directly:
+// git, git's combined diffs of merges, and hg ("diff -r <node> path").
+var nativeRe = regexp.MustCompile(`(?m)^(?:diff --git |diff --cc |diff --combined |diff -r [0-9a-f]{12,40} )`)
+
+var (
+	unifiedHunkRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+	contextOldRe  = regexp.MustCompile(`^\*\*\* (\d+)(?:,(\d+))? \*\*\*\*`)
+	contextNewRe  = regexp.MustCompile(`^--- (\d+)(?:,(\d+))? ----`)
+	binaryRe      = regexp.MustCompile(`^Binary files (.+) and (.+) differ$`)
+)
+
+const contextSeparator = "***************"
+
+// File is the part of a patch that changes one file.
+type File struct {
+	// OldPath and NewPath are the stripped paths; one of them is empty
+	// when the file is added or removed.
+	OldPath, NewPath string
+	// Hunks are unified hunks, "@@" header first. Context diff hunks are
+	// converted.
+	Hunks  [][]string
+	Binary bool
+}
+
+// IsNative reports whether text has git or hg file headers, which difi
+// parses without Normalize.
+func IsNative(text string) bool {
+	return nativeRe.MatchString(text)
+}
+
+// Normalize rewrites a unified or context diff as a git-style diff, with a
+// "diff --git" header per file. strip drops that many leading components
+// from each path like patch -p; AutoStrip guesses it. Text that is already
+// a git or hg diff, or that has no recognisable patch, is returned as is.
+func Normalize(text string, strip int) string {
+	if IsNative(text) {
+		return text
+	}
+	files := Parse(text, strip)
+	if len(files) == 0 {
+		return text
+	}
+	var sb strings.Builder
+	for _, f := range files {
+		writeGit(&sb, f)
+	}
+	return sb.String()
+}
+
+// Parse finds the files of a unified or context diff. Lines outside of
+// file sections, such as "Index:" and "Only in" lines or a commit message,
+// are skipped.
+func Parse(text string, strip int) []File {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var files []File
+	for i := 0; i < len(lines); {
+		switch {
+		case isUnifiedStart(lines, i):
+			f := File{}
+			f.OldPath, f.NewPath = headerPaths(lines[i][4:], lines[i+1][4:])
+			i += 2
+			for i < len(lines) && unifiedHunkRe.MatchString(lines[i]) {
+				var hunk []string
+				hunk, i = readUnifiedHunk(lines, i)
+				f.Hunks = append(f.Hunks, hunk)
+			}
+			files = append(files, f)
+		case isContextStart(lines, i):
+			f := File{}
+			f.OldPath, f.NewPath = headerPaths(lines[i][4:], lines[i+1][4:])
+			i += 2
+			for i < len(lines) && lines[i] == contextSeparator {
+				var hunk []string
+				hunk, i = readContextHunk(lines, i+1)
+				if hunk == nil {
+					break
+				}
+				f.Hunks = append(f.Hunks, hunk)
+			}
+			files = append(files, f)
+		default:
+			if m := binaryRe.FindStringSubmatch(lines[i]); m != nil {
+				f := File{Binary: true}
+				f.OldPath, f.NewPath = headerPaths(m[1], m[2])
+				files = append(files, f)
+			}
+			i++
+		}
+	}
+
+	if strip == AutoStrip {
+		strip = guessStrip(files)
+	}
+	for i := range files {
+		files[i].OldPath = Strip(files[i].OldPath, strip)
+		files[i].NewPath = Strip(files[i].NewPath, strip)
+	}
+	return files
+}
+
+func isUnifiedStart(lines []string, i int) bool {
+	return i+2 < len(lines) &&
+		strings.HasPrefix(lines[i], "--- ") &&
+		strings.HasPrefix(lines[i+1], "+++ ") &&
+		unifiedHunkRe.MatchString(lines[i+2])
+}
+
+func isContextStart(lines []string, i int) bool {
+	return i+2 < len(lines) &&
+		strings.HasPrefix(lines[i], "*** ") &&
+		strings.HasPrefix(lines[i+1], "--- ") &&
+		lines[i+2] == contextSeparator
+}
+
+// readUnifiedHunk copies the hunk starting at lines[i], counting lines
+// against its header so that a removed "-- x" line is not taken for the
+// next file's header.
+func readUnifiedHunk(lines []string, i int) ([]string, int) {
+	m := unifiedHunkRe.FindStringSubmatch(lines[i])
+	oldLeft, newLeft := count(m[2]), count(m[4])
+	hunk := []string{lines[i]}
+	i++
+	for i < len(lines) && (oldLeft > 0 || newLeft > 0 || strings.HasPrefix(lines[i], `\`)) {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, `\`):
+		case strings.HasPrefix(line, "-"):
+			oldLeft--
+		case strings.HasPrefix(line, "+"):
+			newLeft--
+		case line == "" || strings.HasPrefix(line, " "):
+			// Some mailers strip the space of empty context lines.
+			if line == "" {
+				line = " "
+			}
+			oldLeft--
+			newLeft--
+		default:
+			return hunk, i
+		}
+		hunk = append(hunk, line)
+		i++
+	}
+	return hunk, i
+}
+
+// count reads the optional length of a unified range, which defaults to 1.
+func count(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+type contextLine struct {
+	op   byte // ' ', '-', '+' or '!'
+	text string
+}
+
+// readContextHunk converts the context hunk whose "*** a,b ****" line is
+// lines[i] into a unified one. It returns nil if lines[i] is not a hunk.
+func readContextHunk(lines []string, i int) ([]string, int) {
+	om := contextOldRe.FindStringSubmatch(safe(lines, i))
+	if om == nil {
+		return nil, i
+	}
+	i++
+	var before, after []contextLine
+	var oldEOL, newEOL string
+	for i < len(lines) && !contextNewRe.MatchString(lines[i]) {
+		if strings.HasPrefix(lines[i], `\`) {
+			oldEOL = lines[i]
+		} else if len(lines[i]) >= 2 {
+			before = append(before, contextLine{lines[i][0], lines[i][2:]})
+		}
+		i++
+	}
+	nm := contextNewRe.FindStringSubmatch(safe(lines, i))
+	if nm == nil {
+		return nil, i
+	}
+	i++
+	for i < len(lines) && lines[i] != contextSeparator && isContextLine(lines[i]) {
+		if strings.HasPrefix(lines[i], `\`) {
+			newEOL = lines[i]
+		} else {
+			after = append(after, contextLine{lines[i][0], lines[i][2:]})
+		}
+		i++
+	}
+
+	var body []string
+	var oldCount, newCount int
+	emit := func(op byte, text string) {
+		body = append(body, string(op)+text)
+		if op != '+' {
+			oldCount++
+		}
+		if op != '-' {
+			newCount++
+		}
+	}
+	o, n := 0, 0
+	for o < len(before) || n < len(after) {
+		switch {
+		case o < len(before) && before[o].op == '-':
+			emit('-', before[o].text)
+			o++
+		case n < len(after) && after[n].op == '+':
+			emit('+', after[n].text)
+			n++
+		case o < len(before) && before[o].op == '!':
+			for ; o < len(before) && before[o].op == '!'; o++ {
+				emit('-', before[o].text)
+			}
+			for ; n < len(after) && after[n].op == '!'; n++ {
+				emit('+', after[n].text)
+			}
+		case n < len(after) && after[n].op == '!':
+			emit('+', after[n].text)
+			n++
+		case o < len(before):
+			// A side made only of context lines is left out of the hunk,
+			// so either side's context will do.
+			emit(' ', before[o].text)
+			o++
+			if n < len(after) {
+				n++
+			}
+		default:
+			emit(' ', after[n].text)
+			n++
+		}
+	}
+	if oldEOL != "" {
+		body = append(body, oldEOL)
+	} else if newEOL != "" {
+		body = append(body, newEOL)
+	}
+
+	oldStart, _ := strconv.Atoi(om[1])
+	newStart, _ := strconv.Atoi(nm[1])
+	header := fmt.Sprintf("@@ -%s +%s @@", unifiedRange(oldStart, oldCount), unifiedRange(newStart, newCount))
+	return append([]string{header}, body...), i
+}
+
+func isContextLine(line string) bool {
+	if strings.HasPrefix(line, `\`) {
+		return true
+	}
+	return len(line) >= 2 && strings.IndexByte(" -+!", line[0]) >= 0 && line[1] == ' '
+}
+
+func safe(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+func unifiedRange(start, length int) string {
+	if length == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+// headerPaths reads the paths of a "---"/"+++" (or "***"/"---") header
+// pair, dropping the timestamp or "(revision N)" after the tab.
+func headerPaths(oldField, newField string) (oldPath, newPath string) {
+	oldPath, oldStamp, _ := strings.Cut(oldField, "\t")
+	newPath, newStamp, _ := strings.Cut(newField, "\t")
+	oldPath = diff.UnquotePath(strings.TrimSpace(oldPath))
+	newPath = diff.UnquotePath(strings.TrimSpace(newPath))
+	if isDevNull(oldPath) || isEpoch(oldStamp) {
+		oldPath = ""
+	}
+	if isDevNull(newPath) || isEpoch(newStamp) {
+		newPath = ""
+	}
+	return oldPath, newPath
+}
+
+func isDevNull(path string) bool {
+	return path == "/dev/null" || path == "NUL"
+}
+
+// isEpoch recognises the timestamp `diff -N` gives a missing file: the Unix
+// epoch, in local time.
+func isEpoch(stamp string) bool {
+	return strings.HasPrefix(stamp, "1970-01-01 ") || strings.HasPrefix(stamp, "1969-12-31 ") ||
+		strings.HasPrefix(stamp, "Thu Jan  1 ") && strings.HasSuffix(stamp, " 1970") ||
+		strings.HasPrefix(stamp, "Wed Dec 31 ") && strings.HasSuffix(stamp, " 1969")
+}
+
+// guessStrip drops the a/ and b/ prefixes of git-style paths, and the
+// differing top directories of `diff -ruN old/ new/`, judging by the first
+// file that has both sides. Anything else is kept whole.
+func guessStrip(files []File) int {
+	for _, f := range files {
+		if f.OldPath == "" || f.NewPath == "" {
+			continue
+		}
+		if strings.HasPrefix(f.OldPath, "a/") && strings.HasPrefix(f.NewPath, "b/") {
+			return 1
+		}
+		oldTop, oldRest, oldOK := strings.Cut(f.OldPath, "/")
+		newTop, newRest, newOK := strings.Cut(f.NewPath, "/")
+		if oldOK && newOK && oldTop != newTop && oldRest == newRest && oldTop != "" {
+			return 1
+		}
+		return 0
+	}
+	// Only added and removed files: look for git's prefixes alone.
+	for _, f := range files {
+		if strings.HasPrefix(f.OldPath, "a/") || strings.HasPrefix(f.NewPath, "b/") {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Strip drops n leading components from path, like patch -pN. The base
+// name is always kept.
+func Strip(path string, n int) string {
+	for ; n > 0; n-- {
+		_, rest, ok := strings.Cut(path, "/")
+		if !ok {
+			break
+		}
+		path = rest
+	}
+	return path
+}
+
+func writeGit(sb *strings.Builder, f File) {
+	oldPath, newPath := f.OldPath, f.NewPath
+	if oldPath == "" {
+		oldPath = newPath
+	}
+	if newPath == "" {
+		newPath = oldPath
+	}
+	fmt.Fprintf(sb, "diff --git %s %s\n", diff.GitName("a/", oldPath), diff.GitName("b/", newPath))
+	switch {
+	case f.OldPath == "":
+		sb.WriteString("new file mode 100644\n")
+	case f.NewPath == "":
+		sb.WriteString("deleted file mode 100644\n")
+	}
+	if f.Binary {
+		fmt.Fprintf(sb, "Binary files %s and %s differ\n", side("a/", f.OldPath), side("b/", f.NewPath))
+		return
+	}
+	fmt.Fprintf(sb, "--- %s\n+++ %s\n", side("a/", f.OldPath), side("b/", f.NewPath))
+	for _, hunk := range f.Hunks {
+		for _, line := range hunk {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+}
+
+func side(prefix, path string) string {
+	if path == "" {
+		return "/dev/null"
+	}
+	return diff.GitName(prefix, path)
+}
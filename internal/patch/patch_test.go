@@ -0,0 +1,165 @@
+package patch
+
+import (
+	"strings"
+	"testing"
+)
+
+// Output of GNU `diff -ruN old new`.
+const gnuRecursive = `diff -ruN old/add.txt new/add.txt
+--- old/add.txt	1970-01-01 00:00:00.000000000 +0000
++++ new/add.txt	2026-10-18 16:10:37.999579961 +0000
+@@ -0,0 +1 @@
++added
+diff -ruN old/rm.txt new/rm.txt
+--- old/rm.txt	2026-10-18 16:10:37.999579961 +0000
++++ new/rm.txt	1970-01-01 00:00:00.000000000 +0000
+@@ -1 +0,0 @@
+-gone
+diff -ruN old/src/x.c new/src/x.c
+--- old/src/x.c	2026-10-18 16:10:37.999579961 +0000
++++ new/src/x.c	2026-10-18 16:10:37.999579961 +0000
+@@ -1,4 +1,5 @@
+ a
+-b
++B
+ c
+ d
++e
+`
+
+func paths(files []File) string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.OldPath+">"+f.NewPath)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestParseGNURecursive(t *testing.T) {
+	files := Parse(gnuRecursive, AutoStrip)
+	if got, want := paths(files), ">add.txt rm.txt> src/x.c>src/x.c"; got != want {
+		t.Errorf("Parse() paths = %q, want %q", got, want)
+	}
+	if got := Parse(gnuRecursive, 0); got[2].NewPath != "new/src/x.c" {
+		t.Errorf("Parse(-p0) = %q, want new/src/x.c", got[2].NewPath)
+	}
+	if len(files[2].Hunks) != 1 || len(files[2].Hunks[0]) != 7 {
+		t.Errorf("Parse() hunks = %q", files[2].Hunks)
+	}
+}
+
+func TestParseSVN(t *testing.T) {
+	text := `Index: trunk/main.c
+===================================================================
+--- trunk/main.c	(revision 41)
++++ trunk/main.c	(working copy)
+@@ -1,2 +1,2 @@
+ int main() {
+--- return 1;
++-- return 0;
+Index: trunk/README
+===================================================================
+--- trunk/README	(revision 41)
++++ trunk/README	(working copy)
+@@ -1 +1 @@
+-old
+\ No newline at end of file
++new
+`
+	files := Parse(text, AutoStrip)
+	if got, want := paths(files), "trunk/main.c>trunk/main.c trunk/README>trunk/README"; got != want {
+		t.Fatalf("Parse() paths = %q, want %q", got, want)
+	}
+	// The removed "-- return 1;" line must not start a new file.
+	if len(files[0].Hunks[0]) != 4 {
+		t.Errorf("hunk = %q", files[0].Hunks[0])
+	}
+	if last := files[1].Hunks[0]; len(last) != 4 || last[2] != `\ No newline at end of file` {
+		t.Errorf("hunk = %q", last)
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	text := `*** old/src/x.c	Sun Oct 18 16:10:37 2026
+--- new/src/x.c	Sun Oct 18 16:10:37 2026
+***************
+*** 1,4 ****
+  a
+! b
+  c
+  d
+--- 1,5 ----
+  a
+! B
+  c
+  d
++ e
+*** /dev/null	Sun Oct 18 15:30:36 2026
+--- new/add.txt	Sun Oct 18 16:10:37 2026
+***************
+*** 0 ****
+--- 1 ----
++ added
+`
+	files := Parse(text, AutoStrip)
+	if got, want := paths(files), "src/x.c>src/x.c >add.txt"; got != want {
+		t.Fatalf("Parse() paths = %q, want %q", got, want)
+	}
+	want := "@@ -1,4 +1,5 @@\n a\n-b\n+B\n c\n d\n+e"
+	if got := strings.Join(files[0].Hunks[0], "\n"); got != want {
+		t.Errorf("context hunk =\n%s\nwant\n%s", got, want)
+	}
+	want = "@@ -0,0 +1 @@\n+added"
+	if got := strings.Join(files[1].Hunks[0], "\n"); got != want {
+		t.Errorf("context hunk =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	bare := "--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@\n-a\n+b\n"
+	got := Normalize(bare, AutoStrip)
+	want := "diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@\n-a\n+b\n"
+	if got != want {
+		t.Errorf("Normalize() =\n%s\nwant\n%s", got, want)
+	}
+
+	got = Normalize(gnuRecursive, AutoStrip)
+	if !strings.Contains(got, "diff --git a/add.txt b/add.txt\nnew file mode 100644\n--- /dev/null\n+++ b/add.txt\n") {
+		t.Errorf("Normalize() =\n%s", got)
+	}
+	if !strings.Contains(got, "diff --git a/rm.txt b/rm.txt\ndeleted file mode 100644\n--- a/rm.txt\n+++ /dev/null\n") {
+		t.Errorf("Normalize() =\n%s", got)
+	}
+
+	if got := Normalize("Binary files old/x.png and new/x.png differ\n", AutoStrip); got != "diff --git a/x.png b/x.png\nBinary files a/x.png and b/x.png differ\n" {
+		t.Errorf("Normalize(binary) = %q", got)
+	}
+
+	git := "diff --git a/x b/x\n--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n"
+	if Normalize(git, 0) != git {
+		t.Error("Normalize() rewrote a git diff")
+	}
+	hg := "diff -r 1234567890ab x\n--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n"
+	if Normalize(hg, 0) != hg {
+		t.Error("Normalize() rewrote an hg diff")
+	}
+}
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		path string
+		n    int
+		want string
+	}{
+		{"a/b/c.go", 0, "a/b/c.go"},
+		{"a/b/c.go", 1, "b/c.go"},
+		{"a/b/c.go", 5, "c.go"},
+		{"/abs/x", 1, "abs/x"},
+	}
+	for _, tt := range tests {
+		if got := Strip(tt.path, tt.n); got != tt.want {
+			t.Errorf("Strip(%q, %d) = %q, want %q", tt.path, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package pathdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/backend"
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// Pair is a comparison between two files or two directories on disk, as
+// handed over by git difftool or hg extdiff.
+type Pair struct {
+	Left  string
+	Right string
+	// Name is the repository path shown for a single-file comparison
+	// (git difftool's $MERGED). It falls back to the base name of Right.
+	Name string
+}
+
+// DiffMsg carries a file's diff, or the error that kept it from loading.
+type DiffMsg struct {
+	Content string
+	Err     error
+}
+
+type EditorFinishedMsg struct{ Err error }
+
+// Validate checks that both sides exist and are of the same kind.
+// os.DevNull stands for a missing side, which is how git difftool passes
+// added and deleted files.
+func (p Pair) Validate() error {
+	left, err := kind(p.Left)
+	if err != nil {
+		return err
+	}
+	right, err := kind(p.Right)
+	if err != nil {
+		return err
+	}
+	if left == kindNone && right == kindNone {
+		return fmt.Errorf("nothing to compare: both sides are %s", os.DevNull)
+	}
+	if left != kindNone && right != kindNone && left != right {
+		return fmt.Errorf("cannot compare a file with a directory: %s, %s", p.Left, p.Right)
+	}
+	return nil
+}
+
+type pathKind int
+
+const (
+	kindNone pathKind = iota
+	kindFile
+	kindDir
+)
+
+func kind(path string) (pathKind, error) {
+	if path == os.DevNull {
+		return kindNone, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return kindNone, err
+	}
+	if info.IsDir() {
+		return kindDir, nil
+	}
+	return kindFile, nil
+}
+
+func (p Pair) isDir() bool {
+	left, _ := kind(p.Left)
+	right, _ := kind(p.Right)
+	return left == kindDir || right == kindDir
+}
+
+func (p Pair) name() string {
+	if p.Name != "" {
+		return filepath.ToSlash(p.Name)
+	}
+	if p.Right != os.DevNull {
+		return filepath.Base(p.Right)
+	}
+	return filepath.Base(p.Left)
+}
+
+// resolve maps a path shown in the tree to the files on each side. A side
+// that does not contain the file is reported as os.DevNull.
+func (p Pair) resolve(path string) (left, right string) {
+	if !p.isDir() {
+		return p.Left, p.Right
+	}
+	left, right = os.DevNull, os.DevNull
+	if p.Left != os.DevNull {
+		if _, err := os.Stat(filepath.Join(p.Left, path)); err == nil {
+			left = filepath.Join(p.Left, path)
+		}
+	}
+	if p.Right != os.DevNull {
+		if _, err := os.Stat(filepath.Join(p.Right, path)); err == nil {
+			right = filepath.Join(p.Right, path)
+		}
+	}
+	return left, right
+}
+
+// ListChangedFiles returns the slash-separated paths that were added,
+// removed or modified between the two sides.
+func (p Pair) ListChangedFiles() ([]string, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if !p.isDir() {
+		same, err := sameContent(p.Left, p.Right)
+		if err != nil {
+			return nil, err
+		}
+		if same {
+			return []string{}, nil
+		}
+		return []string{p.name()}, nil
+	}
+
+	left, err := walk(p.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := walk(p.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for path := range left {
+		seen[path] = true
+	}
+	for path := range right {
+		seen[path] = true
+	}
+
+	files := []string{}
+	for path := range seen {
+		if left[path] && right[path] {
+			same, err := sameContent(filepath.Join(p.Left, path), filepath.Join(p.Right, path))
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+		}
+		files = append(files, filepath.ToSlash(path))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// walk collects the regular files below root, relative to it.
+func walk(root string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	if root == os.DevNull {
+		return files, nil
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = true
+		return nil
+	})
+	return files, err
+}
+
+func sameContent(left, right string) (bool, error) {
+	if left == os.DevNull || right == os.DevNull {
+		return left == right, nil
+	}
+	li, err := os.Stat(left)
+	if err != nil {
+		return false, err
+	}
+	ri, err := os.Stat(right)
+	if err != nil {
+		return false, err
+	}
+	if li.Size() != ri.Size() {
+		return false, nil
+	}
+	a, err := readSide(left)
+	if err != nil {
+		return false, err
+	}
+	b, err := readSide(right)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(a, b), nil
+}
+
+func readSide(path string) ([]byte, error) {
+	if path == os.DevNull {
+		return nil, nil
+	}
+	return os.ReadFile(path)
+}
+
+// sideMode returns git's mode for a side, or nothing for a missing one.
+func sideMode(path string) string {
+	if path == os.DevNull {
+		return ""
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return ""
+	}
+	return diff.Mode(info)
+}
+
+// File loads both sides of path for the diff engine.
+func (p Pair) File(path string) (diff.File, error) {
+	leftPath, rightPath := p.resolve(path)
+	a, err := readSide(leftPath)
+	if err != nil {
+		return diff.File{}, err
+	}
+	b, err := readSide(rightPath)
+	if err != nil {
+		return diff.File{}, err
+	}
+	return diff.File{
+		Path:       path,
+		Old:        a,
+		New:        b,
+		OldMissing: leftPath == os.DevNull,
+		NewMissing: rightPath == os.DevNull,
+		OldMode:    sideMode(leftPath),
+		NewMode:    sideMode(rightPath),
+	}, nil
+}
+
+// FileDiff renders a git-style diff for one path so the rest of difi can
+// treat it like `git diff` output.
+func (p Pair) FileDiff(path string, opts diff.Options) (string, error) {
+	f, err := p.File(path)
+	if err != nil {
+		return "", err
+	}
+	return diff.Render(f, opts), nil
+}
+
+func (p Pair) DiffCmd(path string, opts diff.Options) tea.Cmd {
+	return func() tea.Msg {
+		out, err := p.FileDiff(path, opts)
+		if err != nil {
+			return DiffMsg{Err: err}
+		}
+		return DiffMsg{Content: out}
+	}
+}
+
+// Stats counts the changes of every file. Like git, it leaves out of
+// ByFile the text files whose changes are all ignored by opts. Binary files
+// are those whose contents look binary.
+func (p Pair) Stats(opts diff.Options) (diff.Summary, error) {
+	files, err := p.ListChangedFiles()
+	if err != nil {
+		return diff.Summary{}, fmt.Errorf("path diff stats error: %w", err)
+	}
+	s := diff.Summary{ByFile: make(map[string][2]int), Binary: make(map[string]bool)}
+	for _, path := range files {
+		f, err := p.File(path)
+		if err != nil {
+			return diff.Summary{}, err
+		}
+		binary := diff.IsBinary(f.Old) || diff.IsBinary(f.New)
+		if binary {
+			s.Binary[path] = true
+		}
+		added, deleted := f.Stats(opts)
+		if added == 0 && deleted == 0 && opts.IgnoresWhitespace() && !binary {
+			continue
+		}
+		s.ByFile[path] = [2]int{added, deleted}
+		s.Added += added
+		s.Deleted += deleted
+	}
+	return s, nil
+}
+
+// OpenEditorCmd opens the file the comparison is about. For git difftool
+// that is $MERGED, the real working tree file; otherwise the right side,
+// which is the newer version of the file.
+func (p Pair) OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	file := p.Name
+	if _, err := os.Stat(file); file == "" || p.isDir() || err != nil {
+		_, file = p.resolve(path)
+	}
+	if file == os.DevNull {
+		return func() tea.Msg {
+			return EditorFinishedMsg{Err: errors.New(path + " does not exist on the right side")}
+		}
+	}
+
+	c := backend.EditorCmd("", file, lineNumber, targetBranch, editor)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return EditorFinishedMsg{Err: err}
+	})
+}
@@ -0,0 +1,125 @@
+package pathdiff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestListChangedFilesDirectories(t *testing.T) {
+	left, right := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(left, "same.txt"), "same\n")
+	writeFile(t, filepath.Join(right, "same.txt"), "same\n")
+	writeFile(t, filepath.Join(left, "src", "main.go"), "package main\n")
+	writeFile(t, filepath.Join(right, "src", "main.go"), "package app\n")
+	writeFile(t, filepath.Join(left, "removed.txt"), "bye\n")
+	writeFile(t, filepath.Join(right, "docs", "added.md"), "hi\n")
+
+	files, err := Pair{Left: left, Right: right}.ListChangedFiles()
+	if err != nil {
+		t.Fatalf("ListChangedFiles() error: %v", err)
+	}
+
+	expected := []string{"docs/added.md", "removed.txt", "src/main.go"}
+	if strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("ListChangedFiles() = %v, want %v", files, expected)
+	}
+}
+
+func TestListChangedFilesSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "local_main.go")
+	remote := filepath.Join(dir, "remote_main.go")
+	writeFile(t, local, "a\n")
+	writeFile(t, remote, "b\n")
+
+	files, err := Pair{Left: local, Right: remote, Name: "cmd/main.go"}.ListChangedFiles()
+	if err != nil {
+		t.Fatalf("ListChangedFiles() error: %v", err)
+	}
+	if len(files) != 1 || files[0] != "cmd/main.go" {
+		t.Errorf("ListChangedFiles() = %v, want [cmd/main.go]", files)
+	}
+}
+
+func TestFileDiffAddedFromDevNull(t *testing.T) {
+	remote := filepath.Join(t.TempDir(), "new.txt")
+	writeFile(t, remote, "one\ntwo\n")
+
+	p := Pair{Left: os.DevNull, Right: remote, Name: "new.txt"}
+	out, err := p.FileDiff("new.txt", diff.Options{})
+	if err != nil {
+		t.Fatalf("FileDiff() error: %v", err)
+	}
+
+	expected := `diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++one
++two
+`
+	if out != expected {
+		t.Errorf("FileDiff():\nGot:\n%s\nWant:\n%s", out, expected)
+	}
+
+	// The header carries the file's own mode.
+	if err := os.Chmod(remote, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := p.FileDiff("new.txt", diff.Options{}); !strings.Contains(out, "\nnew file mode 100755\n") {
+		t.Errorf("FileDiff() of an executable:\n%s", out)
+	}
+
+	s, err := p.Stats(diff.Options{})
+	if err != nil {
+		t.Fatalf("Stats() error: %v", err)
+	}
+	if s.ByFile["new.txt"] != [2]int{2, 0} {
+		t.Errorf("Stats().ByFile[new.txt] = %v, want [2 0]", s.ByFile["new.txt"])
+	}
+}
+
+func TestFileDiffBinary(t *testing.T) {
+	left, right := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(left, "blob.bin"), "\x00\x01")
+	writeFile(t, filepath.Join(right, "blob.bin"), "\x00\x02")
+
+	out, err := Pair{Left: left, Right: right}.FileDiff("blob.bin", diff.Options{})
+	if err != nil {
+		t.Fatalf("FileDiff() error: %v", err)
+	}
+	if !strings.Contains(out, "Binary files a/blob.bin and b/blob.bin differ") {
+		t.Errorf("FileDiff() = %q, want binary marker", out)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "f")
+	writeFile(t, file, "x")
+
+	if err := (Pair{Left: dir, Right: file}).Validate(); err == nil {
+		t.Error("Validate() should reject comparing a directory with a file")
+	}
+	if err := (Pair{Left: os.DevNull, Right: os.DevNull}).Validate(); err == nil {
+		t.Error("Validate() should reject two missing sides")
+	}
+	if err := (Pair{Left: filepath.Join(dir, "missing"), Right: file}).Validate(); err == nil {
+		t.Error("Validate() should reject a nonexistent path")
+	}
+}
@@ -0,0 +1,95 @@
+// Package pipe takes in a diff piped to difi while the producer is still
+// writing it. Each file's section is stored once, in arrival order, and
+// looked up by byte offset when the file is shown.
+package pipe
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/mbox"
+	"github.com/oug-t/difi/internal/patch"
+)
+
+// Sniff reads r up to the first file header to tell whether the diff can
+// be shown while it is still arriving, which git and hg diffs can. Other
+// formats are rewritten by patch.Normalize and mbox series are split into
+// patches, both of which need all of the input. head is what was read; the
+// rest of the input follows from rest.
+func Sniff(r io.Reader) (head string, rest io.Reader, ok bool) {
+	br := bufio.NewReader(r)
+	var sb strings.Builder
+	seenText := false
+	for {
+		line, err := br.ReadString('\n')
+		sb.WriteString(line)
+		clean := diff.StripANSI(strings.TrimRight(line, "\r\n"))
+		if !seenText && strings.TrimSpace(clean) != "" {
+			seenText = true
+			if mbox.IsSeries(clean) {
+				return sb.String(), br, false
+			}
+		}
+		switch {
+		case patch.IsNative(clean):
+			return sb.String(), br, true
+		case strings.HasPrefix(clean, "--- "), strings.HasPrefix(clean, "*** "):
+			// A unified or context diff's first header.
+			return sb.String(), br, false
+		}
+		if err != nil {
+			return sb.String(), br, false
+		}
+	}
+}
+
+// Diff is a piped diff as far as it has arrived. It is safe for concurrent
+// use, so the UI can show files while more are read.
+type Diff struct {
+	r io.Reader
+
+	mu    sync.RWMutex
+	data  []byte
+	spans map[string][]span // where each path's sections are in data
+}
+
+type span struct {
+	start, end int
+}
+
+// New returns a Diff that reads r when Read is called.
+func New(r io.Reader) *Diff {
+	return &Diff{r: r, spans: make(map[string][]span)}
+}
+
+// Read reads the diff to the end, storing each file's section and then
+// passing it to fn. It stops at the first error from fn.
+func (d *Diff) Read(fn func(diff.Section) error) error {
+	return diff.ReadSections(d.r, func(s diff.Section) error {
+		d.add(s)
+		return fn(s)
+	})
+}
+
+func (d *Diff) add(s diff.Section) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	start := len(d.data)
+	d.data = append(d.data, s.Text...)
+	// A path is in several sections when a log touches it repeatedly.
+	d.spans[s.Path] = append(d.spans[s.Path], span{start, len(d.data)})
+}
+
+// File returns the diff of path: its sections as read, joined.
+func (d *Diff) File(path string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var sb strings.Builder
+	for _, sp := range d.spans[path] {
+		sb.Write(d.data[sp.start:sp.end])
+	}
+	return sb.String()
+}
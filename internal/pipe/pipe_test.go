@@ -0,0 +1,68 @@
+package pipe
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		ok    bool
+	}{
+		{"git", "diff --git a/a b/a\n--- a/a\n+++ b/a\n", true},
+		{"git show", "commit 0123\nAuthor: A\n\n    msg\n\ndiff --git a/a b/a\n", true},
+		{"colored", "\x1b[1mdiff --git a/a b/a\x1b[m\n", true},
+		{"hg", "diff -r 0123456789ab a\n", true},
+		{"unified", "--- a.orig\n+++ a\n@@ -1 +1 @@\n", false},
+		{"context", "*** a.orig\n--- a\n", false},
+		{"mbox", "From 0123456789abcdef0123456789abcdef01234567 Mon Sep 17 00:00:00 2001\nSubject: x\n\ndiff --git a/a b/a\n", false},
+		{"nothing", "hello\n", false},
+	}
+	for _, tt := range tests {
+		head, rest, ok := Sniff(strings.NewReader(tt.input + "tail\n"))
+		if ok != tt.ok {
+			t.Errorf("%s: Sniff() ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+		all, _ := io.ReadAll(rest)
+		if head+string(all) != tt.input+"tail\n" {
+			t.Errorf("%s: head + rest = %q, want the whole input", tt.name, head+string(all))
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	input := "commit 1\n\n" +
+		"diff --git a/a.go b/a.go\n@@ -1 +1 @@\n-x\n+y\n" +
+		"diff --git a/b.go b/b.go\n@@ -1 +1 @@\n-p\n+q\n" +
+		"diff --git a/a.go b/a.go\n@@ -2 +2 @@\n-z\n+w\n"
+	d := New(strings.NewReader(input))
+
+	var files []string
+	err := d.Read(func(s diff.Section) error {
+		files = append(files, s.Path)
+		// Each section can be shown as soon as it is passed on.
+		if got := d.File(s.Path); !strings.HasSuffix(got, s.Text) {
+			t.Errorf("File(%s) = %q while reading, want it to end with %q", s.Path, got, s.Text)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if strings.Join(files, " ") != "a.go b.go a.go" {
+		t.Errorf("Read() passed %v", files)
+	}
+	want := "diff --git a/a.go b/a.go\n@@ -1 +1 @@\n-x\n+y\n" +
+		"diff --git a/a.go b/a.go\n@@ -2 +2 @@\n-z\n+w\n"
+	if got := d.File("a.go"); got != want {
+		t.Errorf("File(a.go) = %q, want %q", got, want)
+	}
+	if got := d.File("missing.go"); got != "" {
+		t.Errorf("File(missing.go) = %q, want empty", got)
+	}
+}
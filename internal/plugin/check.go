@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// maxCheckedDiffs caps how many files Check asks diffs for.
+const maxCheckedDiffs = 20
+
+// Result is the outcome of checking one operation.
+type Result struct {
+	Op  string
+	Err error
+	// Skipped marks an optional operation the plugin did not answer.
+	Skipped bool
+}
+
+// Check runs every operation of the protocol against p in its directory
+// and validates the responses. It is the reference harness for plugin
+// authors, run by `difi --check-plugin NAME` inside a repository with
+// changes.
+func Check(p Plugin, target string) []Result {
+	var results []Result
+	add := func(op string, err error) {
+		results = append(results, Result{Op: op, Err: err})
+	}
+
+	resp, err := p.Call(Request{Op: "detect"})
+	switch {
+	case err != nil:
+		add("detect", err)
+	case !resp.Detected:
+		add("detect", fmt.Errorf("no repository detected in %s", p.Dir))
+	default:
+		add("detect", checkRoot(resp.Root))
+		if resp.Root != "" {
+			p.Root = resp.Root
+		}
+		if target == "" {
+			target = resp.DefaultTarget
+		}
+	}
+
+	resp, err = p.Call(Request{Op: "branch"})
+	if err == nil && resp.Branch == "" {
+		err = fmt.Errorf("empty branch")
+	}
+	add("branch", err)
+
+	opts := options(diff.Options{})
+	resp, err = p.Call(Request{Op: "files", Target: target, Options: opts})
+	files := resp.Files
+	if err == nil {
+		err = checkFiles(files, resp.Renames)
+	}
+	add("files", err)
+
+	add("diff", checkDiffs(p, target, files, resp.Renames))
+
+	resp, err = p.Call(Request{Op: "stats", Target: target, Options: opts})
+	if err == nil {
+		err = checkStats(files, resp.Stats, resp.Binary)
+	}
+	add("stats", err)
+
+	if len(files) > 0 {
+		resp, err = p.Call(Request{Op: "contents", Target: target, Path: files[0]})
+		if err == nil && resp.OldMissing && resp.NewMissing {
+			err = fmt.Errorf("%s: both sides missing", files[0])
+		}
+		results = append(results, Result{Op: "contents", Err: err, Skipped: err != nil})
+
+		resp, err = p.Call(Request{Op: "editor", Path: files[0], Line: 1})
+		if err == nil && resp.Path == "" {
+			err = fmt.Errorf("%s: empty path", files[0])
+		}
+		results = append(results, Result{Op: "editor", Err: err, Skipped: err != nil})
+	}
+
+	// Plugins must refuse operations they do not know, so that new ones
+	// fall back instead of being answered with empty responses.
+	_, err = p.Call(Request{Op: "difi-check-unknown"})
+	if err == nil {
+		add("unknown", fmt.Errorf("an unknown operation was not rejected"))
+	} else {
+		add("unknown", nil)
+	}
+	return results
+}
+
+func checkRoot(root string) error {
+	if root == "" {
+		return nil
+	}
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("root %q is not absolute", root)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return fmt.Errorf("root %q is not a directory", root)
+	}
+	return nil
+}
+
+// checkPath validates a repository path: relative, slash-separated and
+// inside the root.
+func checkPath(path string) error {
+	switch {
+	case path == "":
+		return fmt.Errorf("empty path")
+	case strings.HasPrefix(path, "/") || filepath.IsAbs(path):
+		return fmt.Errorf("%q is absolute", path)
+	case strings.Contains(path, `\`):
+		return fmt.Errorf("%q is not slash-separated", path)
+	case path == ".." || strings.HasPrefix(path, "../") || strings.Contains(path, "/../"):
+		return fmt.Errorf("%q leaves the root", path)
+	}
+	return nil
+}
+
+func checkFiles(files []string, renames map[string]Rename) error {
+	seen := make(map[string]bool, len(files))
+	for _, f := range files {
+		if err := checkPath(f); err != nil {
+			return err
+		}
+		if seen[f] {
+			return fmt.Errorf("%q listed twice", f)
+		}
+		seen[f] = true
+	}
+	for path, r := range renames {
+		if !seen[path] {
+			return fmt.Errorf("rename of %q, which is not listed", path)
+		}
+		if err := checkPath(r.From); err != nil {
+			return fmt.Errorf("rename of %q: %w", path, err)
+		}
+		if r.Similarity < 0 || r.Similarity > 100 {
+			return fmt.Errorf("rename of %q: similarity %d", path, r.Similarity)
+		}
+	}
+	return nil
+}
+
+// checkDiffs asks for the diff of each file. A diff must hold hunks or a
+// binary marker, and any git-style headers in it must name the file.
+func checkDiffs(p Plugin, target string, files []string, renames map[string]Rename) error {
+	for i, f := range files {
+		if i == maxCheckedDiffs {
+			break
+		}
+		resp, err := p.Call(Request{Op: "diff", Target: target, Path: f, OldPath: renames[f].From, Options: options(diff.Options{})})
+		if err != nil {
+			return err
+		}
+		text := resp.Diff
+		if text == "" || diff.IsBinaryDiff(text) {
+			continue
+		}
+		if !strings.Contains(text, "\n@@ ") && !strings.HasPrefix(text, "@@ ") {
+			return fmt.Errorf("%s: no hunks in diff", f)
+		}
+		lines := strings.Split(text, "\n")
+		for j := range lines {
+			if path, ok := diff.SectionPath(lines, j); ok && path != f {
+				return fmt.Errorf("%s: diff has a section for %q", f, path)
+			}
+		}
+	}
+	return nil
+}
+
+func checkStats(files []string, stats map[string][2]int, binary []string) error {
+	listed := make(map[string]bool, len(files))
+	for _, f := range files {
+		listed[f] = true
+	}
+	for path, s := range stats {
+		if !listed[path] {
+			return fmt.Errorf("stats for %q, which is not listed", path)
+		}
+		if s[0] < 0 || s[1] < 0 {
+			return fmt.Errorf("%s: negative counts %v", path, s)
+		}
+	}
+	for _, path := range binary {
+		if !listed[path] {
+			return fmt.Errorf("binary %q is not listed", path)
+		}
+	}
+	return nil
+}
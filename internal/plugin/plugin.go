@@ -0,0 +1,450 @@
+// Package plugin runs external VCS backends. A plugin is an executable named
+// difi-vcs-<name> on PATH. For each operation difi runs it once with the
+// operation as its only argument, writes a Request as JSON to its stdin and
+// reads a Response as JSON from its stdout. A plugin reports failures in
+// the response's "error" field, or by exiting non-zero with a message on
+// stderr.
+//
+// Operations, and the response fields they fill:
+//
+//	detect    detected, root, default_target, capabilities: whether dir is
+//	          in a repository, and what the backend offers
+//	branch    branch, repo_name
+//	files     files, renames: the files changed against target
+//	diff      diff: the unified diff of path (old_path for renames)
+//	stats     stats, binary: per-file added/deleted line counts
+//	contents  old, new, old_missing, new_missing: both versions of path
+//	editor    path, line: the file and line to open for path at line
+//
+// contents and editor are optional; a plugin answers operations it does
+// not know with an error, so difi can add operations later. Paths are
+// slash-separated and relative to the repository root. branch, files and
+// stats run once per refresh, however many of their fields difi reads.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/backend"
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// ProtocolVersion is sent in every request. It is raised when a change
+// would break existing plugins.
+const ProtocolVersion = 1
+
+// Prefix is the executable name prefix that marks a plugin.
+const Prefix = "difi-vcs-"
+
+// detectTimeout bounds the detect call, which runs for every installed
+// plugin when difi starts outside a known repository.
+const detectTimeout = 2 * time.Second
+
+// Request is what difi writes to a plugin's stdin.
+type Request struct {
+	Version int    `json:"version"`
+	Op      string `json:"op"`
+	// Dir is the directory difi was started in.
+	Dir     string   `json:"dir"`
+	Target  string   `json:"target,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	OldPath string   `json:"old_path,omitempty"`
+	Line    int      `json:"line,omitempty"`
+	Options *Options `json:"options,omitempty"`
+}
+
+// Options mirrors diff.Options for the diff and stats operations. Plugins
+// may ignore what their VCS cannot do.
+type Options struct {
+	Algorithm         string `json:"algorithm"`
+	Context           int    `json:"context,omitempty"`
+	IgnoreAllSpace    bool   `json:"ignore_all_space,omitempty"`
+	IgnoreSpaceChange bool   `json:"ignore_space_change,omitempty"`
+	IgnoreBlankLines  bool   `json:"ignore_blank_lines,omitempty"`
+	IgnoreCRAtEOL     bool   `json:"ignore_cr_at_eol,omitempty"`
+	RenameThreshold   int    `json:"rename_threshold,omitempty"`
+	FindCopies        bool   `json:"find_copies,omitempty"`
+}
+
+// Rename describes where a file in a files response came from.
+type Rename struct {
+	From       string `json:"from"`
+	Similarity int    `json:"similarity,omitempty"`
+	Copy       bool   `json:"copy,omitempty"`
+}
+
+// Response is what a plugin writes to its stdout. Only the fields of the
+// operation asked for are read.
+type Response struct {
+	Error string `json:"error,omitempty"`
+
+	Detected      bool     `json:"detected,omitempty"`
+	Root          string   `json:"root,omitempty"`
+	DefaultTarget string   `json:"default_target,omitempty"`
+	Capabilities  []string `json:"capabilities,omitempty"`
+
+	Branch   string `json:"branch,omitempty"`
+	RepoName string `json:"repo_name,omitempty"`
+
+	Files   []string          `json:"files,omitempty"`
+	Renames map[string]Rename `json:"renames,omitempty"`
+
+	Diff string `json:"diff,omitempty"`
+
+	Stats  map[string][2]int `json:"stats,omitempty"`
+	Binary []string          `json:"binary,omitempty"`
+
+	// Old and New are base64 encoded, as encoding/json does for []byte.
+	Old        []byte `json:"old,omitempty"`
+	New        []byte `json:"new,omitempty"`
+	OldMissing bool   `json:"old_missing,omitempty"`
+	NewMissing bool   `json:"new_missing,omitempty"`
+
+	Path string `json:"path,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Plugin is an installed plugin, bound to the directory difi runs in.
+type Plugin struct {
+	Name string
+	Path string
+	Dir  string
+	// Root, DefaultTarget and Capabilities come from the detect call.
+	Root          string
+	DefaultTarget string
+	Capabilities  []string
+
+	// responses is shared by the copies of the plugin; see cached.
+	responses *responses
+}
+
+// responses keeps the answers of the operations several methods read, so
+// that a refresh runs each of them once: branch for GetCurrentBranch and
+// GetRepoName, and files for ListChangedFiles and RenamesByFile. The first
+// method of each group starts a refresh and asks the plugin again; the
+// other reuses its answer for the same target and options.
+type responses struct {
+	mu sync.Mutex
+	m  map[responseKey]Response
+}
+
+type responseKey struct {
+	op, target string
+	opts       Options
+}
+
+// cached runs req, or returns the answer kept for it when fresh is false.
+// Plugins built without Lookup or Detect keep nothing.
+func (p Plugin) cached(ctx context.Context, req Request, fresh bool) (Response, error) {
+	if p.responses == nil {
+		return p.call(ctx, req)
+	}
+	key := responseKey{op: req.Op, target: req.Target}
+	if req.Options != nil {
+		key.opts = *req.Options
+	}
+	r := p.responses
+	if !fresh {
+		r.mu.Lock()
+		resp, ok := r.m[key]
+		r.mu.Unlock()
+		if ok {
+			return resp, nil
+		}
+	}
+	resp, err := p.call(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	r.mu.Lock()
+	if r.m == nil {
+		r.m = make(map[responseKey]Response)
+	}
+	r.m[key] = resp
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// DiffMsg carries a file's diff, or the error that kept it from loading.
+type DiffMsg struct {
+	Content string
+	Err     error
+}
+
+type EditorFinishedMsg struct{ Err error }
+
+// Installed lists the plugins on PATH by name. When several directories
+// hold the same name, the first wins, as it would for exec.LookPath.
+func Installed() map[string]string {
+	found := make(map[string]string)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := pluginName(e.Name())
+			if !ok || found[name] != "" {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if isExecutable(path) {
+				found[name] = path
+			}
+		}
+	}
+	return found
+}
+
+func pluginName(file string) (string, bool) {
+	name, ok := strings.CutPrefix(file, Prefix)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name, ok && name != ""
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode()&0111 != 0
+}
+
+// Lookup finds the plugin called name for dir. A plugin that does not
+// detect a repository is still returned, rooted at dir, so that --vcs can
+// force it.
+func Lookup(name, dir string) (Plugin, bool) {
+	path, err := exec.LookPath(Prefix + name)
+	if err != nil {
+		return Plugin{}, false
+	}
+	p := Plugin{Name: name, Path: path, Dir: dir, Root: dir, responses: &responses{}}
+	if detected, ok := p.detect(); ok {
+		p = detected
+	}
+	return p, true
+}
+
+// Detect asks every installed plugin, in name order, whether dir is in one
+// of its repositories, and returns the first that says so.
+func Detect(dir string) (Plugin, bool) {
+	installed := Installed()
+	names := make([]string, 0, len(installed))
+	for name := range installed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := Plugin{Name: name, Path: installed[name], Dir: dir, Root: dir, responses: &responses{}}
+		if detected, ok := p.detect(); ok {
+			return detected, true
+		}
+	}
+	return Plugin{}, false
+}
+
+func (p Plugin) detect() (Plugin, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), detectTimeout)
+	defer cancel()
+	resp, err := p.call(ctx, Request{Op: "detect"})
+	if err != nil || !resp.Detected {
+		return Plugin{}, false
+	}
+	if resp.Root != "" {
+		p.Root = filepath.Clean(resp.Root)
+	}
+	p.DefaultTarget = resp.DefaultTarget
+	p.Capabilities = resp.Capabilities
+	return p, true
+}
+
+// Call runs one operation. Dir and Version are filled in.
+func (p Plugin) Call(req Request) (Response, error) {
+	return p.call(context.Background(), req)
+}
+
+func (p Plugin) call(ctx context.Context, req Request) (Response, error) {
+	req.Version = ProtocolVersion
+	if req.Dir == "" {
+		req.Dir = p.Dir
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Response{}, err
+	}
+
+	cmd := exec.CommandContext(ctx, p.Path, req.Op)
+	cmd.Dir = p.Dir
+	cmd.Stdin = bytes.NewReader(body)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Response{}, fmt.Errorf("%s%s %s: %s", Prefix, p.Name, req.Op, msg)
+		}
+		return Response{}, fmt.Errorf("%s%s %s: %w", Prefix, p.Name, req.Op, err)
+	}
+
+	var resp Response
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return Response{}, fmt.Errorf("%s%s %s: invalid response: %w", Prefix, p.Name, req.Op, err)
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("%s%s %s: %s", Prefix, p.Name, req.Op, resp.Error)
+	}
+	return resp, nil
+}
+
+func options(opts diff.Options) *Options {
+	return &Options{
+		Algorithm:         opts.Algorithm.String(),
+		Context:           opts.Context,
+		IgnoreAllSpace:    opts.IgnoreAllSpace,
+		IgnoreSpaceChange: opts.IgnoreSpaceChange,
+		IgnoreBlankLines:  opts.IgnoreBlankLines,
+		IgnoreCRAtEOL:     opts.IgnoreCRAtEOL,
+		RenameThreshold:   opts.RenameThreshold,
+		FindCopies:        opts.FindCopies,
+	}
+}
+
+func (p Plugin) GetCurrentBranch() string {
+	resp, err := p.cached(context.Background(), Request{Op: "branch"}, true)
+	if err != nil || resp.Branch == "" {
+		return p.Name
+	}
+	return resp.Branch
+}
+
+func (p Plugin) GetRepoName() string {
+	resp, err := p.cached(context.Background(), Request{Op: "branch"}, false)
+	if err == nil && resp.RepoName != "" {
+		return resp.RepoName
+	}
+	return filepath.Base(p.Root)
+}
+
+func (p Plugin) files(ctx context.Context, targetBranch string, opts diff.Options, fresh bool) (Response, error) {
+	return p.cached(ctx, Request{Op: "files", Target: targetBranch, Options: options(opts)}, fresh)
+}
+
+func (p Plugin) ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	resp, err := p.files(ctx, targetBranch, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Files == nil {
+		return []string{}, nil
+	}
+	return resp.Files, nil
+}
+
+func (p Plugin) RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	resp, err := p.files(ctx, targetBranch, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	renames := make(map[string]diff.Rename, len(resp.Renames))
+	for path, r := range resp.Renames {
+		renames[path] = diff.Rename{From: r.From, Similarity: r.Similarity, Copy: r.Copy}
+	}
+	return renames, nil
+}
+
+// DiffCmd asks the plugin for the diff of path. Word highlighting and the
+// builtin engine diff the plugin's contents in-process instead.
+func (p Plugin) DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	return func() tea.Msg {
+		if opts.NeedsBuiltin() {
+			f, err := p.FileContents(ctx, targetBranch, path, oldPath)
+			if err != nil {
+				return DiffMsg{Err: err}
+			}
+			return DiffMsg{Content: diff.Render(f, opts)}
+		}
+
+		resp, err := p.call(ctx, Request{Op: "diff", Target: targetBranch, Path: path, OldPath: oldPath, Options: options(opts)})
+		if err != nil {
+			return DiffMsg{Err: err}
+		}
+		return DiffMsg{Content: resp.Diff}
+	}
+}
+
+// Stats asks the plugin for the line counts and binary files once.
+func (p Plugin) Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	resp, err := p.call(ctx, Request{Op: "stats", Target: targetBranch, Options: options(opts)})
+	if err != nil {
+		return diff.Summary{}, err
+	}
+	s := diff.Summary{ByFile: resp.Stats, Binary: make(map[string]bool, len(resp.Binary))}
+	if s.ByFile == nil {
+		s.ByFile = map[string][2]int{}
+	}
+	s.Added, s.Deleted = backend.Totals(s.ByFile)
+	for _, path := range resp.Binary {
+		s.Binary[path] = true
+	}
+	return s, nil
+}
+
+// FileContents loads both versions of path with the optional contents
+// operation.
+func (p Plugin) FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	resp, err := p.call(ctx, Request{Op: "contents", Target: targetBranch, Path: path, OldPath: oldPath})
+	if err != nil {
+		return diff.File{}, err
+	}
+	if oldPath == "" {
+		oldPath = path
+	}
+	return diff.File{
+		Path: path, OldPath: oldPath,
+		Old: resp.Old, New: resp.New,
+		OldMissing: resp.OldMissing, NewMissing: resp.NewMissing,
+	}, nil
+}
+
+// WorkingFile returns where a repository path lives under the root.
+func (p Plugin) WorkingFile(path string) string {
+	return filepath.Join(p.Root, path)
+}
+
+// EditorTarget resolves the file and line to open for path. Without the
+// optional editor operation it is path under the root, at the same line.
+func (p Plugin) EditorTarget(path string, lineNumber int) (string, int) {
+	resp, err := p.Call(Request{Op: "editor", Path: path, Line: lineNumber})
+	if err != nil || resp.Path == "" {
+		return filepath.Join(p.Root, filepath.FromSlash(path)), lineNumber
+	}
+	if !filepath.IsAbs(resp.Path) {
+		resp.Path = filepath.Join(p.Root, filepath.FromSlash(resp.Path))
+	}
+	if resp.Line <= 0 {
+		return resp.Path, lineNumber
+	}
+	return resp.Path, resp.Line
+}
+
+func (p Plugin) OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	file, line := p.EditorTarget(path, lineNumber)
+	c := backend.EditorCmd(p.Root, file, line, targetBranch, editor)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return EditorFinishedMsg{Err: err}
+	})
+}
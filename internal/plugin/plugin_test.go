@@ -0,0 +1,236 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// fakeEnv makes the test binary act as the difi-vcs-fake plugin, in the
+// mode it holds: "good" follows the protocol, "bad" breaks it.
+const fakeEnv = "DIFI_FAKE_PLUGIN"
+
+// fakeLogEnv names a file the fake plugin appends each operation it runs
+// to.
+const fakeLogEnv = "DIFI_FAKE_PLUGIN_LOG"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(fakeEnv); mode != "" {
+		os.Exit(fakePlugin(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// fakePlugin serves one request for a repository marked by a .fake file,
+// with a.txt modified and b.txt renamed from old.txt.
+func fakePlugin(mode string) int {
+	var req Request
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil || req.Op != os.Args[1] {
+		os.Stderr.WriteString("bad request\n")
+		return 2
+	}
+	if log := os.Getenv(fakeLogEnv); log != "" {
+		if f, err := os.OpenFile(log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+			f.WriteString(req.Op + "\n")
+			f.Close()
+		}
+	}
+
+	var resp Response
+	switch req.Op {
+	case "detect":
+		_, err := os.Stat(filepath.Join(req.Dir, ".fake"))
+		resp.Detected = err == nil
+		resp.Root = req.Dir
+		resp.DefaultTarget = "trunk"
+		resp.Capabilities = []string{"commits"}
+	case "branch":
+		resp.Branch = "main"
+	case "files":
+		resp.Files = []string{"a.txt", "b.txt"}
+		resp.Renames = map[string]Rename{"b.txt": {From: "old.txt", Similarity: 90}}
+		if mode == "bad" {
+			resp.Files = append(resp.Files, "/etc/passwd")
+		}
+	case "diff":
+		resp.Diff = "@@ -1 +1 @@\n-old " + req.Path + "\n+new " + req.Path + "\n"
+		if req.Options.IgnoreAllSpace {
+			resp.Diff = ""
+		}
+	case "stats":
+		resp.Stats = map[string][2]int{"a.txt": {1, 1}, "b.txt": {1, 1}}
+	case "contents":
+		resp.Old, resp.New = []byte("old\n"), []byte("new\n")
+	case "editor":
+		// Only a.txt moves lines; b.txt answers with a path alone.
+		resp.Path = "src/" + req.Path
+		if req.Path == "a.txt" {
+			resp.Line = req.Line + 1
+		}
+	default:
+		if mode == "good" {
+			resp.Error = "unknown operation " + req.Op
+		}
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(resp); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// install puts the test binary on PATH as difi-vcs-fake, acting in mode,
+// and returns a repository directory for it.
+func install(t *testing.T, mode string) string {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := t.TempDir()
+	if err := os.Symlink(exe, filepath.Join(bin, Prefix+"fake")); err != nil {
+		t.Skipf("cannot link plugin: %v", err)
+	}
+	t.Setenv("PATH", bin)
+	t.Setenv(fakeEnv, mode)
+
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, ".fake"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestDetect(t *testing.T) {
+	repo := install(t, "good")
+	if got := Installed(); got["fake"] == "" {
+		t.Fatalf("Installed() = %v, want fake", got)
+	}
+
+	p, ok := Detect(repo)
+	if !ok {
+		t.Fatal("Detect() found no plugin")
+	}
+	if p.Name != "fake" || p.Root != repo || p.DefaultTarget != "trunk" || !reflect.DeepEqual(p.Capabilities, []string{"commits"}) {
+		t.Errorf("Detect() = %+v", p)
+	}
+	if _, ok := Detect(t.TempDir()); ok {
+		t.Error("Detect() claimed a directory without .fake")
+	}
+
+	// --vcs forces a plugin even where it detects nothing.
+	dir := t.TempDir()
+	if p, ok := Lookup("fake", dir); !ok || p.Root != dir {
+		t.Errorf("Lookup() = %+v, %v", p, ok)
+	}
+	if _, ok := Lookup("missing", dir); ok {
+		t.Error("Lookup(missing) succeeded")
+	}
+}
+
+func TestOperations(t *testing.T) {
+	repo := install(t, "good")
+	p, _ := Detect(repo)
+
+	if got := p.GetCurrentBranch(); got != "main" {
+		t.Errorf("GetCurrentBranch() = %q", got)
+	}
+	if got := p.GetRepoName(); got != filepath.Base(repo) {
+		t.Errorf("GetRepoName() = %q", got)
+	}
+	files, err := p.ListChangedFiles(context.Background(), "trunk", diff.Options{})
+	if err != nil || !reflect.DeepEqual(files, []string{"a.txt", "b.txt"}) {
+		t.Errorf("ListChangedFiles() = %q, %v", files, err)
+	}
+	renames, err := p.RenamesByFile(context.Background(), "trunk", diff.Options{})
+	if err != nil || renames["b.txt"] != (diff.Rename{From: "old.txt", Similarity: 90}) {
+		t.Errorf("RenamesByFile() = %v, %v", renames, err)
+	}
+
+	msg := p.DiffCmd(context.Background(), "trunk", "a.txt", "", diff.Options{})().(DiffMsg)
+	if msg.Content != "@@ -1 +1 @@\n-old a.txt\n+new a.txt\n" {
+		t.Errorf("DiffCmd() = %q", msg.Content)
+	}
+	// Options reach the plugin.
+	if msg := p.DiffCmd(context.Background(), "trunk", "a.txt", "", diff.Options{IgnoreAllSpace: true})().(DiffMsg); msg.Content != "" {
+		t.Errorf("DiffCmd(-w) = %q, want empty", msg.Content)
+	}
+	// Word highlighting renders the contents in-process.
+	msg = p.DiffCmd(context.Background(), "trunk", "a.txt", "", diff.Options{Builtin: true})().(DiffMsg)
+	if !strings.Contains(msg.Content, "diff --git a/a.txt b/a.txt") || !strings.Contains(msg.Content, "+new") {
+		t.Errorf("DiffCmd(builtin) =\n%s", msg.Content)
+	}
+
+	s, err := p.Stats(context.Background(), "trunk", diff.Options{})
+	if err != nil || s.Added != 2 || s.Deleted != 2 {
+		t.Errorf("Stats() = %+v, %v", s, err)
+	}
+
+	file, line := p.EditorTarget("a.txt", 3)
+	if file != filepath.Join(repo, "src", "a.txt") || line != 4 {
+		t.Errorf("EditorTarget() = %q, %d", file, line)
+	}
+	// A response without a line keeps the one asked for.
+	file, line = p.EditorTarget("b.txt", 3)
+	if file != filepath.Join(repo, "src", "b.txt") || line != 3 {
+		t.Errorf("EditorTarget(no line) = %q, %d, want line 3", file, line)
+	}
+}
+
+func TestResponsesCached(t *testing.T) {
+	repo := install(t, "good")
+	log := filepath.Join(t.TempDir(), "ops")
+	t.Setenv(fakeLogEnv, log)
+	p, _ := Lookup("fake", repo)
+	ops := func() string {
+		data, _ := os.ReadFile(log)
+		os.Remove(log)
+		return strings.ReplaceAll(strings.TrimSpace(string(data)), "\n", " ")
+	}
+	ops()
+
+	ctx := context.Background()
+	p.GetCurrentBranch()
+	p.GetRepoName()
+	p.ListChangedFiles(ctx, "trunk", diff.Options{})
+	p.RenamesByFile(ctx, "trunk", diff.Options{})
+	p.Stats(ctx, "trunk", diff.Options{})
+	if got := ops(); got != "branch files stats" {
+		t.Errorf("a refresh ran %q, want each operation once", got)
+	}
+
+	// The next refresh asks again, as do other targets and options.
+	p.ListChangedFiles(ctx, "trunk", diff.Options{})
+	p.RenamesByFile(ctx, "trunk", diff.Options{})
+	p.RenamesByFile(ctx, "other", diff.Options{})
+	p.Stats(ctx, "trunk", diff.Options{IgnoreAllSpace: true})
+	if got := ops(); got != "files files stats" {
+		t.Errorf("the next refresh ran %q, want \"files files stats\"", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	repo := install(t, "good")
+	p, _ := Lookup("fake", repo)
+	for _, r := range Check(p, "") {
+		if r.Err != nil {
+			t.Errorf("Check() %s: %v", r.Op, r.Err)
+		}
+	}
+
+	t.Setenv(fakeEnv, "bad")
+	failed := map[string]bool{}
+	for _, r := range Check(p, "") {
+		if r.Err != nil {
+			failed[r.Op] = true
+		}
+	}
+	if !failed["files"] || !failed["unknown"] || failed["branch"] {
+		t.Errorf("Check() failures = %v, want files and unknown", failed)
+	}
+}
@@ -0,0 +1,95 @@
+// Package submodule recognises changes to nested repositories: git
+// submodule pointer bumps and Mercurial subrepo state (.hgsubstate).
+package submodule
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Change is a nested repository moving from one revision to another. Old is
+// empty when the submodule was added and New when it was removed.
+type Change struct {
+	Path     string
+	Old, New string
+	// Dirty marks a git submodule with uncommitted changes in its working
+	// tree.
+	Dirty bool
+}
+
+// Added and Removed report a side without a revision.
+func (c Change) Added() bool   { return c.Old == "" }
+func (c Change) Removed() bool { return c.New == "" }
+
+// Log summarises the commits between Old and New.
+type Log struct {
+	// Commits are one-line descriptions, newest first.
+	Commits []string
+	// Rewound is set when New is an ancestor of Old; Commits then lists
+	// what was dropped.
+	Rewound bool
+}
+
+// Short abbreviates a revision hash for display.
+func Short(rev string) string {
+	if len(rev) > 7 {
+		return rev[:7]
+	}
+	return rev
+}
+
+var subprojectRe = regexp.MustCompile(`^([-+])Subproject commit ([0-9a-f]+)(-dirty)?$`)
+
+// ParseGit recognises the diff git prints for a submodule: a one-line hunk
+// of "Subproject commit <sha>" lines. diffText must not contain color
+// codes.
+func ParseGit(path, diffText string) (Change, bool) {
+	c := Change{Path: path}
+	found := false
+	for _, line := range strings.Split(diffText, "\n") {
+		m := subprojectRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		found = true
+		if m[1] == "-" {
+			c.Old = m[2]
+		} else {
+			c.New = m[2]
+			c.Dirty = m[3] != ""
+		}
+	}
+	return c, found
+}
+
+var substateRe = regexp.MustCompile(`^([-+])([0-9a-f]{40}) (.+)$`)
+
+// ParseSubstate reads the diff of a .hgsubstate file, which holds one
+// "<node> <path>" line per subrepo, into one change per subrepo.
+func ParseSubstate(diffText string) []Change {
+	byPath := make(map[string]*Change)
+	var order []string
+	for _, line := range strings.Split(diffText, "\n") {
+		m := substateRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		c, ok := byPath[m[3]]
+		if !ok {
+			c = &Change{Path: m[3]}
+			byPath[m[3]] = c
+			order = append(order, m[3])
+		}
+		if m[1] == "-" {
+			c.Old = m[2]
+		} else {
+			c.New = m[2]
+		}
+	}
+
+	changes := make([]Change, 0, len(order))
+	for _, path := range order {
+		changes = append(changes, *byPath[path])
+	}
+	return changes
+}
@@ -0,0 +1,41 @@
+package submodule
+
+import "testing"
+
+const (
+	shaA = "1111111111111111111111111111111111111111"
+	shaB = "2222222222222222222222222222222222222222"
+)
+
+func TestParseGit(t *testing.T) {
+	text := "diff --git a/lib b/lib\nindex 1111111..2222222 160000\n--- a/lib\n+++ b/lib\n@@ -1 +1 @@\n" +
+		"-Subproject commit " + shaA + "\n+Subproject commit " + shaB + "-dirty\n"
+	c, ok := ParseGit("lib", text)
+	if !ok || c.Old != shaA || c.New != shaB || !c.Dirty {
+		t.Errorf("ParseGit() = %+v, %v", c, ok)
+	}
+
+	added, ok := ParseGit("lib", "@@ -0,0 +1 @@\n+Subproject commit "+shaB+"\n")
+	if !ok || !added.Added() || added.New != shaB {
+		t.Errorf("ParseGit(added) = %+v, %v", added, ok)
+	}
+
+	if _, ok := ParseGit("main.go", "@@ -1 +1 @@\n-a\n+b\n"); ok {
+		t.Error("ParseGit() accepted a regular diff")
+	}
+}
+
+func TestParseSubstate(t *testing.T) {
+	text := "diff -r 000000000000 .hgsubstate\n--- a/.hgsubstate\n+++ b/.hgsubstate\n@@ -1,2 +1,2 @@\n" +
+		"-" + shaA + " libs/a\n+" + shaB + " libs/a\n " + shaA + " libs/b\n+" + shaB + " libs/c\n"
+	changes := ParseSubstate(text)
+	if len(changes) != 2 {
+		t.Fatalf("ParseSubstate() = %+v, want libs/a and libs/c", changes)
+	}
+	if changes[0].Path != "libs/a" || changes[0].Old != shaA || changes[0].New != shaB {
+		t.Errorf("ParseSubstate()[0] = %+v", changes[0])
+	}
+	if changes[1].Path != "libs/c" || !changes[1].Added() {
+		t.Errorf("ParseSubstate()[1] = %+v", changes[1])
+	}
+}
@@ -0,0 +1,449 @@
+// Package svn is the Subversion backend. Targets are revisions as
+// `svn diff -r` takes them: BASE (the default, the working copy's pristine
+// state), a number, HEAD, PREV, or an "A:B" range that compares two
+// revisions without the working copy.
+package svn
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/backend"
+	"github.com/oug-t/difi/internal/diff"
+)
+
+var svnRoot string
+
+// indexPrefix starts each file section of `svn diff`, followed by a line of
+// "=" and the "---"/"+++" pair.
+const indexPrefix = "Index: "
+
+// propsPrefix starts the property changes of a file, after its content
+// changes or on its own.
+const propsPrefix = "Property changes on: "
+
+func getSvnRoot() string {
+	if svnRoot != "" {
+		return svnRoot
+	}
+	out, err := exec.Command("svn", "info", "--non-interactive", "--show-item", "wc-root").Output()
+	if err == nil {
+		svnRoot = strings.TrimSpace(string(out))
+	}
+	return svnRoot
+}
+
+func svnCmd(args ...string) *exec.Cmd {
+	return svnCmdContext(context.Background(), args...)
+}
+
+// svnCmdContext is svnCmd for operations that are cancelled with ctx: svn is
+// killed when ctx is done.
+func svnCmdContext(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "svn", append([]string{"--non-interactive"}, args...)...)
+	// Keep messages in English, some are matched below.
+	cmd.Env = append(os.Environ(), "LC_MESSAGES=C")
+	if root := getSvnRoot(); root != "" {
+		cmd.Dir = root
+	}
+	return cmd
+}
+
+// GetCurrentBranch names the branch from the working copy's URL, following
+// the trunk/branches/tags layout.
+func GetCurrentBranch() string {
+	out, err := svnCmd("info", "--show-item", "relative-url").Output()
+	if err != nil {
+		return "trunk"
+	}
+	return branchName(strings.TrimSpace(string(out)))
+}
+
+func branchName(relURL string) string {
+	parts := strings.Split(strings.TrimPrefix(relURL, "^/"), "/")
+	for i, part := range parts {
+		switch part {
+		case "trunk":
+			return "trunk"
+		case "branches", "tags":
+			if i+1 < len(parts) {
+				return parts[i+1]
+			}
+		}
+	}
+	if last := parts[len(parts)-1]; last != "" {
+		return last
+	}
+	return "trunk"
+}
+
+func GetRepoName() string {
+	root := getSvnRoot()
+	if root == "" {
+		return "Repo"
+	}
+	return filepath.Base(root)
+}
+
+// revisions splits a target into the two sides it compares. An empty
+// newRev stands for the working copy.
+func revisions(targetBranch string) (oldRev, newRev string) {
+	if targetBranch == "" {
+		return "BASE", ""
+	}
+	if a, b, ok := strings.Cut(targetBranch, ":"); ok {
+		return a, b
+	}
+	return targetBranch, ""
+}
+
+// revArgs returns the -r flag for a target; plain `svn diff` already
+// compares BASE with the working copy.
+func revArgs(targetBranch string) []string {
+	if targetBranch == "" || targetBranch == "BASE" {
+		return nil
+	}
+	return []string{"-r", targetBranch}
+}
+
+// ListChangedFiles returns the changed files. A moved file is listed once,
+// under its new name.
+func ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	files, _, err := changes(ctx, targetBranch)
+	return files, err
+}
+
+// RenamesByFile maps moved files to their source. Subversion tracks moves
+// in the working copy only, and does not score them, so the similarity is
+// computed here and pairs below the threshold are dropped.
+func RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	_, renames, err := changes(ctx, targetBranch)
+	if err != nil {
+		return nil, err
+	}
+	oldRev, _ := revisions(targetBranch)
+	for path, r := range renames {
+		old, err := Cat(ctx, oldRev, r.From)
+		if err != nil {
+			return nil, err
+		}
+		data, _ := os.ReadFile(filepath.Join(getSvnRoot(), path))
+		r.Similarity = diff.Similarity(old, data)
+		if r.Similarity < opts.Threshold() {
+			delete(renames, path)
+			continue
+		}
+		renames[path] = r
+	}
+	return renames, nil
+}
+
+// changes lists the changed files with `svn status` for working copy
+// targets and `svn diff --summarize` for revision ranges.
+func changes(ctx context.Context, targetBranch string) ([]string, map[string]diff.Rename, error) {
+	var cmd *exec.Cmd
+	if _, newRev := revisions(targetBranch); newRev != "" {
+		cmd = svnCmdContext(ctx, "diff", "--summarize", "--xml", "-r", targetBranch)
+	} else if args := revArgs(targetBranch); args != nil {
+		cmd = svnCmdContext(ctx, append([]string{"diff", "--summarize", "--xml"}, args...)...)
+	} else {
+		cmd = svnCmdContext(ctx, "status", "--xml")
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("svn %s error: %w", cmd.Args[2], err)
+	}
+	entries, err := parseStatus(out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root := getSvnRoot()
+	return changedFiles(entries, func(path string) bool {
+		info, err := os.Stat(filepath.Join(root, path))
+		return err == nil && info.IsDir()
+	})
+}
+
+// statusEntry is a path from `svn status --xml` or `svn diff --summarize
+// --xml`, which report the same states under different elements.
+type statusEntry struct {
+	Path      string
+	Item      string // modified, added, deleted, replaced, conflicted, ...
+	Props     string // none, normal or modified
+	Kind      string // file or dir; only known for summaries
+	MovedFrom string
+	MovedTo   string
+}
+
+func parseStatus(data []byte) ([]statusEntry, error) {
+	var doc struct {
+		Targets []struct {
+			Entries []struct {
+				Path   string `xml:"path,attr"`
+				Status struct {
+					Item      string `xml:"item,attr"`
+					Props     string `xml:"props,attr"`
+					MovedFrom string `xml:"moved-from,attr"`
+					MovedTo   string `xml:"moved-to,attr"`
+				} `xml:"wc-status"`
+			} `xml:"entry"`
+		} `xml:"target"`
+		Paths []struct {
+			Path  string `xml:",chardata"`
+			Item  string `xml:"item,attr"`
+			Props string `xml:"props,attr"`
+			Kind  string `xml:"kind,attr"`
+		} `xml:"paths>path"`
+	}
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("svn xml error: %w", err)
+	}
+
+	var entries []statusEntry
+	for _, t := range doc.Targets {
+		for _, e := range t.Entries {
+			entries = append(entries, statusEntry{
+				Path: filepath.ToSlash(e.Path), Item: e.Status.Item, Props: e.Status.Props,
+				MovedFrom: filepath.ToSlash(e.Status.MovedFrom), MovedTo: filepath.ToSlash(e.Status.MovedTo),
+			})
+		}
+	}
+	for _, p := range doc.Paths {
+		entries = append(entries, statusEntry{Path: filepath.ToSlash(p.Path), Item: p.Item, Props: p.Props, Kind: p.Kind})
+	}
+	return entries, nil
+}
+
+// changedFiles keeps the entries with content or property changes.
+// Directories are dropped: their changed children are listed themselves.
+// The sources of moves are folded into their destination.
+func changedFiles(entries []statusEntry, isDir func(string) bool) ([]string, map[string]diff.Rename, error) {
+	renames := make(map[string]diff.Rename)
+	changed := make(map[string]bool)
+	for _, e := range entries {
+		switch e.Item {
+		case "modified", "added", "deleted", "replaced", "conflicted", "missing", "obstructed":
+		default:
+			if e.Props != "modified" && e.Props != "conflicted" {
+				continue
+			}
+		}
+		if e.Kind == "dir" || e.MovedTo != "" {
+			continue
+		}
+		if e.MovedFrom != "" {
+			renames[e.Path] = diff.Rename{From: e.MovedFrom}
+		}
+		changed[e.Path] = true
+	}
+
+	files := []string{}
+	for path := range changed {
+		if isDir(path) || hasChild(changed, path) {
+			continue
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, renames, nil
+}
+
+func hasChild(paths map[string]bool, dir string) bool {
+	for p := range paths {
+		if strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// diffArgs builds `svn diff` against the target. svn's internal diff takes
+// its whitespace options through -x.
+func diffArgs(targetBranch string, opts diff.Options) []string {
+	args := append([]string{"diff"}, revArgs(targetBranch)...)
+	if x := extensions(opts); x != "" {
+		args = append(args, "-x", x)
+	}
+	return args
+}
+
+// extensions maps the whitespace options onto svn diff -x flags. svn cannot
+// ignore blank lines; DiffCmd hands that to the builtin engine.
+func extensions(opts diff.Options) string {
+	var x []string
+	if opts.IgnoreAllSpace {
+		x = append(x, "-w")
+	}
+	if opts.IgnoreSpaceChange {
+		x = append(x, "-b")
+	}
+	if opts.IgnoreCRAtEOL {
+		x = append(x, "--ignore-eol-style")
+	}
+	if len(x) == 0 {
+		return ""
+	}
+	return strings.Join(append([]string{"-u"}, x...), " ")
+}
+
+// DiffCmd loads the diff of path. svn diffs a moved file against its
+// source on its own, so oldPath is only used by the builtin engine.
+func DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	return func() tea.Msg {
+		if opts.NeedsBuiltin() || opts.Algorithm != diff.Myers || opts.IgnoreBlankLines {
+			out, err := BuiltinDiff(ctx, targetBranch, path, oldPath, opts)
+			if err != nil {
+				return DiffMsg{Err: err}
+			}
+			return DiffMsg{Content: out}
+		}
+
+		out, err := svnCmdContext(ctx, append(diffArgs(targetBranch, opts), "--", pegPath(path))...).Output()
+		if err != nil {
+			return DiffMsg{Err: err}
+		}
+		return DiffMsg{Content: string(out)}
+	}
+}
+
+// pegPath escapes an "@" in a path, which svn would read as a peg revision.
+func pegPath(path string) string {
+	if strings.Contains(path, "@") {
+		return path + "@"
+	}
+	return path
+}
+
+// BuiltinDiff reads the file at the target revision with `svn cat` and
+// diffs it in-process. oldPath is the move source, if any.
+func BuiltinDiff(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) (string, error) {
+	f, err := FileContents(ctx, targetBranch, path, oldPath)
+	if err != nil {
+		return "", err
+	}
+	return diff.Render(f, opts), nil
+}
+
+// FileContents loads both versions of path for the target. The new side is
+// the working copy unless the target is a range.
+func FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	oldRev, newRev := revisions(targetBranch)
+	return backend.FileContents(ctx, Cat, getSvnRoot(), oldRev, newRev, path, oldPath)
+}
+
+// notFoundCodes are the svn errors for a path missing from a revision.
+var notFoundCodes = []string{"W155010", "W160013", "E160013", "E200009", "E195012"}
+
+// WorkingFile returns where a repository path lives in the working copy.
+func WorkingFile(path string) string {
+	return filepath.Join(getSvnRoot(), path)
+}
+
+// Cat returns the contents of path at rev, or nil when the file does not
+// exist in that revision.
+func Cat(ctx context.Context, rev, path string) ([]byte, error) {
+	cmd := svnCmdContext(ctx, "cat", "-r", rev, "--", pegPath(path))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			for _, code := range notFoundCodes {
+				if strings.Contains(stderr.String(), code) {
+					return nil, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("svn cat error: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if out == nil {
+		out = []byte{}
+	}
+	return out, nil
+}
+
+func OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	c := backend.EditorCmd(getSvnRoot(), path, lineNumber, targetBranch, editor)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return EditorFinishedMsg{Err: err}
+	})
+}
+
+// fullDiff runs `svn diff` over the whole working copy. svn has no --stat,
+// so the stats are counted from it.
+func fullDiff(ctx context.Context, targetBranch string, opts diff.Options) (string, error) {
+	out, err := svnCmdContext(ctx, diffArgs(targetBranch, opts)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("svn diff error: %w", err)
+	}
+	return string(out), nil
+}
+
+// Stats counts the changes of one full diff. With whitespace options set,
+// files whose changes are all whitespace are left out of ByFile. The
+// binary files are those whose svn:mime-type is not text, which `svn diff`
+// refuses to display.
+func Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	text, err := fullDiff(ctx, targetBranch, opts)
+	if err != nil {
+		return diff.Summary{}, err
+	}
+	byFile := countLines(text)
+	added, deleted := backend.Totals(byFile)
+	return diff.Summary{Added: added, Deleted: deleted, ByFile: byFile, Binary: backend.BinaryFiles(text, sectionPath)}, nil
+}
+
+// countLines counts the added and deleted lines of each file in an svn
+// diff. The "##" hunks of property changes are left out.
+func countLines(text string) map[string][2]int {
+	return backend.CountLines(text, func(line string) (string, bool) {
+		if path, ok := strings.CutPrefix(line, indexPrefix); ok {
+			return path, true
+		}
+		return strings.CutPrefix(line, propsPrefix)
+	})
+}
+
+// DiffMsg carries a file's diff, or the error that kept it from loading.
+type DiffMsg struct {
+	Content string
+	Err     error
+}
+
+type EditorFinishedMsg struct{ Err error }
+
+// sectionPath returns the file the section starting at lines[i] is about:
+// an "Index:" line, the "Property changes on:" line of a change to
+// properties only, or a git-style header, which `svn diff --git` repeats
+// after "Index:" and normalized piped diffs use on their own.
+func sectionPath(lines []string, i int) (string, bool) {
+	if path, ok := strings.CutPrefix(lines[i], indexPrefix); ok {
+		return path, true
+	}
+	if path, ok := strings.CutPrefix(lines[i], propsPrefix); ok {
+		return path, true
+	}
+	if i > 1 && strings.HasPrefix(lines[i-2], indexPrefix) {
+		return "", false
+	}
+	return diff.SectionPath(lines, i)
+}
+
+func ParseFilesFromDiff(diffText string) []string {
+	return backend.ParseFiles(diffText, sectionPath)
+}
+
+func ExtractFileDiff(diffText, targetPath string) string {
+	return backend.ExtractFile(diffText, targetPath, sectionPath)
+}
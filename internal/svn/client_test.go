@@ -0,0 +1,283 @@
+package svn
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
+)
+
+// Output of `svn diff` with a modified file, an added file and a change to
+// properties only.
+const svnDiff = `Index: src/main.c
+===================================================================
+--- src/main.c	(revision 3)
++++ src/main.c	(working copy)
+@@ -1,3 +1,3 @@
+ int main() {
+--- return 1;
++-- return 0;
+ }
+Index: new file.txt
+===================================================================
+--- new file.txt	(nonexistent)
++++ new file.txt	(working copy)
+@@ -0,0 +1,2 @@
++one
++two
+
+Property changes on: README
+___________________________________________________________________
+Added: svn:eol-style
+## -0,0 +1 ##
++native
+\ No newline at end of property
+`
+
+func TestParseFilesFromDiff(t *testing.T) {
+	got := ParseFilesFromDiff(svnDiff)
+	want := []string{"src/main.c", "new file.txt", "README"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFilesFromDiff() = %q, want %q", got, want)
+	}
+
+	// svn diff --git repeats the file in a git header after "Index:".
+	gitStyle := "Index: x.go\n" + strings.Repeat("=", 67) + "\ndiff --git a/x.go b/x.go\n--- a/x.go\t(revision 1)\n+++ b/x.go\t(working copy)\n@@ -1 +1 @@\n-a\n+b\n"
+	if got := ParseFilesFromDiff(gitStyle); !reflect.DeepEqual(got, []string{"x.go"}) {
+		t.Errorf("ParseFilesFromDiff(--git) = %q", got)
+	}
+}
+
+func TestExtractFileDiff(t *testing.T) {
+	got := ExtractFileDiff(svnDiff, "src/main.c")
+	if !strings.HasPrefix(got, "Index: src/main.c\n") || !strings.HasSuffix(got, "\n }") {
+		t.Errorf("ExtractFileDiff(src/main.c) =\n%s", got)
+	}
+	// The removed "-- return 1;" line must stay in its section.
+	if !strings.Contains(got, "--- return 1;") {
+		t.Errorf("ExtractFileDiff(src/main.c) lost a removed line:\n%s", got)
+	}
+	got = ExtractFileDiff(svnDiff, "new file.txt")
+	if !strings.HasSuffix(got, "+two\n") {
+		t.Errorf("ExtractFileDiff(new file.txt) =\n%s", got)
+	}
+	if got := ExtractFileDiff(svnDiff, "missing"); got != "" {
+		t.Errorf("ExtractFileDiff(missing) = %q, want empty", got)
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	got := countLines(svnDiff)
+	want := map[string][2]int{"src/main.c": {1, 1}, "new file.txt": {2, 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("countLines() = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	status := `<?xml version="1.0" encoding="UTF-8"?>
+<status>
+<target path=".">
+<entry path="dir"><wc-status item="deleted" props="none"></wc-status></entry>
+<entry path="dir/gone.c"><wc-status item="deleted" props="none"></wc-status></entry>
+<entry path="moved.c"><wc-status item="added" props="none" copied="true" moved-from="orig.c"></wc-status></entry>
+<entry path="orig.c"><wc-status item="deleted" props="none" moved-to="moved.c"></wc-status></entry>
+<entry path="props.c"><wc-status item="normal" props="modified"></wc-status></entry>
+<entry path="scratch.txt"><wc-status item="unversioned" props="none"></wc-status></entry>
+</target>
+</status>`
+	entries, err := parseStatus([]byte(status))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, renames, err := changedFiles(entries, func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dir/gone.c", "moved.c", "props.c"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("changedFiles() = %q, want %q", files, want)
+	}
+	if renames["moved.c"].From != "orig.c" {
+		t.Errorf("renames = %v, want moved.c from orig.c", renames)
+	}
+
+	summary := `<?xml version="1.0" encoding="UTF-8"?>
+<diff>
+<paths>
+<path item="added" props="none" kind="dir">lib</path>
+<path item="added" props="none" kind="file">lib/a.c</path>
+<path item="modified" props="none" kind="file">main.c</path>
+</paths>
+</diff>`
+	entries, err = parseStatus([]byte(summary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _, _ = changedFiles(entries, func(string) bool { return false })
+	if want := []string{"lib/a.c", "main.c"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("changedFiles(summary) = %q, want %q", files, want)
+	}
+}
+
+func TestBranchName(t *testing.T) {
+	tests := map[string]string{
+		"^/trunk":                 "trunk",
+		"^/trunk/src":             "trunk",
+		"^/branches/feature/docs": "feature",
+		"^/project/tags/v1.0":     "v1.0",
+		"^/":                      "trunk",
+		"^/sandbox":               "sandbox",
+	}
+	for url, want := range tests {
+		if got := branchName(url); got != want {
+			t.Errorf("branchName(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	if got := extensions(diff.Options{}); got != "" {
+		t.Errorf("extensions() = %q, want empty", got)
+	}
+	if got := extensions(diff.Options{IgnoreAllSpace: true, IgnoreCRAtEOL: true}); got != "-u -w --ignore-eol-style" {
+		t.Errorf("extensions() = %q", got)
+	}
+}
+
+// checkout creates a repository with svnadmin, commits files to it and
+// checks it out into a working copy, which becomes the current directory.
+func checkout(t *testing.T, files map[string]string) string {
+	t.Helper()
+	for _, tool := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not installed", tool)
+		}
+	}
+	base := t.TempDir()
+	repo := filepath.Join(base, "repo")
+	wc := filepath.Join(base, "wc")
+	run(t, base, "svnadmin", "create", repo)
+	run(t, base, "svn", "checkout", "--non-interactive", "file://"+filepath.ToSlash(repo), wc)
+
+	for name, content := range files {
+		writeFile(t, wc, name, content)
+		run(t, wc, "svn", "add", "--parents", "--non-interactive", name)
+	}
+	run(t, wc, "svn", "commit", "--non-interactive", "-m", "initial")
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(wc); err != nil {
+		t.Fatal(err)
+	}
+	svnRoot = ""
+	t.Cleanup(func() {
+		svnRoot = ""
+		_ = os.Chdir(origDir)
+	})
+	return wc
+}
+
+func run(t *testing.T, dir, name string, args ...string) {
+	t.Helper()
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s %v: %v\n%s", name, args, err, out)
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkingCopy(t *testing.T) {
+	wc := checkout(t, map[string]string{
+		"main.c":     "int main() {\n\treturn 1;\n}\n",
+		"lib/util.c": "void util() {}\n",
+	})
+	writeFile(t, wc, "main.c", "int main() {\n\treturn 0;\n}\n")
+	writeFile(t, wc, "added.txt", "new\n")
+	run(t, wc, "svn", "add", "added.txt")
+	run(t, wc, "svn", "rm", "lib/util.c")
+
+	files, err := ListChangedFiles(context.Background(), "BASE", diff.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"added.txt", "lib/util.c", "main.c"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("ListChangedFiles() = %q, want %q", files, want)
+	}
+
+	msg := DiffCmd(context.Background(), "BASE", "main.c", "", diff.Options{})().(DiffMsg)
+	if !strings.Contains(msg.Content, "Index: main.c") || !strings.Contains(msg.Content, "+\treturn 0;") {
+		t.Errorf("DiffCmd() =\n%s", msg.Content)
+	}
+	if got := ParseFilesFromDiff(msg.Content); !reflect.DeepEqual(got, []string{"main.c"}) {
+		t.Errorf("ParseFilesFromDiff() = %q", got)
+	}
+
+	s, err := Stats(context.Background(), "BASE", diff.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.ByFile; stats["main.c"] != [2]int{1, 1} || stats["lib/util.c"] != [2]int{0, 1} || stats["added.txt"] != [2]int{1, 0} {
+		t.Errorf("Stats() = %+v", s)
+	}
+
+	f, err := FileContents(context.Background(), "BASE", "added.txt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.OldMissing || string(f.New) != "new\n" {
+		t.Errorf("FileContents(added.txt) = %+v", f)
+	}
+
+	// A builtin diff reads the old side with svn cat.
+	out, err := BuiltinDiff(context.Background(), "BASE", "main.c", "", diff.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "-\treturn 1;") {
+		t.Errorf("BuiltinDiff() =\n%s", out)
+	}
+
+	if got := GetCurrentBranch(); got != "trunk" {
+		t.Errorf("GetCurrentBranch() = %q, want trunk", got)
+	}
+}
+
+func TestRevisionRange(t *testing.T) {
+	wc := checkout(t, map[string]string{"a.txt": "one\n"})
+	writeFile(t, wc, "a.txt", "two\n")
+	run(t, wc, "svn", "commit", "--non-interactive", "-m", "second")
+
+	files, err := ListChangedFiles(context.Background(), "1:2", diff.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{"a.txt"}) {
+		t.Errorf("ListChangedFiles(1:2) = %q", files)
+	}
+	f, err := FileContents(context.Background(), "1:2", "a.txt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(f.Old) != "one\n" || string(f.New) != "two\n" {
+		t.Errorf("FileContents(1:2) = %q, %q", f.Old, f.New)
+	}
+}
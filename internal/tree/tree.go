@@ -11,7 +11,9 @@ import (
 
 // FileTree holds the state of the entire file graph.
 type FileTree struct {
-	Root *Node
+	Root    *Node
+	nodes   map[string]*Node // every node below the root, by full path
+	visible int              // how many items Items last returned
 }
 
 // Node represents a file or directory in the tree.
@@ -22,6 +24,10 @@ type Node struct {
 	Children map[string]*Node
 	Expanded bool
 	Depth    int
+
+	parent *Node
+	sorted []*Node   // Children in display order; nil until needed again
+	item   list.Item // the node's TreeItem; nil until needed again
 }
 
 // TreeItem represents a file or folder for the Bubble Tea list.
@@ -60,22 +66,30 @@ func New(paths []string) *FileTree {
 		Expanded: true, // Root always expanded
 		Depth:    -1,   // Root is hidden
 	}
+	t := &FileTree{Root: root, nodes: make(map[string]*Node)}
+	t.Add(paths...)
+	return t
+}
 
+// Add inserts paths into the tree, creating directory nodes as needed.
+// Paths already in it are left as they are.
+func (t *FileTree) Add(paths ...string) {
 	for _, path := range paths {
-		addPath(root, path)
+		t.add(path)
 	}
-
-	return &FileTree{Root: root}
 }
 
-// addPath inserts a path into the tree, creating directory nodes as needed.
-func addPath(root *Node, path string) {
-	cleanPath := filepath.ToSlash(filepath.Clean(path))
-	parts := strings.Split(cleanPath, "/")
+func (t *FileTree) add(path string) {
+	clean := cleanPath(path)
+	if _, exists := t.nodes[clean]; exists {
+		return
+	}
+	parts := strings.Split(clean, "/")
 
-	current := root
+	current := t.Root
 	for i, name := range parts {
-		if _, exists := current.Children[name]; !exists {
+		child, exists := current.Children[name]
+		if !exists {
 			isFile := i == len(parts)-1
 			nodePath := name
 			if current.FullPath != "" {
@@ -84,51 +98,97 @@ func addPath(root *Node, path string) {
 
 			// Directories default to expanded for visibility, or collapsed if preferred
 			// GitHub usually auto-expands to show changed files. Here we auto-expand.
-			current.Children[name] = &Node{
+			child = &Node{
 				Name:     name,
 				FullPath: nodePath,
 				IsDir:    !isFile,
-				Children: make(map[string]*Node),
 				Expanded: true,
 				Depth:    current.Depth + 1,
+				parent:   current,
+			}
+			if current.Children == nil {
+				// A file listed as well as something below it.
+				current.Children = make(map[string]*Node)
+			}
+			current.Children[name] = child
+			current.sorted = nil
+			t.nodes[nodePath] = child
+		}
+		current = child
+	}
+}
+
+// Remove takes paths out of the tree, along with the directories they
+// leave empty.
+func (t *FileTree) Remove(paths ...string) {
+	for _, path := range paths {
+		node, ok := t.nodes[cleanPath(path)]
+		if !ok {
+			continue
+		}
+		t.forget(node)
+		for parent := node.parent; ; node, parent = parent, parent.parent {
+			delete(parent.Children, node.Name)
+			parent.sorted = nil
+			if parent == t.Root || len(parent.Children) > 0 {
+				break
 			}
+			delete(t.nodes, parent.FullPath)
 		}
-		current = current.Children[name]
 	}
 }
 
+// forget drops node and everything below it from the index.
+func (t *FileTree) forget(node *Node) {
+	delete(t.nodes, node.FullPath)
+	for _, child := range node.Children {
+		t.forget(child)
+	}
+}
+
+// Set changes the files in the tree to paths, adding and removing only what
+// differs, so directories still listed keep their expansion.
+func (t *FileTree) Set(paths []string) {
+	keep := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		keep[cleanPath(path)] = true
+	}
+	var gone []string
+	for path, node := range t.nodes {
+		if !node.IsDir && !keep[path] {
+			gone = append(gone, path)
+		}
+	}
+	t.Remove(gone...)
+	t.Add(paths...)
+}
+
+func cleanPath(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
 // Items returns the flattened, visible list items based on expansion state.
 func (t *FileTree) Items() []list.Item {
-	var items []list.Item
+	items := make([]list.Item, 0, t.visible)
 	flatten(t.Root, &items)
+	t.visible = len(items)
 	return items
 }
 
 // flatten recursively builds the list, respecting expansion state.
 func flatten(node *Node, items *[]list.Item) {
-	// Collect children to sort
-	children := make([]*Node, 0, len(node.Children))
-	for _, child := range node.Children {
-		children = append(children, child)
-	}
-
-	// Sort: Directories first, then alphabetical
-	sort.Slice(children, func(i, j int) bool {
-		if children[i].IsDir != children[j].IsDir {
-			return children[i].IsDir
+	for _, child := range node.children() {
+		if child.item == nil {
+			child.item = TreeItem{
+				Name:     child.Name,
+				FullPath: child.FullPath,
+				IsDir:    child.IsDir,
+				Depth:    child.Depth,
+				Expanded: child.Expanded,
+				Icon:     getIcon(child.Name, child.IsDir),
+			}
 		}
-		return strings.ToLower(children[i].Name) < strings.ToLower(children[j].Name)
-	})
-
-	for _, child := range children {
-		*items = append(*items, TreeItem{
-			Name:     child.Name,
-			FullPath: child.FullPath,
-			IsDir:    child.IsDir,
-			Depth:    child.Depth,
-			Expanded: child.Expanded,
-			Icon:     getIcon(child.Name, child.IsDir),
-		})
+		*items = append(*items, child.item)
 
 		// Only traverse children if expanded
 		if child.IsDir && child.Expanded {
@@ -137,32 +197,40 @@ func flatten(node *Node, items *[]list.Item) {
 	}
 }
 
+// children returns the node's children sorted for display, sorting them
+// only after they changed.
+func (n *Node) children() []*Node {
+	if n.sorted != nil || len(n.Children) == 0 {
+		return n.sorted
+	}
+	n.sorted = make([]*Node, 0, len(n.Children))
+	for _, child := range n.Children {
+		n.sorted = append(n.sorted, child)
+	}
+
+	// Sort: Directories first, then alphabetical
+	sort.Slice(n.sorted, func(i, j int) bool {
+		a, b := n.sorted[i], n.sorted[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if la, lb := strings.ToLower(a.Name), strings.ToLower(b.Name); la != lb {
+			return la < lb
+		}
+		return a.Name < b.Name
+	})
+	return n.sorted
+}
+
 // ToggleExpand toggles the expansion state of a specific node.
 func (t *FileTree) ToggleExpand(fullPath string) {
-	node := findNode(t.Root, fullPath)
+	node := t.nodes[fullPath]
 	if node != nil && node.IsDir {
 		node.Expanded = !node.Expanded
+		node.item = nil
 	}
 }
 
-func findNode(node *Node, fullPath string) *Node {
-	if node.FullPath == fullPath {
-		return node
-	}
-	// Simple traversal. For very large trees, a map cache in FileTree might be faster.
-	for _, child := range node.Children {
-		if strings.HasPrefix(fullPath, child.FullPath) {
-			if child.FullPath == fullPath {
-				return child
-			}
-			if found := findNode(child, fullPath); found != nil {
-				return found
-			}
-		}
-	}
-	return nil
-}
-
 func getIcon(name string, isDir bool) string {
 	if isDir {
 		return ""
@@ -0,0 +1,120 @@
+package tree
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// paths lists the full paths of the visible items.
+func paths(t *FileTree) []string {
+	var out []string
+	for _, item := range t.Items() {
+		out = append(out, item.(TreeItem).FullPath)
+	}
+	return out
+}
+
+func TestItems(t *testing.T) {
+	ft := New([]string{"b.go", "src/foobar/x.go", "A.md", "src/foo/y.go", "src/a.go"})
+	want := []string{"src", "src/foo", "src/foo/y.go", "src/foobar", "src/foobar/x.go", "src/a.go", "A.md", "b.go"}
+	if got := paths(ft); !slices.Equal(got, want) {
+		t.Errorf("Items() = %v, want %v", got, want)
+	}
+
+	// A directory whose name starts another's toggles only itself.
+	ft.ToggleExpand("src/foo")
+	want = []string{"src", "src/foo", "src/foobar", "src/foobar/x.go", "src/a.go", "A.md", "b.go"}
+	if got := paths(ft); !slices.Equal(got, want) {
+		t.Errorf("Items() after collapsing src/foo = %v, want %v", got, want)
+	}
+	ft.ToggleExpand("src/foo/y.go")
+	ft.ToggleExpand("missing")
+	if got := paths(ft); !slices.Equal(got, want) {
+		t.Errorf("Items() after toggling files = %v, want %v", got, want)
+	}
+}
+
+func TestAddRemove(t *testing.T) {
+	ft := New([]string{"src/a/x.go", "src/b/y.go"})
+	ft.ToggleExpand("src/b")
+
+	ft.Add("src/a/z.go", "./src/a/x.go", "top.go")
+	want := []string{"src", "src/a", "src/a/x.go", "src/a/z.go", "src/b", "top.go"}
+	if got := paths(ft); !slices.Equal(got, want) {
+		t.Errorf("Items() after Add = %v, want %v", got, want)
+	}
+
+	// Removing the last file of a directory removes the directory too.
+	ft.Remove("src/b/y.go", "src/a/x.go", "missing.go")
+	want = []string{"src", "src/a", "src/a/z.go", "top.go"}
+	if got := paths(ft); !slices.Equal(got, want) {
+		t.Errorf("Items() after Remove = %v, want %v", got, want)
+	}
+	if ft.nodes["src/b"] != nil {
+		t.Error("src/b is still indexed after its last file was removed")
+	}
+
+	// Directories listed again keep their expansion.
+	ft.ToggleExpand("src/a")
+	ft.Set([]string{"src/a/z.go", "src/a/w.go", "new/n.go"})
+	want = []string{"new", "new/n.go", "src", "src/a"}
+	if got := paths(ft); !slices.Equal(got, want) {
+		t.Errorf("Items() after Set = %v, want %v", got, want)
+	}
+	ft.ToggleExpand("src/a")
+	want = []string{"new", "new/n.go", "src", "src/a", "src/a/w.go", "src/a/z.go"}
+	if got := paths(ft); !slices.Equal(got, want) {
+		t.Errorf("Items() after expanding src/a = %v, want %v", got, want)
+	}
+}
+
+// generated returns n file paths spread over two levels of directories,
+// as in a large repository.
+func generated(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("pkg%02d/sub%02d/file%05d.go", i%50, i/50%20, i)
+	}
+	return out
+}
+
+func BenchmarkNew(b *testing.B) {
+	files := generated(50000)
+	for i := 0; i < b.N; i++ {
+		New(files)
+	}
+}
+
+func BenchmarkItems(b *testing.B) {
+	ft := New(generated(50000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ft.Items()
+	}
+}
+
+// BenchmarkToggle collapses and expands a directory of a 50k-file tree and
+// lists the items, as the enter key does.
+func BenchmarkToggle(b *testing.B) {
+	ft := New(generated(50000))
+	ft.Items()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ft.ToggleExpand("pkg25/sub10")
+		ft.Items()
+	}
+}
+
+// BenchmarkSet lists a 50k-file tree again with one file changed, as a live
+// reload does.
+func BenchmarkSet(b *testing.B) {
+	files := generated(50000)
+	ft := New(files)
+	ft.Items()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		files[i%len(files)] = fmt.Sprintf("new/file%05d.go", i%len(files))
+		ft.Set(files)
+	}
+}
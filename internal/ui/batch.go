@@ -0,0 +1,231 @@
+package ui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// batchChunk bounds the files one batchMsg carries, so the tree keeps
+// filling in while a large diff is still being read.
+const batchChunk = 200
+
+// batchMsg carries the files of a batch diff read since the previous one.
+// Err is set on the last message when the diff failed part way.
+type batchMsg struct {
+	sections []diff.Section
+	done     bool
+	err      error
+	opts     diff.Options
+	id       int
+	next     <-chan batchItem
+}
+
+type batchItem struct {
+	section diff.Section
+	err     error
+}
+
+// streamCmd starts the batch diff: one run of the VCS for every changed
+// file, or the diff piped to difi, whose sections supply the tree, the
+// stats and the diffs.
+func (m Model) streamCmd() tea.Cmd {
+	timeout := m.reqs.statsTimeout
+	if m.stdin != nil {
+		// The producer takes as long as it takes.
+		timeout = 0
+	}
+	id, ctx := m.reqs.batch.start(timeout)
+	target, opts, stdin := m.targetBranch, m.diffOpts, m.stdin
+	b, _ := m.vcs.(vcs.Batch)
+	read := func(fn func(diff.Section) error) error {
+		if stdin != nil {
+			return stdin.Read(fn)
+		}
+		r, err := b.StreamDiff(ctx, target, opts)
+		if err != nil {
+			return err
+		}
+		err = diff.ReadSections(r, fn)
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	return func() tea.Msg {
+		ch := make(chan batchItem, batchChunk)
+		go func() {
+			defer close(ch)
+			err := read(func(s diff.Section) error {
+				select {
+				case ch <- batchItem{section: s}:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil && !canceled(ctx) {
+				select {
+				case ch <- batchItem{err: vcs.Classify(ctx, err)}:
+				case <-ctx.Done():
+				}
+			}
+		}()
+		return nextBatchCmd(ch, id, opts)()
+	}
+}
+
+// nextBatchCmd waits for more of the batch diff and takes whatever else
+// has arrived by then, up to batchChunk files.
+func nextBatchCmd(ch <-chan batchItem, id int, opts diff.Options) tea.Cmd {
+	return func() tea.Msg {
+		msg := batchMsg{opts: opts, id: id, next: ch}
+		item, ok := <-ch
+		for ok {
+			if item.err != nil {
+				msg.err = item.err
+			} else {
+				msg.sections = append(msg.sections, item.section)
+			}
+			if len(msg.sections) >= batchChunk {
+				return msg
+			}
+			select {
+			case item, ok = <-ch:
+			default:
+				return msg
+			}
+		}
+		msg.done = true
+		return msg
+	}
+}
+
+// addSections lists the files of a batch diff chunk, counts their changes
+// and caches their diffs, keeping the selection where it was.
+func (m *Model) addSections(sections []diff.Section, opts diff.Options) {
+	if m.fileStats == nil {
+		m.fileStats = make(map[string][2]int)
+	}
+	if m.renames == nil {
+		m.renames = make(map[string]diff.Rename)
+	}
+	if m.binaryFiles == nil {
+		m.binaryFiles = make(map[string]bool)
+	}
+	if m.lfsFiles == nil {
+		m.lfsFiles = make(map[string]bool)
+	}
+	if m.listed == nil {
+		m.listed = make(map[string]bool)
+	}
+	// Sections are what a per-file diff prints only when the VCS would be
+	// asked for that diff as well.
+	cacheable := !opts.NeedsBuiltin() && opts.Algorithm == diff.Myers
+
+	listed := len(m.files)
+	for _, s := range sections {
+		// A piped log can touch a file in several sections.
+		if !m.listed[s.Path] {
+			m.listed[s.Path] = true
+			m.files = append(m.files, s.Path)
+		}
+		m.streamed += len(s.Text)
+		if s.Added > 0 || s.Deleted > 0 {
+			st := m.fileStats[s.Path]
+			m.fileStats[s.Path] = [2]int{st[0] + s.Added, st[1] + s.Deleted}
+			m.statsAdded += s.Added
+			m.statsDeleted += s.Deleted
+		}
+		if s.Rename.From != "" {
+			m.renames[s.Path] = s.Rename
+		}
+		if s.Binary {
+			m.binaryFiles[s.Path] = true
+		}
+		if s.LFS {
+			m.lfsFiles[s.Path] = true
+		}
+		if key, ok := m.diffKey(s.Path); ok && cacheable {
+			key.Opts = opts
+			m.cache.Put(key, s.Text)
+		}
+	}
+	m.treeDelegate.Renames = m.renames
+	m.treeDelegate.LFS = m.lfsFiles
+
+	// A reload waits for the file that was selected before it.
+	path, index := m.selection()
+	if m.keepPath != "" {
+		path, index = m.keepPath, m.keepIndex
+	}
+	if listed == 0 {
+		// The first chunk of a reload replaces the files listed before it.
+		m.treeState.Set(m.files)
+	} else {
+		m.treeState.Add(m.files[listed:]...)
+	}
+	m.fileList.SetItems(m.treeState.Items())
+	if listed == 0 && m.keepPath == "" {
+		m.selectFirstFile()
+	} else if m.keepSelection(path, index) {
+		m.keepPath = ""
+	}
+}
+
+// handleBatch applies a chunk of the batch diff and asks for the next.
+func (m Model) handleBatch(msg batchMsg) (Model, tea.Cmd) {
+	if msg.id != m.reqs.batch.id {
+		return m, nil
+	}
+	waiting, selected := m.keepPath != "", m.selectedPath
+	m.addSections(msg.sections, msg.opts)
+	if msg.done && len(m.files) == 0 {
+		// Nothing is left; clear what a reload kept on screen.
+		m.setFiles(nil)
+	}
+
+	var load bool
+	switch {
+	case waiting && m.keepPath == "":
+		// The file selected before the reload is back.
+		load = true
+	case msg.done && m.keepPath != "":
+		// It is gone.
+		m.keepPath = ""
+		load = true
+	case m.keepPath == "":
+		load = m.selectedPath != selected
+	}
+	var cmds []tea.Cmd
+	if load && m.selectedPath != "" {
+		cmds = append(cmds, m.loadDiffCmd())
+	}
+	if msg.err != nil {
+		if len(m.files) == 0 {
+			m.loadErr = msg.err
+		}
+		cmds = append(cmds, m.notify(fmt.Errorf("batch diff: %w", msg.err)))
+	}
+	if !msg.done {
+		return m, tea.Batch(append(cmds, nextBatchCmd(msg.next, msg.id, msg.opts))...)
+	}
+
+	m.reqs.batch.finish(msg.id)
+	m.streaming, m.reloading = false, false
+	if !sameWhitespace(msg.opts, m.diffOpts) {
+		// Whitespace was toggled while streaming; count again.
+		cmds = append(cmds, m.fetchStatsCmd(m.targetBranch))
+	} else {
+		m.updateWhitespaceOnly()
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// renderProgress describes how much of the batch diff has been read.
+func (m Model) renderProgress() string {
+	return fmt.Sprintf("loading… %d files, %.1f MB", len(m.files), float64(m.streamed)/(1<<20))
+}
@@ -0,0 +1,207 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/lfs"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// BinaryMsg carries what is known about a binary change to the selected
+// file. Hex is the hex-dump diff, empty when the file is too large or its
+// contents are not available.
+type BinaryMsg struct {
+	Path     string
+	Old, New diff.BlobInfo
+	Hex      string
+	// LFS is set when the file is a Git LFS pointer; Old and New then
+	// describe the objects it points to.
+	LFS *lfs.Change
+}
+
+// loadBinaryCmd describes the binary change of the selected file. A piped
+// diff only carries what git printed, so sizes come from the binary patch
+// when there is one.
+func (m Model) loadBinaryCmd(content string) tea.Cmd {
+	path := m.selectedPath
+	if m.piped() {
+		return func() tea.Msg {
+			msg := BinaryMsg{Path: path}
+			if oldSize, newSize, ok := diff.PatchSizes(content); ok {
+				msg.Old.Size, msg.New.Size = oldSize, newSize
+			}
+			msg.Old.Missing = strings.Contains(content, "new file mode")
+			msg.New.Missing = strings.Contains(content, "deleted file mode")
+			return msg
+		}
+	}
+
+	oldPath := m.renames[path].From
+	opts := m.diffOpts
+	// Loading the contents continues the diff request, so selecting
+	// another file cancels it too.
+	_, ctx := m.reqs.diff.start(m.reqs.diffTimeout)
+	return func() tea.Msg {
+		f, err := m.vcs.FileContents(ctx, m.targetBranch, path, oldPath)
+		if err != nil {
+			return BinaryMsg{Path: path}
+		}
+		msg := BinaryMsg{Path: path, Old: diff.Describe(f.Old), New: diff.Describe(f.New)}
+		if len(f.Old) <= diff.HexDumpLimit && len(f.New) <= diff.HexDumpLimit {
+			msg.Hex = diff.HexDiff(f.Old, f.New, opts)
+		}
+		return msg
+	}
+}
+
+// loadLFSCmd describes the objects behind a changed LFS pointer, reading
+// them from the local LFS cache when they have been downloaded.
+func (m Model) loadLFSCmd(change lfs.Change) tea.Cmd {
+	path := m.selectedPath
+	store, _ := m.vcs.(vcs.LFS)
+	opts := m.diffOpts
+	return func() tea.Msg {
+		msg := BinaryMsg{Path: path, LFS: &change}
+		side := func(p *lfs.Pointer) ([]byte, diff.BlobInfo) {
+			if p == nil {
+				return nil, diff.Describe(nil)
+			}
+			if store != nil {
+				if data, err := store.LFSObject(p.OID); err == nil && data != nil {
+					return data, diff.Describe(data)
+				}
+			}
+			return nil, diff.BlobInfo{Size: int(p.Size)}
+		}
+		oldData, oldInfo := side(change.Old)
+		newData, newInfo := side(change.New)
+		msg.Old, msg.New = oldInfo, newInfo
+
+		if oldInfo.Known && newInfo.Known && len(oldData) <= diff.HexDumpLimit && len(newData) <= diff.HexDumpLimit {
+			msg.Hex = diff.HexDiff(oldData, newData, opts)
+		}
+		return msg
+	}
+}
+
+// isBinarySelected reports whether the binary summary applies to the
+// selected file.
+func (m Model) isBinarySelected() bool {
+	return m.binary != nil && m.binary.Path == m.selectedPath
+}
+
+// renderBinarySummary shows sizes, types and image dimensions of both
+// sides of a binary change in place of the diff.
+func (m Model) renderBinarySummary(w, h int) string {
+	b := m.binary
+	label := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Width(8)
+	cell := lipgloss.NewStyle().Foreground(ColorText).Width(18)
+
+	row := func(name, old, new string) string {
+		return lipgloss.JoinHorizontal(lipgloss.Left, label.Render(name), cell.Render(old), cell.Render(new))
+	}
+
+	title := "Binary file changed"
+	if b.LFS != nil {
+		title = "LFS object changed: " + lfsSummary(*b.LFS)
+	}
+	rows := []string{
+		EmptyHeaderStyle.Render(title),
+		row("", "Old", "New"),
+		row("Size", formatBlobSize(b.Old), formatBlobSize(b.New)+sizeDelta(b.Old, b.New)),
+	}
+	if b.Old.MIME != "" || b.New.MIME != "" {
+		rows = append(rows, row("Type", blobField(b.Old, b.Old.MIME), blobField(b.New, b.New.MIME)))
+	}
+	if b.Old.Width > 0 || b.New.Width > 0 {
+		rows = append(rows, row("Image", dimensions(b.Old), dimensions(b.New)))
+	}
+
+	hint := "Contents not available"
+	switch {
+	case b.LFS != nil && !(b.Old.Known && b.New.Known):
+		hint = "Object not in the local LFS cache"
+	case b.Hex != "":
+		hint = "Press x for a hex-dump diff"
+	case b.Old.Known || b.New.Known:
+		hint = fmt.Sprintf("Too large for a hex dump (over %s)", formatSize(diff.HexDumpLimit))
+	}
+	rows = append(rows, "", EmptyCodeStyle.Render(hint))
+
+	return lipgloss.Place(w, h, lipgloss.Center, lipgloss.Center, lipgloss.JoinVertical(lipgloss.Left, rows...))
+}
+
+// lfsSummary reads "old size → new size, oid old… → new…".
+func lfsSummary(c lfs.Change) string {
+	size := func(p *lfs.Pointer) string {
+		if p == nil {
+			return "—"
+		}
+		return formatSize(int(p.Size))
+	}
+	oid := func(p *lfs.Pointer) string {
+		if p == nil {
+			return "—"
+		}
+		return lfs.ShortOID(p.OID)
+	}
+	return fmt.Sprintf("%s → %s, oid %s → %s", size(c.Old), size(c.New), oid(c.Old), oid(c.New))
+}
+
+func formatBlobSize(b diff.BlobInfo) string {
+	switch {
+	case b.Missing:
+		return "—"
+	case !b.Known && b.Size == 0:
+		return "?"
+	}
+	return formatSize(b.Size)
+}
+
+func sizeDelta(old, new diff.BlobInfo) string {
+	if old.Missing || new.Missing || (!old.Known && old.Size == 0) {
+		return ""
+	}
+	d := new.Size - old.Size
+	switch {
+	case d > 0:
+		return " (+" + formatSize(d) + ")"
+	case d < 0:
+		return " (-" + formatSize(-d) + ")"
+	}
+	return ""
+}
+
+func blobField(b diff.BlobInfo, v string) string {
+	if b.Missing || v == "" {
+		return "—"
+	}
+	// Drop parameters such as "; charset=utf-8".
+	v, _, _ = strings.Cut(v, ";")
+	return v
+}
+
+func dimensions(b diff.BlobInfo) string {
+	if b.Width == 0 {
+		return "—"
+	}
+	return fmt.Sprintf("%d×%d", b.Width, b.Height)
+}
+
+// formatSize prints a byte count with a binary unit.
+func formatSize(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
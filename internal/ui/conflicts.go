@@ -0,0 +1,208 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/oug-t/difi/internal/config"
+	"github.com/oug-t/difi/internal/conflict"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// ConflictMsg carries the contents and conflict blocks of an unmerged file.
+type ConflictMsg struct {
+	Path   string
+	Data   []byte
+	Blocks []conflict.Block
+	Err    error
+}
+
+// NewConflictModel opens difi in conflicts mode: the tree lists the
+// unmerged paths of an interrupted merge or rebase, and the right pane
+// shows each conflict as ours/base/theirs.
+func NewConflictModel(cfg config.Config, targetBranch string, vcsClient vcs.VCS) (Model, error) {
+	InitStyles(cfg)
+
+	c, ok := vcsClient.(vcs.Conflicts)
+	if !ok {
+		return Model{}, errors.New("conflicts mode needs a git or hg repository")
+	}
+	files, err := c.UnmergedFiles()
+	if err != nil {
+		return Model{}, err
+	}
+	m := newModel(cfg, targetBranch, "", vcsClient, files, nil)
+	m.conflictMode = true
+	m.startWatch(cfg)
+	return m, nil
+}
+
+func (m Model) loadConflictCmd() tea.Cmd {
+	c, ok := m.vcs.(vcs.Conflicts)
+	if !ok || m.selectedPath == "" {
+		return nil
+	}
+	path := m.selectedPath
+	return func() tea.Msg {
+		data, err := os.ReadFile(c.WorkingFile(path))
+		if err != nil {
+			return ConflictMsg{Path: path, Err: err}
+		}
+		return ConflictMsg{Path: path, Data: data, Blocks: parseConflicts(c, path, data)}
+	}
+}
+
+// parseConflicts finds the conflict blocks of path, filling in the base the
+// default two-way markers leave out from the merge's common ancestor.
+func parseConflicts(c vcs.Conflicts, path string, data []byte) []conflict.Block {
+	blocks := conflict.Parse(data)
+	for _, b := range blocks {
+		if b.HasBase {
+			continue
+		}
+		if base, err := c.MergeBase(path); err == nil && base != nil {
+			conflict.FillBase(blocks, data, base)
+		}
+		break
+	}
+	return blocks
+}
+
+// updateConflicts handles the keys of conflicts mode. handled is false for
+// keys left to the regular bindings.
+func (m Model) updateConflicts(key string) (Model, tea.Cmd, bool) {
+	c, ok := m.vcs.(vcs.Conflicts)
+	if !ok || m.conflict == nil || m.conflict.Path != m.selectedPath {
+		return m, nil, false
+	}
+	blocks := m.conflict.Blocks
+
+	switch key {
+	case "n":
+		if m.conflictIdx < len(blocks)-1 {
+			m.conflictIdx++
+		}
+	case "p":
+		if m.conflictIdx > 0 {
+			m.conflictIdx--
+		}
+	case "o", "t", "b":
+		if len(blocks) == 0 {
+			return m, nil, true
+		}
+		choice := map[string]conflict.Choice{"o": conflict.Ours, "t": conflict.Theirs, "b": conflict.Both}[key]
+		data := conflict.Resolve(m.conflict.Data, m.conflictIdx, choice)
+		if err := conflict.Write(c.WorkingFile(m.selectedPath), data); err != nil {
+			m.conflictNote = "Write failed: " + err.Error()
+			return m, nil, true
+		}
+		m.conflict = &ConflictMsg{Path: m.selectedPath, Data: data, Blocks: parseConflicts(c, m.selectedPath, data)}
+		if m.conflictIdx >= len(m.conflict.Blocks) && m.conflictIdx > 0 {
+			m.conflictIdx--
+		}
+		m.conflictNote = ""
+	case "m":
+		if left := len(blocks); left > 0 {
+			m.conflictNote = fmt.Sprintf("%d conflict(s) left in %s", left, m.selectedPath)
+			return m, nil, true
+		}
+		if err := c.MarkResolved(m.selectedPath); err != nil {
+			m.conflictNote = err.Error()
+			return m, nil, true
+		}
+		m.conflictNote = "Marked " + m.selectedPath + " resolved"
+		files, err := c.UnmergedFiles()
+		if err != nil {
+			m.conflictNote = err.Error()
+			return m, nil, true
+		}
+		m.setFiles(files)
+		return m, m.loadDiffCmd(), true
+	default:
+		return m, nil, false
+	}
+	return m, nil, true
+}
+
+// renderConflict shows the current block as three panes: ours, the base
+// from diff3 markers or the merge's common ancestor, and theirs.
+func (m Model) renderConflict(w, h int) string {
+	cm := m.conflict
+	if cm.Err != nil {
+		return m.renderEmptyState(w, h, "Cannot read "+cm.Path+": "+cm.Err.Error())
+	}
+	help := EmptyCodeStyle.Render("o ours  t theirs  b both  n/p next/prev  m mark resolved")
+	note := ""
+	if m.conflictNote != "" {
+		note = EmptyStatusStyle.Copy().MarginBottom(0).Render(m.conflictNote)
+	}
+	if len(cm.Blocks) == 0 {
+		msg := EmptyHeaderStyle.Render("No conflict markers left in " + cm.Path)
+		hint := EmptyCodeStyle.Render("Press m to mark it resolved")
+		return lipgloss.Place(w, h, lipgloss.Center, lipgloss.Center, lipgloss.JoinVertical(lipgloss.Center, msg, hint, note))
+	}
+
+	idx := m.conflictIdx
+	if idx >= len(cm.Blocks) {
+		idx = len(cm.Blocks) - 1
+	}
+	b := cm.Blocks[idx]
+
+	header := EmptyHeaderStyle.Copy().MarginBottom(0).Render(
+		fmt.Sprintf("Conflict %d/%d · lines %d-%d", idx+1, len(cm.Blocks), b.Start+1, b.End))
+
+	paneH := h - 4
+	if paneH < 3 {
+		paneH = 3
+	}
+	paneW := (w - 2) / 3
+	base := b.Base
+	if !b.HasBase {
+		base = []string{"No common ancestor\n", "to show.\n"}
+	}
+	panes := lipgloss.JoinHorizontal(lipgloss.Top,
+		conflictPane(labelled("Ours", b.OursLabel), b.Ours, paneW, paneH, nord11),
+		conflictPane("Base", base, paneW, paneH, nord3),
+		conflictPane(labelled("Theirs", b.TheirsLabel), b.Theirs, paneW, paneH, nord14),
+	)
+
+	footer := help
+	if note != "" {
+		footer = lipgloss.JoinHorizontal(lipgloss.Top, help, "  ", note)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, header, panes, footer)
+}
+
+func labelled(side, label string) string {
+	if label == "" {
+		return side
+	}
+	return side + " (" + label + ")"
+}
+
+func conflictPane(title string, lines []string, w, h int, color lipgloss.Color) string {
+	inner := w - 2
+	if inner < 1 {
+		inner = 1
+	}
+	rows := []string{lipgloss.NewStyle().Foreground(color).Bold(true).Render(ansi.Truncate(title, inner, "…"))}
+	for i, line := range lines {
+		if len(rows) >= h-2 {
+			rows = append(rows, EmptyCodeStyle.Render(fmt.Sprintf("… %d more", len(lines)-i)))
+			break
+		}
+		line = strings.ReplaceAll(strings.TrimRight(line, "\r\n"), "\t", "    ")
+		rows = append(rows, ansi.Truncate(line, inner, "…"))
+	}
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(color).
+		Width(inner).
+		Height(h - 2).
+		Render(strings.Join(rows, "\n"))
+}
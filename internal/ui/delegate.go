@@ -10,12 +10,16 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/x/ansi"
 	"github.com/oug-t/difi/internal/config"
+	"github.com/oug-t/difi/internal/diff"
 	"github.com/oug-t/difi/internal/tree"
 )
 
 type TreeDelegate struct {
 	Config  config.Config
 	Focused bool
+	Dimmed  map[string]bool // paths rendered muted, e.g. whitespace-only changes
+	Renames map[string]diff.Rename
+	LFS     map[string]bool // paths tracked by Git LFS
 }
 
 func (d TreeDelegate) Height() int  { return 1 }
@@ -47,6 +51,12 @@ func (d TreeDelegate) Render(w io.Writer, m list.Model, index int, item list.Ite
 	}
 
 	title := i.Title()
+	if r, ok := d.Renames[i.FullPath]; ok && !i.IsDir {
+		title += renameBadge(r)
+	}
+	if d.LFS[i.FullPath] && !i.IsDir {
+		title += " LFS"
+	}
 	maxWidth := m.Width() - 2
 	if maxWidth < 4 {
 		maxWidth = 4
@@ -66,9 +76,26 @@ func (d TreeDelegate) Render(w io.Writer, m list.Model, index int, item list.Ite
 
 		fmt.Fprint(w, style.Render(title))
 	} else {
+		fg := lipgloss.Color("252")
+		if d.Dimmed[i.FullPath] {
+			fg = lipgloss.Color("240")
+		}
 		style := lipgloss.NewStyle().
-			Foreground(lipgloss.Color("252")).
+			Foreground(fg).
 			Width(maxWidth)
 		fmt.Fprint(w, style.Render(title))
 	}
 }
+
+// renameBadge marks a renamed or copied file with its similarity, the way
+// git status abbreviates them: " R87%" or " C75%".
+func renameBadge(r diff.Rename) string {
+	kind := "R"
+	if r.Copy {
+		kind = "C"
+	}
+	if r.Similarity == 0 {
+		return " " + kind
+	}
+	return fmt.Sprintf(" %s%d%%", kind, r.Similarity)
+}
@@ -1,9 +1,8 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
-	"math"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -14,8 +13,15 @@ import (
 	"github.com/charmbracelet/x/ansi"
 
 	"github.com/oug-t/difi/internal/config"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/diffcache"
+	"github.com/oug-t/difi/internal/diffview"
+	"github.com/oug-t/difi/internal/lfs"
+	"github.com/oug-t/difi/internal/mbox"
+	"github.com/oug-t/difi/internal/pipe"
 	"github.com/oug-t/difi/internal/tree"
 	"github.com/oug-t/difi/internal/vcs"
+	"github.com/oug-t/difi/internal/watch"
 )
 
 type Focus int
@@ -25,13 +31,24 @@ const (
 	FocusDiff
 )
 
-// ansiRe matches ANSI escape sequences for stripping from terminal output.
-var ansiRe = regexp.MustCompile("[\u001B\u009B][[\\]()#;?]*(?:(?:(?:[a-zA-Z\\d]*(?:;[a-zA-Z\\d]*)*)?\u0007)|(?:(?:\\d{1,4}(?:;\\d{0,4})*)?[\\dA-PRZcf-ntqry=><~]))")
-
 type StatsMsg struct {
 	Added   int
 	Deleted int
 	ByFile  map[string][2]int
+	// Renames is only set for piped diffs, where renames are read off the
+	// "rename from"/"copy from" headers.
+	Renames map[string]diff.Rename
+	// Binary holds the changed files that are binary.
+	Binary map[string]bool
+	// LFS holds the changed files tracked by Git LFS.
+	LFS map[string]bool
+	// Opts are the options the stats were computed with, so results of a
+	// whitespace toggle that has since been flipped again can be dropped.
+	Opts diff.Options
+	// Patch is the entry of a piped patch series the stats belong to.
+	Patch int
+	// ID is the stats request the message answers.
+	ID int
 }
 
 type Model struct {
@@ -53,37 +70,162 @@ type Model struct {
 
 	fileStats map[string][2]int // per-file [added, deleted]
 
-	diffContent string
-	diffLines   []string
-	diffCursor  int
+	files          []string
+	whitespaceOnly map[string]bool // files with nothing left once whitespace is ignored
+	renames        map[string]diff.Rename
+	binaryFiles    map[string]bool
+	lfsFiles       map[string]bool
+	binary         *BinaryMsg    // summary of the selected file, when binary
+	submodule      *SubmoduleMsg // summary of the selected file, when a submodule
+	showHex        bool
+
+	conflictMode bool
+	conflict     *ConflictMsg // conflict blocks of the selected file
+	conflictIdx  int
+	conflictNote string
+
+	diff       diffview.Diff
+	diffCursor int
 
-	inputBuffer string
-	pendingZ    bool
+	inputBuffer   string
+	pendingZ      bool
+	pendingIgnore bool
 
 	focus    Focus
 	showHelp bool
+	showLog  bool // message log drawer
+
+	notices []notice // message log, oldest first
+	toast   *notice
+	toastID int
+	loadErr error // listing the changed files failed
+	diffErr error // loading the selected file's diff failed
 
 	width, height int
 
 	pipedDiff string
+	stdin     *pipe.Diff // a piped diff read while it arrives, instead of pipedDiff
 	vcs       vcs.VCS
+	diffOpts  diff.Options
+	reqs      *requests
+	cache     *diffcache.Cache // diffs of visited and prefetched files
+	batch     bool             // files, stats and diffs come from one streamed diff
+	streaming bool             // the batch diff is still being read
+	listed    map[string]bool  // files the batch diff has listed
+	streamed  int              // bytes of the batch diff read so far
+
+	watcher   *watch.Watcher // edits to the working tree, nil without live reload
+	reloading bool           // a reload's listing is on its way
+	restore   *diffPos       // where to scroll the reloaded diff
+	keepPath  string         // entry to select again once a reload streams it
+	keepIndex int            // where to select if keepPath is gone
+
+	series    []mbox.Patch // patches of a piped mbox or format-patch series
+	seriesIdx int          // 0 shows the whole series, i shows patch i
+	// seriesFiles lists the patches that change each file, for the whole
+	// series view, which shows them one after another.
+	seriesFiles map[string][]int
+}
+
+// diffOptions turns the diff section of the config into engine options.
+// An unknown algorithm falls back to Myers, like other invalid settings.
+func diffOptions(cfg config.Config) diff.Options {
+	algo, _ := diff.ParseAlgorithm(cfg.Diff.Algorithm)
+	return diff.Options{
+		Builtin:   cfg.Diff.Engine == "builtin",
+		Algorithm: algo,
+		Context:   cfg.Diff.Context,
+		WordDiff:  cfg.Diff.WordDiff,
+
+		IgnoreAllSpace:    cfg.Diff.IgnoreAllSpace,
+		IgnoreSpaceChange: cfg.Diff.IgnoreSpaceChange,
+		IgnoreBlankLines:  cfg.Diff.IgnoreBlankLines,
+		IgnoreCRAtEOL:     cfg.Diff.IgnoreCRAtEOL,
+
+		RenameThreshold: cfg.Diff.RenameThreshold,
+		FindCopies:      cfg.Diff.Copies,
+	}
+}
+
+// sameWhitespace reports whether two option sets ignore the same
+// whitespace, which is all that affects stats.
+func sameWhitespace(a, b diff.Options) bool {
+	return a.IgnoreAllSpace == b.IgnoreAllSpace &&
+		a.IgnoreSpaceChange == b.IgnoreSpaceChange &&
+		a.IgnoreBlankLines == b.IgnoreBlankLines &&
+		a.IgnoreCRAtEOL == b.IgnoreCRAtEOL
 }
 
 func NewModel(cfg config.Config, targetBranch string, pipedDiff string, vcsClient vcs.VCS) Model {
 	InitStyles(cfg)
 
+	opts := diffOptions(cfg)
 	var files []string
-	if pipedDiff != "" {
+	var renames map[string]diff.Rename
+	var series []mbox.Patch
+	var err error
+	if mbox.IsSeries(pipedDiff) {
+		series = mbox.Parse(pipedDiff)
+		pipedDiff = mbox.Join(series)
+	}
+	_, canBatch := vcsClient.(vcs.Batch)
+	streaming := pipedDiff == "" && canBatch && cfg.Diff.Batch
+	switch {
+	case pipedDiff != "":
 		files = vcsClient.ParseFilesFromDiff(pipedDiff)
-	} else {
-		files, _ = vcsClient.ListChangedFiles(targetBranch)
+	case streaming:
+		// The files arrive with the batch diff Init starts.
+	default:
+		ctx, cancel := withTimeout(cfg.Timeouts.Stats)
+		files, err = vcsClient.ListChangedFiles(ctx, targetBranch, opts)
+		if err == nil {
+			// Needed before the first diff is loaded, since a renamed file
+			// is diffed against its old path.
+			renames, err = vcsClient.RenamesByFile(ctx, targetBranch, opts)
+		}
+		err = vcs.Classify(ctx, err)
+		cancel()
+	}
+	m := newModel(cfg, targetBranch, pipedDiff, vcsClient, files, renames)
+	m.series = series
+	if series != nil {
+		m.seriesFiles = mbox.Files(series)
+	}
+	m.batch, m.streaming = streaming, streaming
+	if err != nil {
+		m.loadErr = err
+		m.notify(err)
+	}
+	if pipedDiff == "" && !errors.Is(err, vcs.ErrNotRepository) {
+		m.startWatch(cfg)
 	}
+	return m
+}
+
+// NewPipeModel reviews a git or hg diff that is still being piped in.
+// Files appear in the tree as their sections arrive.
+func NewPipeModel(cfg config.Config, targetBranch string, d *pipe.Diff, vcsClient vcs.VCS) Model {
+	InitStyles(cfg)
+	m := newModel(cfg, targetBranch, "", vcsClient, nil, nil)
+	m.stdin = d
+	m.streaming = true
+	return m
+}
+
+// piped reports whether the diff was piped in rather than taken from the
+// VCS, so it cannot be recomputed with other options.
+func (m Model) piped() bool {
+	return m.pipedDiff != "" || m.stdin != nil
+}
+
+func newModel(cfg config.Config, targetBranch, pipedDiff string, vcsClient vcs.VCS, files []string, renames map[string]diff.Rename) Model {
 	t := tree.New(files)
 	items := t.Items()
 
 	delegate := TreeDelegate{
 		Config:  cfg,
 		Focused: true,
+		Renames: renames,
 	}
 
 	l := list.New(items, delegate, 0, 0)
@@ -109,6 +251,11 @@ func NewModel(cfg config.Config, targetBranch string, pipedDiff string, vcsClien
 		pendingZ:      false,
 		pipedDiff:     pipedDiff,
 		vcs:           vcsClient,
+		diffOpts:      diffOptions(cfg),
+		reqs:          &requests{diffTimeout: cfg.Timeouts.Diff, statsTimeout: cfg.Timeouts.Stats},
+		cache:         diffcache.New(diffCacheBytes),
+		files:         files,
+		renames:       renames,
 	}
 
 	// Find the first file (not directory) to select initially
@@ -126,71 +273,121 @@ func (m Model) Init() tea.Cmd {
 	var cmds []tea.Cmd
 
 	if m.selectedPath != "" {
-		if m.pipedDiff != "" {
-			cmds = append(cmds, func() tea.Msg {
-				return vcs.DiffMsg{Content: m.vcs.ExtractFileDiff(m.pipedDiff, m.selectedPath)}
-			})
-		} else {
-			cmds = append(cmds, m.vcs.DiffCmd(m.targetBranch, m.selectedPath))
-		}
+		cmds = append(cmds, m.loadDiffCmd())
+	}
+	if m.toast != nil {
+		cmds = append(cmds, m.expireToastCmd())
+	}
+	if m.watcher != nil {
+		cmds = append(cmds, waitWatchCmd(m.watcher))
 	}
 
-	if m.pipedDiff == "" {
+	switch {
+	case m.conflictMode:
+		// Stats against the target say nothing about conflicts.
+	case m.loadErr != nil:
+		// They would fail the same way.
+	case m.streaming:
+		cmds = append(cmds, m.streamCmd())
+	case m.pipedDiff == "":
 		cmds = append(cmds, m.fetchStatsCmd(m.targetBranch))
-	} else {
+	default:
 		cmds = append(cmds, m.computePipedStatsCmd())
 	}
 
 	return tea.Batch(cmds...)
 }
 
+// loadDiffCmd fetches the diff of the selected file, either from the piped
+// input or from the VCS. It cancels the diff still loading for the previous
+// selection, whose reply would be dropped anyway.
+func (m Model) loadDiffCmd() tea.Cmd {
+	if m.conflictMode {
+		return m.loadConflictCmd()
+	}
+	id, ctx := m.reqs.diff.start(m.reqs.diffTimeout)
+	path := m.selectedPath
+	if m.stdin != nil {
+		return func() tea.Msg {
+			return vcs.DiffMsg{Content: m.stdin.File(path), Path: path, ID: id}
+		}
+	}
+	if m.pipedDiff != "" {
+		return func() tea.Msg {
+			return vcs.DiffMsg{Content: m.vcs.ExtractFileDiff(m.pipedDiff, path), Path: path, ID: id}
+		}
+	}
+	key, cacheable := m.diffKey(path)
+	if cacheable {
+		if content, ok := m.cache.Get(key); ok {
+			return func() tea.Msg { return vcs.DiffMsg{Content: content, Path: path, ID: id} }
+		}
+	}
+	load := m.vcs.DiffCmd(ctx, m.targetBranch, path, m.renames[path].From, m.diffOpts)
+	return func() tea.Msg {
+		msg := load()
+		if canceled(ctx) {
+			return nil
+		}
+		if d, ok := msg.(vcs.DiffMsg); ok {
+			d.ID = id
+			if d.Err != nil {
+				d.Err = fmt.Errorf("diff of %s: %w", path, vcs.Classify(ctx, d.Err))
+			} else if cacheable {
+				m.cache.Put(key, d.Content)
+			}
+			return d
+		}
+		return msg
+	}
+}
+
 func (m Model) fetchStatsCmd(target string) tea.Cmd {
+	id, ctx := m.reqs.stats.start(m.reqs.statsTimeout)
 	return func() tea.Msg {
-		added, deleted, err := m.vcs.DiffStats(target)
-		if err != nil {
+		s, err := m.vcs.Stats(ctx, target, m.diffOpts)
+		switch {
+		case canceled(ctx):
 			return nil
+		case err != nil:
+			return ErrorMsg{Err: fmt.Errorf("stats: %w", vcs.Classify(ctx, err))}
 		}
-		byFile, _ := m.vcs.DiffStatsByFile(target)
-		return StatsMsg{Added: added, Deleted: deleted, ByFile: byFile}
+		var lfsFiles map[string]bool
+		if l, ok := m.vcs.(vcs.LFS); ok {
+			lfsFiles, _ = l.LFSFiles(m.files)
+		}
+		return StatsMsg{Added: s.Added, Deleted: s.Deleted, ByFile: s.ByFile, Binary: s.Binary, LFS: lfsFiles, Opts: m.diffOpts, ID: id}
 	}
 }
 
 func (m Model) computePipedStatsCmd() tea.Cmd {
+	id, _ := m.reqs.stats.start(0)
 	return func() tea.Msg {
 		byFile := make(map[string][2]int)
+		renames := make(map[string]diff.Rename)
+		binary := make(map[string]bool)
+		lfsFiles := make(map[string]bool)
 		var totalAdded, totalDeleted int
-		var currentFile string
-
-		for _, line := range strings.Split(m.pipedDiff, "\n") {
-			clean := stripAnsi(line)
-			if strings.HasPrefix(clean, "diff --git ") {
-				// git format: "diff --git a/path b/path"
-				parts := strings.Fields(clean)
-				if len(parts) >= 4 {
-					currentFile = strings.TrimPrefix(parts[3], "b/")
-				}
-			} else if strings.HasPrefix(clean, "diff -r ") {
-				// hg format: "diff -r <rev> <file>" or "diff -r <rev1> -r <rev2> <file>"
-				// The file path is always the last whitespace-separated field.
-				parts := strings.Fields(clean)
-				if len(parts) >= 3 {
-					currentFile = parts[len(parts)-1]
-				}
-			} else if currentFile != "" {
-				if strings.HasPrefix(clean, "+") && !strings.HasPrefix(clean, "+++") {
-					s := byFile[currentFile]
-					s[0]++
-					byFile[currentFile] = s
-					totalAdded++
-				} else if strings.HasPrefix(clean, "-") && !strings.HasPrefix(clean, "---") {
-					s := byFile[currentFile]
-					s[1]++
-					byFile[currentFile] = s
-					totalDeleted++
-				}
+		_ = diff.ReadSections(strings.NewReader(m.pipedDiff), func(s diff.Section) error {
+			// A series shown whole can touch a file in several patches.
+			if s.Added > 0 || s.Deleted > 0 {
+				st := byFile[s.Path]
+				byFile[s.Path] = [2]int{st[0] + s.Added, st[1] + s.Deleted}
 			}
-		}
-		return StatsMsg{Added: totalAdded, Deleted: totalDeleted, ByFile: byFile}
+			totalAdded += s.Added
+			totalDeleted += s.Deleted
+			if s.Rename.From != "" {
+				renames[s.Path] = s.Rename
+			}
+			if s.Binary {
+				binary[s.Path] = true
+			}
+			if s.LFS {
+				lfsFiles[s.Path] = true
+			}
+			return nil
+		})
+		return StatsMsg{Added: totalAdded, Deleted: totalDeleted, ByFile: byFile, Renames: renames, Binary: binary, LFS: lfsFiles, Opts: m.diffOpts, Patch: m.seriesIdx, ID: id}
 	}
 }
 
@@ -219,17 +416,45 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.updateSizes()
 
 	case StatsMsg:
+		if msg.ID != m.reqs.stats.id || !sameWhitespace(msg.Opts, m.diffOpts) || msg.Patch != m.seriesIdx {
+			return m, nil
+		}
+		m.reqs.stats.finish(msg.ID)
 		m.statsAdded = msg.Added
 		m.statsDeleted = msg.Deleted
 		if msg.ByFile != nil {
 			m.fileStats = msg.ByFile
 		}
+		if msg.Renames != nil {
+			m.renames = msg.Renames
+			m.treeDelegate.Renames = m.renames
+		}
+		if msg.Binary != nil {
+			m.binaryFiles = msg.Binary
+		}
+		if msg.LFS != nil {
+			m.lfsFiles = msg.LFS
+			m.treeDelegate.LFS = m.lfsFiles
+		}
+		m.updateWhitespaceOnly()
 
 	case tea.KeyMsg:
 		if msg.String() == "q" || msg.String() == "ctrl+c" {
+			m.stopWatch()
 			return m, tea.Quit
 		}
 
+		// The log stays reachable when listing the files failed.
+		if msg.String() == "@" {
+			m.showLog, m.showHelp = !m.showLog, false
+			m.updateSizes()
+			return m, nil
+		}
+		// So does reloading, which may find changes that were not there.
+		if msg.String() == "R" {
+			return m, m.reload()
+		}
+
 		if len(m.fileList.Items()) == 0 {
 			return m, nil
 		}
@@ -253,17 +478,53 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
+		if m.pendingIgnore {
+			m.pendingIgnore = false
+			switch msg.String() {
+			case "w":
+				m.diffOpts.IgnoreAllSpace = !m.diffOpts.IgnoreAllSpace
+			case "b":
+				m.diffOpts.IgnoreSpaceChange = !m.diffOpts.IgnoreSpaceChange
+			case "B":
+				m.diffOpts.IgnoreBlankLines = !m.diffOpts.IgnoreBlankLines
+			case "r":
+				m.diffOpts.IgnoreCRAtEOL = !m.diffOpts.IgnoreCRAtEOL
+			default:
+				return m, nil
+			}
+			if m.streaming {
+				// The stats are counted again once the batch diff is in.
+				return m, m.loadDiffCmd()
+			}
+			return m, tea.Batch(m.loadDiffCmd(), m.fetchStatsCmd(m.targetBranch))
+		}
+
 		if len(msg.String()) == 1 && strings.ContainsAny(msg.String(), "0123456789") {
 			m.inputBuffer += msg.String()
 			return m, nil
 		}
 
 		if msg.String() == "?" {
-			m.showHelp = !m.showHelp
+			m.showHelp, m.showLog = !m.showHelp, false
 			m.updateSizes()
 			return m, nil
 		}
 
+		if m.conflictMode {
+			if next, cmd, handled := m.updateConflicts(msg.String()); handled {
+				return next, cmd
+			}
+		}
+
+		if len(m.series) > 0 {
+			switch msg.String() {
+			case "n":
+				return m, m.selectPatch(m.seriesIdx + 1)
+			case "p":
+				return m, m.selectPatch(m.seriesIdx - 1)
+			}
+		}
+
 		switch msg.String() {
 		case "tab":
 			if m.focus == FocusTree {
@@ -300,12 +561,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 			}
+			// A submodule has nothing to edit; drill into it instead.
+			if c, ok := m.selectedSubmodule(); ok {
+				return m, m.openSubmoduleCmd(c)
+			}
 			if m.selectedPath != "" {
-				line := 0
+				line := m.diff.FileLine(0)
 				if m.focus == FocusDiff {
-					line = m.vcs.CalculateFileLine(m.diffContent, m.diffCursor)
-				} else {
-					line = m.vcs.CalculateFileLine(m.diffContent, 0)
+					line = m.diff.FileLine(m.diffCursor)
 				}
 				return m, m.vcs.OpenEditorCmd(m.selectedPath, line, m.targetBranch, m.treeDelegate.Config.Editor)
 			}
@@ -316,16 +579,42 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 
-				line := 0
+				line := m.diff.FileLine(0)
 				if m.focus == FocusDiff {
-					line = m.vcs.CalculateFileLine(m.diffContent, m.diffCursor)
-				} else {
-					line = m.vcs.CalculateFileLine(m.diffContent, 0)
+					line = m.diff.FileLine(m.diffCursor)
 				}
 				m.inputBuffer = ""
 				return m, m.vcs.OpenEditorCmd(m.selectedPath, line, m.targetBranch, m.treeDelegate.Config.Editor)
 			}
 
+		case "W":
+			// Word highlighting needs both versions of the file, which a
+			// piped diff does not carry.
+			if !m.piped() && !m.conflictMode && m.selectedPath != "" {
+				m.diffOpts.WordDiff = !m.diffOpts.WordDiff
+				m.inputBuffer = ""
+				return m, m.loadDiffCmd()
+			}
+
+		case "x":
+			// Toggle between the binary summary and its hex-dump diff.
+			if m.isBinarySelected() && m.binary.Hex != "" {
+				m.showHex = !m.showHex
+				if m.showHex {
+					m.setDiff(m.binary.Hex)
+				}
+				m.diffCursor = 0
+				return m, nil
+			}
+
+		case "i":
+			// Whitespace options need the VCS to recompute the diff; a piped
+			// diff is shown as-is.
+			if !m.piped() && !m.conflictMode {
+				m.pendingIgnore = true
+				return m, nil
+			}
+
 		case "z":
 			if m.focus == FocusDiff {
 				m.pendingZ = true
@@ -335,8 +624,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "H":
 			if m.focus == FocusDiff {
 				m.diffCursor = m.diffViewport.YOffset
-				if m.diffCursor >= len(m.diffLines) {
-					m.diffCursor = len(m.diffLines) - 1
+				if m.diffCursor >= m.diff.Len() {
+					m.diffCursor = m.diff.Len() - 1
 				}
 			}
 
@@ -344,16 +633,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.focus == FocusDiff {
 				half := m.diffViewport.Height / 2
 				m.diffCursor = m.diffViewport.YOffset + half
-				if m.diffCursor >= len(m.diffLines) {
-					m.diffCursor = len(m.diffLines) - 1
+				if m.diffCursor >= m.diff.Len() {
+					m.diffCursor = m.diff.Len() - 1
 				}
 			}
 
 		case "L":
 			if m.focus == FocusDiff {
 				m.diffCursor = m.diffViewport.YOffset + m.diffViewport.Height - 1
-				if m.diffCursor >= len(m.diffLines) {
-					m.diffCursor = len(m.diffLines) - 1
+				if m.diffCursor >= m.diff.Len() {
+					m.diffCursor = m.diff.Len() - 1
 				}
 			}
 
@@ -361,8 +650,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.focus == FocusDiff {
 				halfScreen := m.diffViewport.Height / 2
 				m.diffCursor += halfScreen
-				if m.diffCursor >= len(m.diffLines) {
-					m.diffCursor = len(m.diffLines) - 1
+				if m.diffCursor >= m.diff.Len() {
+					m.diffCursor = m.diff.Len() - 1
 				}
 				m.centerDiffCursor()
 			}
@@ -384,7 +673,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			count := m.getRepeatCount()
 			for i := 0; i < count; i++ {
 				if m.focus == FocusDiff {
-					if m.diffCursor < len(m.diffLines)-1 {
+					if m.diffCursor < m.diff.Len()-1 {
 						m.diffCursor++
 						if m.diffCursor >= m.diffViewport.YOffset+m.diffViewport.Height {
 							m.diffViewport.LineDown(1)
@@ -428,62 +717,84 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if !item.IsDir && item.FullPath != m.selectedPath {
 				m.selectedPath = item.FullPath
 				m.diffCursor = 0
+				m.restore = nil
 				m.diffViewport.GotoTop()
-				if m.pipedDiff != "" {
-					cmds = append(cmds, func() tea.Msg {
-						return vcs.DiffMsg{Content: m.vcs.ExtractFileDiff(m.pipedDiff, m.selectedPath)}
-					})
-				} else {
-					cmds = append(cmds, m.vcs.DiffCmd(m.targetBranch, m.selectedPath))
-				}
+				cmds = append(cmds, m.loadDiffCmd())
 			}
 		}
 	}
 
 	switch msg := msg.(type) {
 	case vcs.DiffMsg:
-		fullLines := strings.Split(msg.Content, "\n")
+		// A reply to a superseded request, for a file no longer selected
+		// or with options since changed, would overwrite the current diff.
+		if msg.ID != m.reqs.diff.id || msg.Path != m.selectedPath {
+			return m, tea.Batch(cmds...)
+		}
+		m.reqs.diff.finish(msg.ID)
+		m.diffErr = msg.Err
+		m.setDiff(msg.Content)
+		m.restoreDiffPos(msg.Path)
+		if msg.Err != nil {
+			return m, m.notify(msg.Err)
+		}
+		// The selected diff is in, so the neighbours may load now.
+		cmds = append(cmds, m.prefetchCmd())
+		if changes := m.submoduleChanges(msg.Content); len(changes) > 0 {
+			cmds = append(cmds, m.loadSubmoduleCmd(changes))
+		} else if change, ok := lfs.ParseDiff(diff.StripANSI(msg.Content)); ok {
+			cmds = append(cmds, m.loadLFSCmd(change))
+		} else if m.binaryFiles[m.selectedPath] || diff.IsBinaryDiff(msg.Content) {
+			cmds = append(cmds, m.loadBinaryCmd(msg.Content))
+		}
 
-		var cleanLines []string
-		var added, deleted int
-		foundHunk := false
+	case batchMsg:
+		return m.handleBatch(msg)
 
-		for _, line := range fullLines {
-			cleanLine := stripAnsi(line)
+	case filesMsg:
+		return m.handleFiles(msg)
 
-			if strings.HasPrefix(cleanLine, "@@") {
-				foundHunk = true
-			}
+	case watchMsg:
+		return m.handleWatch(msg)
 
-			if !foundHunk {
-				continue
+	case ConflictMsg:
+		if msg.Path == m.selectedPath {
+			if m.conflict == nil || m.conflict.Path != msg.Path {
+				m.conflictIdx = 0
+				m.conflictNote = ""
 			}
+			m.conflict = &msg
+		}
 
-			cleanLines = append(cleanLines, line)
+	case SubmoduleMsg:
+		if msg.Path == m.selectedPath {
+			m.submodule = &msg
+		}
 
-			if strings.HasPrefix(cleanLine, "+") && !strings.HasPrefix(cleanLine, "+++") {
-				added++
-			} else if strings.HasPrefix(cleanLine, "-") && !strings.HasPrefix(cleanLine, "---") {
-				deleted++
-			}
+	case BinaryMsg:
+		if msg.Path != m.selectedPath {
+			return m, nil
+		}
+		m.binary = &msg
+		if m.showHex && msg.Hex != "" {
+			m.setDiff(msg.Hex)
 		}
 
-		m.diffLines = cleanLines
-		m.currentFileAdded = added
-		m.currentFileDeleted = deleted
+	case vcs.EditorFinishedMsg:
+		// The editor may have saved other files too.
+		m.cache.Clear()
+		if msg.Err != nil {
+			return m, tea.Batch(m.notify(fmt.Errorf("editor: %w", msg.Err)), m.loadDiffCmd())
+		}
+		return m, m.loadDiffCmd()
 
-		newContent := strings.Join(cleanLines, "\n")
-		m.diffContent = newContent
-		m.diffViewport.SetContent(newContent)
-		m.diffViewport.GotoTop()
+	case ErrorMsg:
+		return m, m.notify(msg.Err)
 
-	case vcs.EditorFinishedMsg:
-		if m.pipedDiff != "" {
-			return m, func() tea.Msg {
-				return vcs.DiffMsg{Content: m.vcs.ExtractFileDiff(m.pipedDiff, m.selectedPath)}
-			}
+	case toastExpiredMsg:
+		if msg.id == m.toastID {
+			m.toast = nil
 		}
-		return m, m.vcs.DiffCmd(m.targetBranch, m.selectedPath)
 	}
 
 	return m, tea.Batch(cmds...)
@@ -500,7 +811,7 @@ func (m *Model) centerDiffCursor() {
 
 func (m *Model) updateSizes() {
 	reservedHeight := 2
-	if m.showHelp {
+	if m.showHelp || m.showLog {
 		reservedHeight += 6
 	}
 
@@ -521,14 +832,73 @@ func (m *Model) updateSizes() {
 		treeInnerWidth = 10
 	}
 
-	listHeight := contentHeight - 2
+	listHeight := contentHeight - 2 - m.seriesHeight()
 	if listHeight < 1 {
 		listHeight = 1
 	}
 	m.fileList.SetSize(treeInnerWidth, listHeight)
 
 	m.diffViewport.Width = m.width - treeWidth
-	m.diffViewport.Height = listHeight
+	m.diffViewport.Height = listHeight + m.seriesHeight()
+}
+
+// setDiff shows content in the diff pane, dropping the file headers before
+// the first hunk.
+func (m *Model) setDiff(content string) {
+	m.diff = diffview.New(content)
+	m.currentFileAdded = m.diff.Added
+	m.currentFileDeleted = m.diff.Deleted
+
+	// The pane draws its lines from the diff's index; the viewport only
+	// scrolls, so it is given as many empty lines rather than measuring
+	// every one.
+	m.diffViewport.SetContent(strings.Repeat("\n", max(m.diff.Len()-1, 0)))
+	m.diffViewport.GotoTop()
+}
+
+// setFiles replaces the listed files, selecting the first one.
+func (m *Model) setFiles(files []string) {
+	m.files = files
+	m.treeState = tree.New(files)
+	m.fileList.SetItems(m.treeState.Items())
+	m.selectFirstFile()
+}
+
+// updateFiles changes the listed files to files within the current tree,
+// so the directories still listed keep their expansion. The selection is
+// left to the caller.
+func (m *Model) updateFiles(files []string) {
+	m.files = files
+	m.treeState.Set(files)
+	m.fileList.SetItems(m.treeState.Items())
+}
+
+// selectFirstFile selects the first file in the tree.
+func (m *Model) selectFirstFile() {
+	m.selectedPath = ""
+	for idx, item := range m.fileList.Items() {
+		if ti, ok := item.(tree.TreeItem); ok && !ti.IsDir {
+			m.selectedPath = ti.FullPath
+			m.fileList.Select(idx)
+			break
+		}
+	}
+}
+
+// updateWhitespaceOnly dims the files whose changes disappear entirely
+// under the current whitespace options. The stats backends leave such files
+// out, so they are the listed files missing from fileStats.
+func (m *Model) updateWhitespaceOnly() {
+	m.whitespaceOnly = make(map[string]bool)
+	if !m.piped() && m.diffOpts.IgnoresWhitespace() && m.fileStats != nil {
+		for _, f := range m.files {
+			if _, ok := m.fileStats[f]; !ok {
+				m.whitespaceOnly[f] = true
+			}
+		}
+	}
+	m.treeDelegate.Dimmed = m.whitespaceOnly
+	m.fileList.SetDelegate(m.treeDelegate)
 }
 
 func (m *Model) updateTreeFocus() {
@@ -545,7 +915,7 @@ func (m Model) View() string {
 
 	var mainContent string
 	contentHeight := m.height - 2
-	if m.showHelp {
+	if m.showHelp || m.showLog {
 		contentHeight -= 6
 	}
 	if contentHeight < 0 {
@@ -553,7 +923,18 @@ func (m Model) View() string {
 	}
 
 	if len(m.fileList.Items()) == 0 {
-		mainContent = m.renderEmptyState(m.width, contentHeight, "No changes found against "+m.targetBranch)
+		status := "No changes found against " + m.targetBranch
+		if m.conflictMode {
+			status = "No unmerged files"
+		}
+		if m.loadErr != nil {
+			status = "Cannot list changes: " + m.loadErr.Error()
+		} else if m.stdin != nil && m.streaming {
+			status = "Reading the diff from stdin…"
+		} else if m.streaming {
+			status = "Loading changes against " + m.targetBranch + "…"
+		}
+		mainContent = m.renderEmptyState(m.width, contentHeight, status)
 	} else {
 		treeStyle := PaneStyle
 		if m.focus == FocusTree {
@@ -565,81 +946,37 @@ func (m Model) View() string {
 			Height(m.fileList.Height()).
 			MaxHeight(m.fileList.Height() + 2). // cap height: content + border
 			Render(m.fileList.View())
+		if len(m.series) > 0 {
+			treeView = lipgloss.JoinVertical(lipgloss.Left, m.renderSeries(m.fileList.Width()), treeView)
+		}
 
 		var rightPaneView string
 		selectedItem, ok := m.fileList.SelectedItem().(tree.TreeItem)
 
 		if ok && selectedItem.IsDir {
 			rightPaneView = m.renderEmptyState(m.diffViewport.Width, m.diffViewport.Height, "Directory: "+selectedItem.Name)
+		} else if ok && m.conflictMode && m.conflict != nil && m.conflict.Path == selectedItem.FullPath {
+			rightPaneView = m.renderConflict(m.diffViewport.Width, m.diffViewport.Height)
+		} else if ok && m.isSubmoduleSelected() {
+			rightPaneView = m.renderSubmoduleSummary(m.diffViewport.Width, m.diffViewport.Height)
+		} else if ok && m.isBinarySelected() && !(m.showHex && m.binary.Hex != "") {
+			rightPaneView = m.renderBinarySummary(m.diffViewport.Width, m.diffViewport.Height)
+		} else if ok && m.diffErr != nil && m.diff.Len() == 0 {
+			rightPaneView = m.renderEmptyState(m.diffViewport.Width, m.diffViewport.Height, "Cannot load diff (@ for the log)")
+		} else if ok && m.whitespaceOnly[selectedItem.FullPath] && m.diff.Len() == 0 {
+			rightPaneView = m.renderEmptyState(m.diffViewport.Width, m.diffViewport.Height, "Only whitespace changes: "+selectedItem.Name)
 		} else {
-			var renderedDiff strings.Builder
-
 			viewportHeight := m.diffViewport.Height
-			start := m.diffViewport.YOffset
-			end := start + viewportHeight
-			if end > len(m.diffLines) {
-				end = len(m.diffLines)
-			}
-
-			maxLineWidth := m.diffViewport.Width - 7
-			if maxLineWidth < 1 {
-				maxLineWidth = 1
-			}
-
-			for i := start; i < end; i++ {
-				rawLine := m.diffLines[i]
-				cleanLine := stripAnsi(rawLine)
-				line := ansi.Truncate(rawLine, maxLineWidth, "")
-
-				if strings.HasPrefix(cleanLine, "diff --git") ||
-					strings.HasPrefix(cleanLine, "diff -r ") ||
-					strings.HasPrefix(cleanLine, "index ") ||
-					strings.HasPrefix(cleanLine, "new file mode") ||
-					strings.HasPrefix(cleanLine, "old mode") ||
-					strings.HasPrefix(cleanLine, "--- a/") ||
-					strings.HasPrefix(cleanLine, "--- /dev/") ||
-					strings.HasPrefix(cleanLine, "+++ b/") ||
-					strings.HasPrefix(cleanLine, "+++ /dev/") {
-					continue
-				}
-
-				if strings.HasPrefix(cleanLine, "@@") {
-					continue
-				}
-
-				var numStr string
-				mode := "relative"
-
-				if mode != "hidden" {
-					isCursor := (i == m.diffCursor)
-					if isCursor && mode == "hybrid" {
-						realLine := m.vcs.CalculateFileLine(m.diffContent, m.diffCursor)
-						numStr = fmt.Sprintf("%d", realLine)
-					} else if isCursor && mode == "relative" {
-						numStr = "0"
-					} else if mode == "absolute" {
-						numStr = fmt.Sprintf("%d", i+1)
-					} else {
-						dist := int(math.Abs(float64(i - m.diffCursor)))
-						numStr = fmt.Sprintf("%d", dist)
-					}
-				}
-
-				lineNumRendered := ""
-				if numStr != "" {
-					lineNumRendered = LineNumberStyle.Render(numStr)
-				}
-
-				if m.focus == FocusDiff && i == m.diffCursor {
-					line = DiffSelectionStyle.Render("  " + cleanLine)
-				} else {
-					line = "  " + line
-				}
-
-				renderedDiff.WriteString(lineNumRendered + line + "\n")
-			}
-
-			diffContentStr := "\n" + strings.TrimRight(renderedDiff.String(), "\n")
+			diffContentStr := "\n" + m.diff.Render(diffview.Frame{
+				Offset:        m.diffViewport.YOffset,
+				Height:        viewportHeight,
+				Width:         m.diffViewport.Width,
+				Cursor:        m.diffCursor,
+				Selected:      m.focus == FocusDiff,
+				Numbers:       "relative",
+				NumberStyle:   LineNumberStyle,
+				SelectedStyle: DiffSelectionStyle,
+			})
 
 			diffView := DiffStyle.Copy().
 				Width(m.diffViewport.Width).
@@ -655,6 +992,8 @@ func (m Model) View() string {
 	var bottomBar string
 	if m.showHelp {
 		bottomBar = m.renderHelpDrawer()
+	} else if m.showLog {
+		bottomBar = m.renderLog()
 	} else {
 		bottomBar = m.viewStatusBar()
 	}
@@ -665,13 +1004,7 @@ func (m Model) View() string {
 func (m Model) renderTopBar() string {
 	repo := fmt.Sprintf(" %s", m.repoName)
 	branches := fmt.Sprintf(" %s ➜ %s", m.currentBranch, m.targetBranch)
-	// Determine VCS type
-	vcsType := "git"
-	if m.vcs != nil {
-		if _, isHg := m.vcs.(vcs.HgVCS); isHg {
-			vcsType = "hg"
-		}
-	}
+	vcsType := m.backend().Name
 	repoStats := ""
 	if m.statsAdded > 0 || m.statsDeleted > 0 {
 		repoStats = fmt.Sprintf(" +%d -%d", m.statsAdded, m.statsDeleted)
@@ -704,6 +1037,9 @@ func (m Model) renderTopBar() string {
 			// and fall back to currentFileAdded/Deleted (counted from the
 			// rendered diff) when the map hasn't been populated yet.
 			displayPath = selectedItem.FullPath
+			if r, ok := m.renames[selectedItem.FullPath]; ok {
+				displayPath = r.From + " → " + selectedItem.FullPath
+			}
 			if fs, ok := m.fileStats[selectedItem.FullPath]; ok {
 				statsAdded = fs[0]
 				statsDeleted = fs[1]
@@ -747,6 +1083,43 @@ func (m Model) renderTopBar() string {
 
 func (m Model) viewStatusBar() string {
 	shortcuts := StatusKeyStyle.Render("? Help  q Quit  Tab Switch")
+
+	var flags []string
+	if m.diffOpts.IgnoreAllSpace {
+		flags = append(flags, "-w")
+	}
+	if m.diffOpts.IgnoreSpaceChange {
+		flags = append(flags, "-b")
+	}
+	if m.diffOpts.IgnoreBlankLines {
+		flags = append(flags, "-B")
+	}
+	if m.diffOpts.IgnoreCRAtEOL {
+		flags = append(flags, "--ignore-cr")
+	}
+	if len(flags) > 0 {
+		shortcuts = lipgloss.JoinHorizontal(lipgloss.Top, shortcuts, StatusDividerStyle.Render("│"),
+			StatusKeyStyle.Render("ignoring "+strings.Join(flags, " ")))
+	}
+	switch {
+	case m.streaming:
+		shortcuts = lipgloss.JoinHorizontal(lipgloss.Top, shortcuts, StatusDividerStyle.Render("│"),
+			StatusKeyStyle.Render(m.renderProgress()))
+	case m.reloading:
+		shortcuts = lipgloss.JoinHorizontal(lipgloss.Top, shortcuts, StatusDividerStyle.Render("│"),
+			StatusKeyStyle.Render("reloading…"))
+	case m.watcher != nil:
+		shortcuts = lipgloss.JoinHorizontal(lipgloss.Top, shortcuts, StatusDividerStyle.Render("│"),
+			StatusKeyStyle.Render("● live"))
+	}
+	if len(m.notices) > 0 {
+		shortcuts = lipgloss.JoinHorizontal(lipgloss.Top, shortcuts, StatusDividerStyle.Render("│"),
+			StatusKeyStyle.Render(fmt.Sprintf("@ Log (%d)", len(m.notices))))
+	}
+	if toast := m.renderToast(m.width - lipgloss.Width(shortcuts) - 1); toast != "" {
+		padding := strings.Repeat(" ", max(0, m.width-lipgloss.Width(shortcuts)-lipgloss.Width(toast)))
+		shortcuts = shortcuts + padding + toast
+	}
 	return StatusBarStyle.Width(m.width).Render(shortcuts)
 }
 
@@ -765,11 +1138,19 @@ func (m Model) renderHelpDrawer() string {
 	)
 	col4 := lipgloss.JoinVertical(lipgloss.Left,
 		HelpTextStyle.Render("H/M/L Move Cursor"),
-		HelpTextStyle.Render("e     Edit File"),
+		HelpTextStyle.Render("e/R   Edit/Reload"),
 	)
 	col5 := lipgloss.JoinVertical(lipgloss.Left,
-		HelpTextStyle.Render("Supports Git & Hg"),
-		HelpTextStyle.Render("--vcs git/hg"),
+		HelpTextStyle.Render("W/x   Word/Hex Diff"),
+		HelpTextStyle.Render("iw/ib/iB/ir Ignore WS"),
+	)
+	hint := "--vcs " + strings.Join(vcs.BackendNames(), "/")
+	if hints := targetHints(m.backend()); len(hints) > 1 {
+		hint = hints[1].cmd
+	}
+	col6 := lipgloss.JoinVertical(lipgloss.Left,
+		HelpTextStyle.Render(hint),
+		HelpTextStyle.Render("--vcs "+strings.Join(vcs.BackendNames(), "/")),
 	)
 
 	return HelpDrawerStyle.Copy().
@@ -784,28 +1165,30 @@ func (m Model) renderHelpDrawer() string {
 			col4,
 			lipgloss.NewStyle().Width(4).Render(""),
 			col5,
+			lipgloss.NewStyle().Width(4).Render(""),
+			col6,
 		))
 }
 
 func (m Model) renderEmptyState(w, h int, statusMsg string) string {
 	logo := EmptyLogoStyle.Render("difi")
-	desc := EmptyDescStyle.Render("A calm, focused way to review Git & Mercurial diffs.")
+	desc := EmptyDescStyle.Render("A calm, focused way to review Git, Mercurial, SVN & Fossil diffs.")
 	status := EmptyStatusStyle.Render(statusMsg)
 
-	usageHeader := EmptyHeaderStyle.Render("Usage Patterns")
-	cmd1 := lipgloss.NewStyle().Foreground(ColorText).Render("difi")
-	desc1 := EmptyCodeStyle.Render("Auto-detect VCS, diff against main/tip")
-	cmd2 := lipgloss.NewStyle().Foreground(ColorText).Render("difi --vcs git")
-	desc2 := EmptyCodeStyle.Render("Force Git mode")
-	cmd3 := lipgloss.NewStyle().Foreground(ColorText).Render("difi --vcs hg")
-	desc3 := EmptyCodeStyle.Render("Force Mercurial mode")
-
-	usageBlock := lipgloss.JoinVertical(lipgloss.Left,
-		usageHeader,
-		lipgloss.JoinHorizontal(lipgloss.Left, cmd1, "    ", desc1),
-		lipgloss.JoinHorizontal(lipgloss.Left, cmd2, "    ", desc2),
-		lipgloss.JoinHorizontal(lipgloss.Left, cmd3, "    ", desc3),
+	usage := append(targetHints(m.backend()),
+		usageHint{"difi --vcs NAME", "Force " + strings.Join(vcs.BackendNames(), ", ")},
+		usageHint{"difi --no-index a b", "Compare two paths"},
 	)
+	cmdWidth := 0
+	for _, u := range usage {
+		cmdWidth = max(cmdWidth, lipgloss.Width(u.cmd))
+	}
+	usageRows := []string{EmptyHeaderStyle.Render("Usage Patterns")}
+	for _, u := range usage {
+		cmd := lipgloss.NewStyle().Foreground(ColorText).Width(cmdWidth).Render(u.cmd)
+		usageRows = append(usageRows, lipgloss.JoinHorizontal(lipgloss.Left, cmd, "    ", EmptyCodeStyle.Render(u.desc)))
+	}
+	usageBlock := lipgloss.JoinVertical(lipgloss.Left, usageRows...)
 
 	navHeader := EmptyHeaderStyle.Render("Navigation")
 	key1 := lipgloss.NewStyle().Foreground(ColorText).Render("Tab")
@@ -860,6 +1243,29 @@ func (m Model) renderEmptyState(w, h int, statusMsg string) string {
 	return lipgloss.Place(w, h, lipgloss.Center, lipgloss.Center, content)
 }
 
-func stripAnsi(str string) string {
-	return ansiRe.ReplaceAllString(str, "")
+// backend describes the active VCS; git's when there is none.
+func (m Model) backend() vcs.Backend {
+	if m.vcs == nil {
+		b, _ := vcs.LookupBackend("git")
+		return b
+	}
+	return m.vcs.Backend()
+}
+
+type usageHint struct{ cmd, desc string }
+
+// targetHints suggests targets by what the backend can compare: a range
+// from a merge base where it has them, past revisions where it has history.
+func targetHints(b vcs.Backend) []usageHint {
+	hints := []usageHint{{"difi", "Auto-detect VCS, diff against " + b.DefaultTarget}}
+	if b.DefaultTarget == "" {
+		hints[0].desc = "Auto-detect VCS and diff"
+	}
+	switch {
+	case b.Has(vcs.MergeBase):
+		hints = append(hints, usageHint{"difi main...", "Changes since forking main"})
+	case b.Has(vcs.Commits):
+		hints = append(hints, usageHint{"difi REV", "Diff against a past revision"})
+	}
+	return hints
 }
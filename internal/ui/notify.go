@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+const (
+	// toastDuration is how long a notification stays in the status bar.
+	toastDuration = 5 * time.Second
+	// maxNotices bounds the message log.
+	maxNotices = 100
+	// logHeight is the height of the message log drawer, like the help
+	// drawer's.
+	logHeight = 6
+)
+
+// ErrorMsg reports a failure of background work, such as loading stats.
+type ErrorMsg struct{ Err error }
+
+// notice is an entry of the message log.
+type notice struct {
+	At   time.Time
+	Text string
+	Kind error // vcs.ErrTimeout and friends, nil when unrecognized
+}
+
+type toastExpiredMsg struct{ id int }
+
+// notify records err in the message log and shows it as a toast until the
+// returned command expires it.
+func (m *Model) notify(err error) tea.Cmd {
+	n := notice{At: time.Now(), Text: err.Error()}
+	var e *vcs.Error
+	if errors.As(err, &e) {
+		n.Kind = e.Kind
+	}
+	m.notices = append(m.notices, n)
+	if len(m.notices) > maxNotices {
+		m.notices = m.notices[len(m.notices)-maxNotices:]
+	}
+	m.toast = &n
+	m.toastID++
+	return m.expireToastCmd()
+}
+
+// expireToastCmd hides the current toast once it has been shown for
+// toastDuration, unless a newer one replaced it.
+func (m Model) expireToastCmd() tea.Cmd {
+	id := m.toastID
+	return tea.Tick(toastDuration, func(time.Time) tea.Msg { return toastExpiredMsg{id} })
+}
+
+// renderToast draws the current notification for the status bar, cut to
+// width.
+func (m Model) renderToast(width int) string {
+	if m.toast == nil || width <= 0 {
+		return ""
+	}
+	text := m.toast.Text
+	// The kind leads, so what went wrong survives truncation.
+	if k := m.toast.Kind; k != nil && !strings.HasPrefix(text, k.Error()) {
+		text = k.Error() + ": " + text
+	}
+	return ToastStyle.Render(ansi.Truncate(text, width-2, "…"))
+}
+
+// renderLog draws the message log drawer with the latest notices last.
+func (m Model) renderLog() string {
+	rows := logHeight - 2 // the drawer's border and padding
+	var lines []string
+	if len(m.notices) == 0 {
+		lines = append(lines, HelpTextStyle.Render("No messages"))
+	}
+	start := max(0, len(m.notices)-rows)
+	for _, n := range m.notices[start:] {
+		line := fmt.Sprintf("%s  %s", n.At.Format("15:04:05"), n.Text)
+		lines = append(lines, HelpTextStyle.Render(ansi.Truncate(line, m.width-6, "…")))
+	}
+	return HelpDrawerStyle.Copy().
+		Width(m.width).
+		Height(rows).
+		Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
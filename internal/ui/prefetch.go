@@ -0,0 +1,72 @@
+package ui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/oug-t/difi/internal/diffcache"
+	"github.com/oug-t/difi/internal/tree"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// diffCacheBytes bounds the diff text kept for files already visited or
+// prefetched.
+const diffCacheBytes = 32 << 20
+
+// diffKey identifies the diff of path as loadDiffCmd would fetch it. ok is
+// false for diffs that are not cached: piped ones are cheap to extract
+// again, and without a working tree an edit could not be noticed.
+func (m Model) diffKey(path string) (k diffcache.Key, ok bool) {
+	wt, isWorktree := m.vcs.(vcs.Worktree)
+	if m.piped() || m.conflictMode || !isWorktree {
+		return k, false
+	}
+	return diffcache.Key{
+		Target:  m.targetBranch,
+		Path:    path,
+		OldPath: m.renames[path].From,
+		Opts:    m.diffOpts,
+		ModTime: diffcache.ModTime(wt.WorkingFile(path)),
+	}, true
+}
+
+// neighbourFiles returns the files right before and after the selection
+// in the tree, which are likely to be looked at next.
+func (m Model) neighbourFiles() []string {
+	items := m.fileList.Items()
+	idx := m.fileList.Index()
+	var files []string
+	for _, step := range []int{1, -1} {
+		for i := idx + step; i >= 0 && i < len(items); i += step {
+			if ti, ok := items[i].(tree.TreeItem); ok && !ti.IsDir {
+				files = append(files, ti.FullPath)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// prefetchCmd loads the diffs of the selection's neighbours into the cache
+// in the background. It cancels the previous prefetch, whose files are no
+// longer next to the selection.
+func (m Model) prefetchCmd() tea.Cmd {
+	var cmds []tea.Cmd
+	_, ctx := m.reqs.prefetch.start(m.reqs.diffTimeout)
+	for _, path := range m.neighbourFiles() {
+		key, ok := m.diffKey(path)
+		if !ok {
+			continue
+		}
+		if _, cached := m.cache.Get(key); cached {
+			continue
+		}
+		load := m.vcs.DiffCmd(ctx, m.targetBranch, path, key.OldPath, m.diffOpts)
+		cmds = append(cmds, func() tea.Msg {
+			if msg, ok := load().(vcs.DiffMsg); ok && msg.Err == nil && ctx.Err() == nil {
+				m.cache.Put(key, msg.Content)
+			}
+			return nil
+		})
+	}
+	return tea.Batch(cmds...)
+}
@@ -0,0 +1,218 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/oug-t/difi/internal/config"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/tree"
+	"github.com/oug-t/difi/internal/vcs"
+	"github.com/oug-t/difi/internal/watch"
+)
+
+// watchDebounce is how long the working tree has to be quiet before a
+// reload, so saving or checking out many files reloads once.
+const watchDebounce = 300 * time.Millisecond
+
+// watchMsg reports edits to the working tree. closed is set once the
+// watcher has stopped.
+type watchMsg struct {
+	change watch.Change
+	closed bool
+}
+
+// filesMsg carries the changed files listed again for a reload.
+type filesMsg struct {
+	files   []string
+	renames map[string]diff.Rename
+	err     error
+	id      int
+}
+
+// diffPos is where the diff of path was scrolled to, kept across a reload.
+type diffPos struct {
+	path           string
+	cursor, offset int
+}
+
+// startWatch watches the working tree for edits made outside difi, when
+// the backend has one and live reload is on. Platforms without a watcher
+// just go without.
+func (m *Model) startWatch(cfg config.Config) {
+	wt, ok := m.vcs.(vcs.Worktree)
+	if !ok || !cfg.UI.Watch {
+		return
+	}
+	opts := watch.Options{Meta: m.vcs.Backend().Markers, Debounce: watchDebounce}
+	if ig, ok := m.vcs.(vcs.Ignores); ok {
+		opts.Ignored = func(paths []string) map[string]bool {
+			ignored, _ := ig.Ignored(paths)
+			return ignored
+		}
+	}
+	w, err := watch.New(wt.WorkingFile("."), opts)
+	switch {
+	case errors.Is(err, watch.ErrUnsupported):
+	case err != nil:
+		m.notify(fmt.Errorf("live reload: %w", err))
+	default:
+		m.watcher = w
+	}
+}
+
+// stopWatch closes the watcher, if any, so its goroutines and inotify
+// watches go away with the program.
+func (m *Model) stopWatch() {
+	if m.watcher != nil {
+		m.watcher.Close()
+		m.watcher = nil
+	}
+}
+
+func waitWatchCmd(w *watch.Watcher) tea.Cmd {
+	return func() tea.Msg {
+		c, ok := <-w.Changes()
+		return watchMsg{change: c, closed: !ok}
+	}
+}
+
+// handleWatch reloads after edits and waits for the next ones.
+func (m Model) handleWatch(msg watchMsg) (Model, tea.Cmd) {
+	if msg.closed {
+		m.watcher = nil
+		return m, nil
+	}
+	cmds := []tea.Cmd{waitWatchCmd(m.watcher)}
+	if msg.change.Err != nil {
+		cmds = append(cmds, m.notify(fmt.Errorf("live reload: %w", msg.change.Err)))
+	}
+	if len(msg.change.Paths) > 0 {
+		cmds = append(cmds, m.reload())
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// reload lists the changes again and reloads the selected diff, keeping
+// the selection and the diff's scroll position.
+func (m *Model) reload() tea.Cmd {
+	if m.piped() {
+		return nil
+	}
+	m.cache.Clear()
+	m.reloading = true
+	m.restore = nil
+	if m.selectedPath != "" {
+		m.restore = &diffPos{path: m.selectedPath, cursor: m.diffCursor, offset: m.diffViewport.YOffset}
+	}
+	if m.batch && !m.conflictMode {
+		m.keepPath, m.keepIndex = m.selection()
+		m.files = nil
+		m.fileStats, m.renames, m.binaryFiles, m.lfsFiles, m.listed = nil, nil, nil, nil, nil
+		m.statsAdded, m.statsDeleted = 0, 0
+		m.streamed = 0
+		m.streaming = true
+		return m.streamCmd()
+	}
+	return m.listCmd()
+}
+
+// listCmd lists the changed files, or the unmerged ones in conflicts mode.
+func (m Model) listCmd() tea.Cmd {
+	id, ctx := m.reqs.list.start(m.reqs.statsTimeout)
+	if c, ok := m.vcs.(vcs.Conflicts); ok && m.conflictMode {
+		return func() tea.Msg {
+			files, err := c.UnmergedFiles()
+			return filesMsg{files: files, err: err, id: id}
+		}
+	}
+	target, opts := m.targetBranch, m.diffOpts
+	return func() tea.Msg {
+		files, err := m.vcs.ListChangedFiles(ctx, target, opts)
+		var renames map[string]diff.Rename
+		if err == nil {
+			renames, err = m.vcs.RenamesByFile(ctx, target, opts)
+		}
+		if canceled(ctx) {
+			return nil
+		}
+		return filesMsg{files: files, renames: renames, err: vcs.Classify(ctx, err), id: id}
+	}
+}
+
+// handleFiles rebuilds the tree from a reload's listing and reloads what
+// depends on it.
+func (m Model) handleFiles(msg filesMsg) (Model, tea.Cmd) {
+	if msg.id != m.reqs.list.id {
+		return m, nil
+	}
+	m.reqs.list.finish(msg.id)
+	m.reloading = false
+	if msg.err != nil {
+		return m, m.notify(fmt.Errorf("reload: %w", msg.err))
+	}
+	m.loadErr = nil
+	if !m.conflictMode {
+		m.renames = msg.renames
+		m.treeDelegate.Renames = m.renames
+	}
+	path, index := m.selection()
+	m.updateFiles(msg.files)
+	m.keepSelection(path, index)
+
+	var cmds []tea.Cmd
+	if m.selectedPath != "" {
+		cmds = append(cmds, m.loadDiffCmd())
+	}
+	if !m.conflictMode {
+		cmds = append(cmds, m.fetchStatsCmd(m.targetBranch))
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// selection returns the path and position of the selected tree entry.
+func (m Model) selection() (string, int) {
+	ti, _ := m.fileList.SelectedItem().(tree.TreeItem)
+	return ti.FullPath, m.fileList.Index()
+}
+
+// keepSelection selects path again after the tree was rebuilt or, when it
+// is gone, the entry that took its place at index. It reports whether path
+// was found.
+func (m *Model) keepSelection(path string, index int) bool {
+	items := m.fileList.Items()
+	m.selectedPath = ""
+	if len(items) == 0 {
+		return false
+	}
+	found := false
+	for idx, item := range items {
+		if ti, ok := item.(tree.TreeItem); ok && ti.FullPath == path {
+			index, found = idx, true
+			break
+		}
+	}
+	if !found {
+		m.diffCursor = 0
+	}
+	index = min(index, len(items)-1)
+	m.fileList.Select(index)
+	if ti, ok := items[index].(tree.TreeItem); ok && !ti.IsDir {
+		m.selectedPath = ti.FullPath
+	}
+	return found
+}
+
+// restoreDiffPos scrolls a reloaded diff back to where it was.
+func (m *Model) restoreDiffPos(path string) {
+	r := m.restore
+	m.restore = nil
+	if r == nil || r.path != path {
+		return
+	}
+	m.diffCursor = min(r.cursor, max(m.diff.Len()-1, 0))
+	m.diffViewport.SetYOffset(r.offset)
+}
@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/oug-t/difi/internal/config"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// fakeVCS lists files and serves their diffs from memory, remembering the
+// context of each diff request.
+type fakeVCS struct {
+	files []string
+	diffs map[string]string
+	ctxs  []context.Context
+}
+
+func (f *fakeVCS) Backend() vcs.Backend     { return vcs.Backend{Name: "fake"} }
+func (f *fakeVCS) GetCurrentBranch() string { return "main" }
+func (f *fakeVCS) GetRepoName() string      { return "fake" }
+func (f *fakeVCS) ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	return f.files, nil
+}
+func (f *fakeVCS) RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	return nil, nil
+}
+func (f *fakeVCS) DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	f.ctxs = append(f.ctxs, ctx)
+	return func() tea.Msg { return vcs.DiffMsg{Content: f.diffs[path], Path: path} }
+}
+func (f *fakeVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	return nil
+}
+func (f *fakeVCS) Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	return diff.Summary{}, nil
+}
+func (f *fakeVCS) FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	return diff.File{}, nil
+}
+func (f *fakeVCS) ParseFilesFromDiff(diffText string) []string { return nil }
+func (f *fakeVCS) ExtractFileDiff(diffText, targetPath string) string {
+	return ""
+}
+
+// longDiff returns a diff of n context lines, long enough to scroll.
+func longDiff(n int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "@@ -1,%d +1,%d @@\n", n, n)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, " line %d\n", i)
+	}
+	return sb.String()
+}
+
+// testModel returns a sized model over the fake's files, with the first
+// one selected.
+func testModel(t *testing.T, f *fakeVCS) Model {
+	t.Helper()
+	m := newModel(config.Config{}, "", "", f, f.files, nil)
+	return update(t, m, tea.WindowSizeMsg{Width: 120, Height: 40})
+}
+
+func update(t *testing.T, m Model, msg tea.Msg) Model {
+	t.Helper()
+	next, _ := m.Update(msg)
+	return next.(Model)
+}
+
+// loadDiff starts a diff request for the selection and delivers its reply.
+func loadDiff(t *testing.T, m Model) Model {
+	t.Helper()
+	msg := m.loadDiffCmd()()
+	return update(t, m, msg)
+}
+
+// reloadWith lists the fake's files again as a reload does.
+func reloadWith(t *testing.T, m Model, f *fakeVCS, files []string) Model {
+	t.Helper()
+	f.files = files
+	msg := m.reload()()
+	return update(t, m, msg)
+}
+
+func TestReloadKeepsPosition(t *testing.T) {
+	f := &fakeVCS{
+		files: []string{"a.go", "b.go", "c.go"},
+		diffs: map[string]string{"a.go": longDiff(3), "b.go": longDiff(100), "c.go": longDiff(100)},
+	}
+	m := testModel(t, f)
+	m.fileList.Select(1)
+	m.selectedPath = "b.go"
+	m = loadDiff(t, m)
+	m.diffCursor = 30
+	m.diffViewport.SetYOffset(20)
+
+	m = reloadWith(t, m, f, []string{"a.go", "b.go", "new.go"})
+	if m.selectedPath != "b.go" {
+		t.Fatalf("selectedPath = %q after reload, want b.go", m.selectedPath)
+	}
+	m = update(t, m, vcs.DiffMsg{Content: f.diffs["b.go"], Path: "b.go", ID: m.reqs.diff.id})
+	if m.diffCursor != 30 || m.diffViewport.YOffset != 20 {
+		t.Errorf("cursor, offset = %d, %d after reload, want 30, 20", m.diffCursor, m.diffViewport.YOffset)
+	}
+
+	// A shorter diff keeps the cursor on its last line.
+	f.diffs["b.go"] = longDiff(10)
+	m = reloadWith(t, m, f, f.files)
+	m = update(t, m, vcs.DiffMsg{Content: f.diffs["b.go"], Path: "b.go", ID: m.reqs.diff.id})
+	if want := m.diff.Len() - 1; m.diffCursor != want {
+		t.Errorf("cursor = %d after the diff shrank, want %d", m.diffCursor, want)
+	}
+}
+
+func TestReloadFileGone(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"next file takes its place", []string{"a.go", "c.go"}, "c.go"},
+		{"last file", []string{"a.go"}, "a.go"},
+		{"no files", nil, ""},
+	}
+	for _, tt := range tests {
+		f := &fakeVCS{
+			files: []string{"a.go", "b.go", "c.go"},
+			diffs: map[string]string{"a.go": longDiff(100), "b.go": longDiff(100), "c.go": longDiff(100)},
+		}
+		m := testModel(t, f)
+		m.fileList.Select(1)
+		m.selectedPath = "b.go"
+		m = loadDiff(t, m)
+		m.diffCursor = 30
+		m.diffViewport.SetYOffset(20)
+
+		m = reloadWith(t, m, f, tt.files)
+		if m.selectedPath != tt.want {
+			t.Errorf("%s: selectedPath = %q, want %q", tt.name, m.selectedPath, tt.want)
+			continue
+		}
+		if tt.want == "" {
+			continue
+		}
+		m = update(t, m, vcs.DiffMsg{Content: f.diffs[tt.want], Path: tt.want, ID: m.reqs.diff.id})
+		if m.diffCursor != 0 || m.diffViewport.YOffset != 0 {
+			t.Errorf("%s: cursor, offset = %d, %d, want the top", tt.name, m.diffCursor, m.diffViewport.YOffset)
+		}
+	}
+}
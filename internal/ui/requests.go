@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"context"
+	"time"
+)
+
+// requests tracks the VCS work in flight. bubbletea copies the Model on
+// every update, so the model holds it by pointer and all copies see the
+// latest request.
+type requests struct {
+	diff     request
+	stats    request
+	prefetch request
+	batch    request
+	list     request
+
+	diffTimeout  time.Duration
+	statsTimeout time.Duration
+}
+
+// request is the latest of a kind of request. Replies carry its ID, and
+// replies to earlier ones are dropped.
+type request struct {
+	id     int
+	cancel context.CancelFunc
+}
+
+// start cancels the previous request and begins the next, bounded by
+// timeout unless it is zero.
+func (r *request) start(timeout time.Duration) (int, context.Context) {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	var ctx context.Context
+	ctx, r.cancel = withTimeout(timeout)
+	r.id++
+	return r.id, ctx
+}
+
+// finish releases the context of request id once its reply has arrived.
+func (r *request) finish(id int) {
+	if id == r.id && r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+// withTimeout returns a context that expires after timeout, or one that is
+// only cancelled explicitly when timeout is zero.
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// canceled reports whether ctx was cancelled because its request was
+// superseded, as opposed to timing out.
+func canceled(ctx context.Context) bool {
+	return ctx.Err() == context.Canceled
+}
@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+func TestStaleDiffDropped(t *testing.T) {
+	f := &fakeVCS{
+		files: []string{"a.go", "b.go"},
+		diffs: map[string]string{"a.go": longDiff(50)},
+	}
+	m := testModel(t, f)
+	first := m.loadDiffCmd()
+	f.diffs["a.go"] = longDiff(5)
+	second := m.loadDiffCmd()
+
+	if len(f.ctxs) != 2 {
+		t.Fatalf("%d diff requests, want 2", len(f.ctxs))
+	}
+	if err := f.ctxs[0].Err(); err != context.Canceled {
+		t.Errorf("first request's context error = %v, want it cancelled", err)
+	}
+
+	m = update(t, m, second())
+	if m.reqs.diff.cancel != nil {
+		t.Error("second request's context not released once its reply arrived")
+	}
+	// The cancelled command yields nothing, and its reply, had it been sent
+	// before the cancel, is dropped.
+	if msg := first(); msg != nil {
+		t.Errorf("first request's command returned %#v after it was cancelled", msg)
+	}
+	m = update(t, m, vcs.DiffMsg{Content: longDiff(50), Path: "a.go", ID: 1})
+	if got, want := m.diff.Len(), 7; got != want {
+		t.Errorf("diff has %d lines after the stale reply, want the second reply's %d", got, want)
+	}
+}
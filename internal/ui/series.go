@@ -0,0 +1,106 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/oug-t/difi/internal/mbox"
+)
+
+// seriesWindow is how many entries of the commit list are shown at once.
+const seriesWindow = 5
+
+// seriesHeight is the number of rows the commit list takes above the tree,
+// borders included: the visible entries plus the author line.
+func (m Model) seriesHeight() int {
+	if len(m.series) == 0 {
+		return 0
+	}
+	return min(len(m.series)+1, seriesWindow) + 1 + 2
+}
+
+// selectPatch switches the tree and diff to entry idx of the commit list:
+// 0 is the whole series, i is patch i.
+func (m *Model) selectPatch(idx int) tea.Cmd {
+	if idx < 0 || idx > len(m.series) || idx == m.seriesIdx {
+		return nil
+	}
+	m.seriesIdx = idx
+	if idx == 0 {
+		m.pipedDiff = mbox.Join(m.series)
+	} else {
+		m.pipedDiff = m.series[idx-1].Diff
+	}
+
+	// A path may change in several patches, so nothing carries over.
+	m.statsAdded, m.statsDeleted = 0, 0
+	m.fileStats = nil
+	m.binary, m.submodule = nil, nil
+	m.diffCursor = 0
+	m.setFiles(m.vcs.ParseFilesFromDiff(m.pipedDiff))
+	m.setDiff("")
+
+	cmds := []tea.Cmd{m.computePipedStatsCmd()}
+	if m.selectedPath != "" {
+		cmds = append(cmds, m.loadDiffCmd())
+	}
+	return tea.Batch(cmds...)
+}
+
+// renderSeries draws the commit list of a piped patch series, keeping the
+// selected entry in view.
+func (m Model) renderSeries(width int) string {
+	inner := width - 2
+	if inner < 1 {
+		inner = 1
+	}
+
+	total := len(m.series) + 1
+	rows := min(total, seriesWindow)
+	first := m.seriesIdx - rows/2
+	if first > total-rows {
+		first = total - rows
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	var lines []string
+	for i := first; i < first+rows; i++ {
+		text := fmt.Sprintf("All %d patches", len(m.series))
+		if i > 0 {
+			text = fmt.Sprintf("%d/%d %s", i, len(m.series), m.series[i-1].Subject)
+		}
+		text = ansi.Truncate(text, inner, "…")
+		if i == m.seriesIdx {
+			lines = append(lines, DiffSelectionStyle.Render(text+strings.Repeat(" ", max(inner-ansi.StringWidth(text), 0))))
+		} else {
+			lines = append(lines, FileStyle.Render(text))
+		}
+	}
+
+	detail := "n/p next/prev patch"
+	if n := m.seriesFiles[m.selectedPath]; m.seriesIdx == 0 && len(n) > 1 {
+		nums := make([]string, len(n))
+		for i, v := range n {
+			nums[i] = strconv.Itoa(v)
+		}
+		detail = "Patches " + strings.Join(nums, ", ") + " in turn"
+	}
+	if m.seriesIdx > 0 {
+		p := m.series[m.seriesIdx-1]
+		detail = p.Author
+		if !p.Date.IsZero() {
+			detail += " · " + p.Date.Format("2006-01-02 15:04")
+		}
+	}
+	lines = append(lines, EmptyCodeStyle.Render(ansi.Truncate(detail, inner, "…")))
+
+	return PaneStyle.Copy().
+		Width(width).
+		Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
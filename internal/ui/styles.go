@@ -67,6 +67,7 @@ var (
 	StatusAddedStyle   = lipgloss.NewStyle().Foreground(nord14).Padding(0, 1)
 	StatusDeletedStyle = lipgloss.NewStyle().Foreground(nord11).Padding(0, 1)
 	StatusDividerStyle = lipgloss.NewStyle().Foreground(nord3).Padding(0, 1)
+	ToastStyle         = lipgloss.NewStyle().Foreground(nord11).Padding(0, 1)
 
 	ColorText = lipgloss.Color("252")
 )
@@ -0,0 +1,157 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/submodule"
+	"github.com/oug-t/difi/internal/vcs"
+)
+
+// SubmoduleMsg carries the submodule changes found in the selected file's
+// diff and, outside piped mode, the commits each one covers.
+type SubmoduleMsg struct {
+	Path    string
+	Changes []submodule.Change
+	Logs    []submodule.Log
+	Errs    []error
+}
+
+// submoduleChanges finds submodule pointer changes in the diff of the
+// selected file.
+func (m Model) submoduleChanges(content string) []submodule.Change {
+	sm, ok := m.vcs.(vcs.Submodules)
+	if !ok {
+		return nil
+	}
+	return sm.SubmoduleChanges(m.selectedPath, diff.StripANSI(content))
+}
+
+// loadSubmoduleCmd looks up the commit range of each change. A piped diff
+// may come from another repository, so it only shows the revisions.
+func (m Model) loadSubmoduleCmd(changes []submodule.Change) tea.Cmd {
+	msg := SubmoduleMsg{Path: m.selectedPath, Changes: changes}
+	sm, ok := m.vcs.(vcs.Submodules)
+	if !ok || m.piped() {
+		return func() tea.Msg { return msg }
+	}
+	return func() tea.Msg {
+		for _, c := range changes {
+			log, err := sm.SubmoduleLog(c)
+			msg.Logs = append(msg.Logs, log)
+			msg.Errs = append(msg.Errs, err)
+		}
+		return msg
+	}
+}
+
+// isSubmoduleSelected reports whether the submodule summary applies to the
+// selected file.
+func (m Model) isSubmoduleSelected() bool {
+	return m.submodule != nil && m.submodule.Path == m.selectedPath
+}
+
+// selectedSubmodule is the change the diff cursor is on; the summary lists
+// one change per row.
+func (m Model) selectedSubmodule() (submodule.Change, bool) {
+	if !m.isSubmoduleSelected() || len(m.submodule.Changes) == 0 {
+		return submodule.Change{}, false
+	}
+	idx := m.diffCursor
+	if m.focus != FocusDiff || idx < 0 {
+		idx = 0
+	}
+	if idx >= len(m.submodule.Changes) {
+		idx = len(m.submodule.Changes) - 1
+	}
+	return m.submodule.Changes[idx], true
+}
+
+// openSubmoduleCmd runs a nested difi inside the submodule on the range of
+// the bump. The parent view resumes when it quits.
+func (m Model) openSubmoduleCmd(c submodule.Change) tea.Cmd {
+	sm, ok := m.vcs.(vcs.Submodules)
+	if !ok || m.piped() || c.Removed() {
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	dir, args := sm.SubmoduleArgs(c)
+	cmd := exec.Command(self, args...)
+	cmd.Dir = dir
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return tea.ExecProcess(cmd, func(err error) tea.Msg { return nil })
+}
+
+// renderSubmoduleSummary replaces the "Subproject commit" diff with the
+// range of commits each submodule moved over.
+func (m Model) renderSubmoduleSummary(w, h int) string {
+	s := m.submodule
+	selected, _ := m.selectedSubmodule()
+
+	var rows []string
+	for i, c := range s.Changes {
+		title := fmt.Sprintf("Submodule %s: %s", c.Path, describeChange(c))
+		if len(s.Changes) > 1 && c == selected {
+			title = "▸ " + title
+		}
+		rows = append(rows, EmptyHeaderStyle.Render(title))
+
+		if i < len(s.Errs) && s.Errs[i] != nil {
+			rows = append(rows, EmptyCodeStyle.Render(s.Errs[i].Error()), "")
+			continue
+		}
+		if i >= len(s.Logs) {
+			continue
+		}
+		log := s.Logs[i]
+		switch {
+		case log.Rewound:
+			rows = append(rows, EmptyCodeStyle.Render(fmt.Sprintf("Rewound, dropping %s:", pluralCommits(len(log.Commits)))))
+		case len(log.Commits) > 0:
+			rows = append(rows, EmptyCodeStyle.Render(pluralCommits(len(log.Commits))+":"))
+		}
+		limit := h/len(s.Changes) - 4
+		for j, commit := range log.Commits {
+			if j >= limit {
+				rows = append(rows, EmptyCodeStyle.Render(fmt.Sprintf("  … %d more", len(log.Commits)-j)))
+				break
+			}
+			rows = append(rows, lipgloss.NewStyle().Foreground(ColorText).Render("  "+commit))
+		}
+		rows = append(rows, "")
+	}
+
+	if !m.piped() && !selected.Removed() {
+		rows = append(rows, EmptyCodeStyle.Render("Press Enter to review "+selected.Path+" in a nested difi"))
+	}
+
+	return lipgloss.Place(w, h, lipgloss.Center, lipgloss.Center, lipgloss.JoinVertical(lipgloss.Left, rows...))
+}
+
+func describeChange(c submodule.Change) string {
+	switch {
+	case c.Added():
+		return "added at " + submodule.Short(c.New)
+	case c.Removed():
+		return "removed (was " + submodule.Short(c.Old) + ")"
+	}
+	desc := submodule.Short(c.Old) + " → " + submodule.Short(c.New)
+	if c.Dirty {
+		desc += " (modified content)"
+	}
+	return desc
+}
+
+func pluralCommits(n int) string {
+	if n == 1 {
+		return "1 commit"
+	}
+	return fmt.Sprintf("%d commits", n)
+}
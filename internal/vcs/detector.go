@@ -1,28 +1,50 @@
 package vcs
 
 import (
+	"context"
+	"io"
 	"os"
 	"path/filepath"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/fossil"
 	"github.com/oug-t/difi/internal/git"
 	"github.com/oug-t/difi/internal/hg"
+	"github.com/oug-t/difi/internal/pathdiff"
+	"github.com/oug-t/difi/internal/plugin"
+	"github.com/oug-t/difi/internal/submodule"
+	"github.com/oug-t/difi/internal/svn"
 )
 
 type GitVCS struct{}
 type HgVCS struct{}
+type SvnVCS struct{}
+type FossilVCS struct{}
 
+// PathVCS compares two files or directories directly instead of asking a
+// VCS. It backs the git difftool / hg extdiff integration.
+type PathVCS struct{ Pair pathdiff.Pair }
+
+// PluginVCS is a backend provided by an external difi-vcs-<name>
+// executable; see package plugin for the protocol.
+type PluginVCS struct{ Plugin plugin.Plugin }
+
+func (g GitVCS) Backend() Backend         { return gitBackend }
 func (g GitVCS) GetCurrentBranch() string { return git.GetCurrentBranch() }
 func (g GitVCS) GetRepoName() string      { return git.GetRepoName() }
-func (g GitVCS) ListChangedFiles(targetBranch string) ([]string, error) {
-	return git.ListChangedFiles(targetBranch)
+func (g GitVCS) ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	return git.ListChangedFiles(ctx, targetBranch, opts)
+}
+func (g GitVCS) RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	return git.RenamesByFile(ctx, targetBranch, opts)
 }
-func (g GitVCS) DiffCmd(targetBranch, path string) tea.Cmd {
-	gitCmd := git.DiffCmd(targetBranch, path)
+func (g GitVCS) DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	gitCmd := git.DiffCmd(ctx, targetBranch, path, oldPath, opts)
 	return func() tea.Msg {
 		msg := gitCmd()
 		if gitMsg, ok := msg.(git.DiffMsg); ok {
-			return DiffMsg{Content: gitMsg.Content}
+			return DiffMsg{Content: gitMsg.Content, Path: path, Err: gitMsg.Err}
 		}
 		return msg
 	}
@@ -37,31 +59,47 @@ func (g GitVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string,
 		return msg
 	}
 }
-func (g GitVCS) DiffStats(targetBranch string) (added int, deleted int, err error) {
-	return git.DiffStats(targetBranch)
+func (g GitVCS) Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	return git.Stats(ctx, targetBranch, opts)
 }
-func (g GitVCS) DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
-	return git.DiffStatsByFile(targetBranch)
+func (g GitVCS) FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	return git.FileContents(ctx, targetBranch, path, oldPath)
 }
-func (g GitVCS) CalculateFileLine(diffContent string, visualLineIndex int) int {
-	return git.CalculateFileLine(diffContent, visualLineIndex)
+func (g GitVCS) LFSFiles(files []string) (map[string]bool, error) { return git.LFSFiles(files) }
+func (g GitVCS) LFSObject(oid string) ([]byte, error)             { return git.LFSObject(oid) }
+func (g GitVCS) SubmoduleChanges(path, diffText string) []submodule.Change {
+	return git.SubmoduleChanges(path, diffText)
 }
+func (g GitVCS) SubmoduleLog(c submodule.Change) (submodule.Log, error) { return git.SubmoduleLog(c) }
+func (g GitVCS) SubmoduleArgs(c submodule.Change) (string, []string)    { return git.SubmoduleArgs(c) }
+func (g GitVCS) UnmergedFiles() ([]string, error)                       { return git.UnmergedFiles() }
+func (g GitVCS) WorkingFile(path string) string                         { return git.WorkingFile(path) }
+func (g GitVCS) Ignored(paths []string) (map[string]bool, error)        { return git.Ignored(paths) }
+func (g GitVCS) StreamDiff(ctx context.Context, targetBranch string, opts diff.Options) (io.ReadCloser, error) {
+	return git.StreamDiff(ctx, targetBranch, opts)
+}
+func (g GitVCS) MergeBase(path string) ([]byte, error)       { return git.MergeBase(path) }
+func (g GitVCS) MarkResolved(path string) error              { return git.MarkResolved(path) }
 func (g GitVCS) ParseFilesFromDiff(diffText string) []string { return git.ParseFilesFromDiff(diffText) }
 func (g GitVCS) ExtractFileDiff(diffText, targetPath string) string {
 	return git.ExtractFileDiff(diffText, targetPath)
 }
 
+func (h HgVCS) Backend() Backend         { return hgBackend }
 func (h HgVCS) GetCurrentBranch() string { return hg.GetCurrentBranch() }
 func (h HgVCS) GetRepoName() string      { return hg.GetRepoName() }
-func (h HgVCS) ListChangedFiles(targetBranch string) ([]string, error) {
-	return hg.ListChangedFiles(targetBranch)
+func (h HgVCS) ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	return hg.ListChangedFiles(ctx, targetBranch, opts)
+}
+func (h HgVCS) RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	return hg.RenamesByFile(ctx, targetBranch, opts)
 }
-func (h HgVCS) DiffCmd(targetBranch, path string) tea.Cmd {
-	hgCmd := hg.DiffCmd(targetBranch, path)
+func (h HgVCS) DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	hgCmd := hg.DiffCmd(ctx, targetBranch, path, oldPath, opts)
 	return func() tea.Msg {
 		msg := hgCmd()
 		if hgMsg, ok := msg.(hg.DiffMsg); ok {
-			return DiffMsg{Content: hgMsg.Content}
+			return DiffMsg{Content: hgMsg.Content, Path: path, Err: hgMsg.Err}
 		}
 		return msg
 	}
@@ -76,49 +114,258 @@ func (h HgVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string, e
 		return msg
 	}
 }
-func (h HgVCS) DiffStats(targetBranch string) (added int, deleted int, err error) {
-	return hg.DiffStats(targetBranch)
+func (h HgVCS) Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	return hg.Stats(ctx, targetBranch, opts)
+}
+func (h HgVCS) FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	return hg.FileContents(ctx, targetBranch, path, oldPath)
 }
-func (h HgVCS) DiffStatsByFile(targetBranch string) (map[string][2]int, error) {
-	return hg.DiffStatsByFile(targetBranch)
+func (h HgVCS) SubmoduleChanges(path, diffText string) []submodule.Change {
+	return hg.SubmoduleChanges(path, diffText)
 }
-func (h HgVCS) CalculateFileLine(diffContent string, visualLineIndex int) int {
-	return hg.CalculateFileLine(diffContent, visualLineIndex)
+func (h HgVCS) SubmoduleLog(c submodule.Change) (submodule.Log, error) { return hg.SubmoduleLog(c) }
+func (h HgVCS) SubmoduleArgs(c submodule.Change) (string, []string)    { return hg.SubmoduleArgs(c) }
+func (h HgVCS) UnmergedFiles() ([]string, error)                       { return hg.UnmergedFiles() }
+func (h HgVCS) WorkingFile(path string) string                         { return hg.WorkingFile(path) }
+func (h HgVCS) Ignored(paths []string) (map[string]bool, error)        { return hg.Ignored(paths) }
+func (h HgVCS) StreamDiff(ctx context.Context, targetBranch string, opts diff.Options) (io.ReadCloser, error) {
+	return hg.StreamDiff(ctx, targetBranch, opts)
 }
+func (h HgVCS) MergeBase(path string) ([]byte, error)       { return hg.MergeBase(path) }
+func (h HgVCS) MarkResolved(path string) error              { return hg.MarkResolved(path) }
 func (h HgVCS) ParseFilesFromDiff(diffText string) []string { return hg.ParseFilesFromDiff(diffText) }
 func (h HgVCS) ExtractFileDiff(diffText, targetPath string) string {
 	return hg.ExtractFileDiff(diffText, targetPath)
 }
 
-func DetectVCS() VCS {
+func (s SvnVCS) Backend() Backend         { return svnBackend }
+func (s SvnVCS) GetCurrentBranch() string { return svn.GetCurrentBranch() }
+func (s SvnVCS) GetRepoName() string      { return svn.GetRepoName() }
+func (s SvnVCS) ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	return svn.ListChangedFiles(ctx, targetBranch, opts)
+}
+func (s SvnVCS) RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	return svn.RenamesByFile(ctx, targetBranch, opts)
+}
+func (s SvnVCS) DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	svnCmd := svn.DiffCmd(ctx, targetBranch, path, oldPath, opts)
+	return func() tea.Msg {
+		msg := svnCmd()
+		if svnMsg, ok := msg.(svn.DiffMsg); ok {
+			return DiffMsg{Content: svnMsg.Content, Path: path, Err: svnMsg.Err}
+		}
+		return msg
+	}
+}
+func (s SvnVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	svnCmd := svn.OpenEditorCmd(path, lineNumber, targetBranch, editor)
+	return func() tea.Msg {
+		msg := svnCmd()
+		if svnMsg, ok := msg.(svn.EditorFinishedMsg); ok {
+			return EditorFinishedMsg{Err: svnMsg.Err}
+		}
+		return msg
+	}
+}
+func (s SvnVCS) Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	return svn.Stats(ctx, targetBranch, opts)
+}
+func (s SvnVCS) FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	return svn.FileContents(ctx, targetBranch, path, oldPath)
+}
+func (s SvnVCS) WorkingFile(path string) string { return svn.WorkingFile(path) }
+
+func (s SvnVCS) ParseFilesFromDiff(diffText string) []string { return svn.ParseFilesFromDiff(diffText) }
+func (s SvnVCS) ExtractFileDiff(diffText, targetPath string) string {
+	return svn.ExtractFileDiff(diffText, targetPath)
+}
+
+func (f FossilVCS) Backend() Backend         { return fossilBackend }
+func (f FossilVCS) GetCurrentBranch() string { return fossil.GetCurrentBranch() }
+func (f FossilVCS) GetRepoName() string      { return fossil.GetRepoName() }
+func (f FossilVCS) ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	return fossil.ListChangedFiles(ctx, targetBranch, opts)
+}
+func (f FossilVCS) RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	return fossil.RenamesByFile(ctx, targetBranch, opts)
+}
+func (f FossilVCS) DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	fossilCmd := fossil.DiffCmd(ctx, targetBranch, path, oldPath, opts)
+	return func() tea.Msg {
+		msg := fossilCmd()
+		if fossilMsg, ok := msg.(fossil.DiffMsg); ok {
+			return DiffMsg{Content: fossilMsg.Content, Path: path, Err: fossilMsg.Err}
+		}
+		return msg
+	}
+}
+func (f FossilVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	fossilCmd := fossil.OpenEditorCmd(path, lineNumber, targetBranch, editor)
+	return func() tea.Msg {
+		msg := fossilCmd()
+		if fossilMsg, ok := msg.(fossil.EditorFinishedMsg); ok {
+			return EditorFinishedMsg{Err: fossilMsg.Err}
+		}
+		return msg
+	}
+}
+func (f FossilVCS) Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	return fossil.Stats(ctx, targetBranch, opts)
+}
+func (f FossilVCS) FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	return fossil.FileContents(ctx, targetBranch, path, oldPath)
+}
+func (f FossilVCS) WorkingFile(path string) string { return fossil.WorkingFile(path) }
+
+func (f FossilVCS) ParseFilesFromDiff(diffText string) []string {
+	return fossil.ParseFilesFromDiff(diffText)
+}
+func (f FossilVCS) ExtractFileDiff(diffText, targetPath string) string {
+	return fossil.ExtractFileDiff(diffText, targetPath)
+}
+
+// Backend is labeled "diff"; path comparisons have no history.
+func (p PathVCS) Backend() Backend         { return Backend{Name: "diff"} }
+func (p PathVCS) GetCurrentBranch() string { return filepath.Base(p.Pair.Right) }
+func (p PathVCS) GetRepoName() string {
 	dir, err := os.Getwd()
 	if err != nil {
-		return GitVCS{}
+		return "Repo"
 	}
+	return filepath.Base(dir)
+}
+func (p PathVCS) ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	return p.Pair.ListChangedFiles()
+}
 
-	checkDir := dir
-	for {
-		if _, err := os.Stat(filepath.Join(checkDir, ".git")); err == nil {
-			return GitVCS{}
+// RenamesByFile reports nothing: files on disk carry no rename history.
+func (p PathVCS) RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	return map[string]diff.Rename{}, nil
+}
+func (p PathVCS) DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	pathCmd := p.Pair.DiffCmd(path, opts)
+	return func() tea.Msg {
+		msg := pathCmd()
+		if pathMsg, ok := msg.(pathdiff.DiffMsg); ok {
+			return DiffMsg{Content: pathMsg.Content, Path: path, Err: pathMsg.Err}
 		}
-		parent := filepath.Dir(checkDir)
-		if parent == checkDir {
-			break
+		return msg
+	}
+}
+func (p PathVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	pathCmd := p.Pair.OpenEditorCmd(path, lineNumber, targetBranch, editor)
+	return func() tea.Msg {
+		msg := pathCmd()
+		if pathMsg, ok := msg.(pathdiff.EditorFinishedMsg); ok {
+			return EditorFinishedMsg{Err: pathMsg.Err}
 		}
-		checkDir = parent
+		return msg
 	}
+}
+func (p PathVCS) Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	return p.Pair.Stats(opts)
+}
+func (p PathVCS) FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	return p.Pair.File(path)
+}
+func (p PathVCS) ParseFilesFromDiff(diffText string) []string {
+	return git.ParseFilesFromDiff(diffText)
+}
+func (p PathVCS) ExtractFileDiff(diffText, targetPath string) string {
+	return git.ExtractFileDiff(diffText, targetPath)
+}
 
-	checkDir = dir
-	for {
-		if _, err := os.Stat(filepath.Join(checkDir, ".hg")); err == nil {
-			return HgVCS{}
+// Backend reports the name, default target and capabilities the plugin
+// declared when it detected the repository. Unknown capability names are
+// ignored.
+func (p PluginVCS) Backend() Backend {
+	b := Backend{Name: p.Plugin.Name, DefaultTarget: p.Plugin.DefaultTarget}
+	for _, name := range p.Plugin.Capabilities {
+		if c, ok := ParseCapability(name); ok {
+			b.Capabilities |= c
 		}
-		parent := filepath.Dir(checkDir)
-		if parent == checkDir {
-			break
+	}
+	return b
+}
+func (p PluginVCS) GetCurrentBranch() string { return p.Plugin.GetCurrentBranch() }
+func (p PluginVCS) GetRepoName() string      { return p.Plugin.GetRepoName() }
+func (p PluginVCS) ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error) {
+	return p.Plugin.ListChangedFiles(ctx, targetBranch, opts)
+}
+func (p PluginVCS) RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error) {
+	return p.Plugin.RenamesByFile(ctx, targetBranch, opts)
+}
+func (p PluginVCS) DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd {
+	pluginCmd := p.Plugin.DiffCmd(ctx, targetBranch, path, oldPath, opts)
+	return func() tea.Msg {
+		msg := pluginCmd()
+		if pluginMsg, ok := msg.(plugin.DiffMsg); ok {
+			return DiffMsg{Content: pluginMsg.Content, Path: path, Err: pluginMsg.Err}
+		}
+		return msg
+	}
+}
+func (p PluginVCS) OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd {
+	pluginCmd := p.Plugin.OpenEditorCmd(path, lineNumber, targetBranch, editor)
+	return func() tea.Msg {
+		msg := pluginCmd()
+		if pluginMsg, ok := msg.(plugin.EditorFinishedMsg); ok {
+			return EditorFinishedMsg{Err: pluginMsg.Err}
 		}
-		checkDir = parent
+		return msg
 	}
+}
+func (p PluginVCS) Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error) {
+	return p.Plugin.Stats(ctx, targetBranch, opts)
+}
+func (p PluginVCS) FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error) {
+	return p.Plugin.FileContents(ctx, targetBranch, path, oldPath)
+}
+func (p PluginVCS) WorkingFile(path string) string { return p.Plugin.WorkingFile(path) }
+
+// Plugins return unified diffs, with git-style headers when they hold
+// more than one file, so git's parsers read them.
+func (p PluginVCS) ParseFilesFromDiff(diffText string) []string {
+	return git.ParseFilesFromDiff(diffText)
+}
+func (p PluginVCS) ExtractFileDiff(diffText, targetPath string) string {
+	return git.ExtractFileDiff(diffText, targetPath)
+}
 
+// DetectVCS picks the backend of the repository around the working
+// directory: the nearest directory holding a built-in backend's marker
+// decides, and registry order breaks ties within it. Plugins are asked only
+// when none of them recognizes the directory.
+func DetectVCS() VCS {
+	dir, err := os.Getwd()
+	if err != nil {
+		return GitVCS{}
+	}
+
+	if b, ok := nearestBackend(dir); ok {
+		return b.New()
+	}
+	if p, ok := plugin.Detect(dir); ok {
+		return PluginVCS{Plugin: p}
+	}
 	return GitVCS{}
 }
+
+// nearestBackend walks up from dir and returns the first backend whose
+// marker it finds, checking every backend at each level.
+func nearestBackend(dir string) (Backend, bool) {
+	for {
+		for _, b := range backends {
+			for _, marker := range b.Markers {
+				if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+					return b, true
+				}
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return Backend{}, false
+		}
+		dir = parent
+	}
+}
@@ -1,10 +1,13 @@
 package vcs
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
 )
 
 func TestDetectVCS_GitPriority(t *testing.T) {
@@ -109,6 +112,63 @@ func TestDetectVCS_HgOnly(t *testing.T) {
 	}
 }
 
+func TestDetectVCS_SvnOnly(t *testing.T) {
+	// A subdirectory of an svn working copy, which only has .svn at its root
+	tempDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tempDir, ".svn"), 0755); err != nil {
+		t.Fatalf("Failed to create .svn dir: %v", err)
+	}
+	subDir := filepath.Join(tempDir, "trunk", "src")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current dir: %v", err)
+	}
+	defer func() {
+		if err := os.Chdir(originalDir); err != nil {
+			t.Errorf("Failed to restore directory: %v", err)
+		}
+	}()
+
+	if err := os.Chdir(subDir); err != nil {
+		t.Fatalf("Failed to change to subdirectory: %v", err)
+	}
+
+	vcs := DetectVCS()
+	if reflect.TypeOf(vcs) != reflect.TypeOf(SvnVCS{}) {
+		t.Errorf("Expected SvnVCS, got %T", vcs)
+	}
+}
+
+func TestDetectVCS_Fossil(t *testing.T) {
+	// Unix checkouts mark their root with .fslckout, Windows ones with _FOSSIL_
+	for _, marker := range []string{".fslckout", "_FOSSIL_"} {
+		tempDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(tempDir, marker), nil, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", marker, err)
+		}
+
+		originalDir, err := os.Getwd()
+		if err != nil {
+			t.Fatalf("Failed to get current dir: %v", err)
+		}
+		if err := os.Chdir(tempDir); err != nil {
+			t.Fatalf("Failed to change to temp dir: %v", err)
+		}
+
+		vcs := DetectVCS()
+		if err := os.Chdir(originalDir); err != nil {
+			t.Errorf("Failed to restore directory: %v", err)
+		}
+		if reflect.TypeOf(vcs) != reflect.TypeOf(FossilVCS{}) {
+			t.Errorf("%s: expected FossilVCS, got %T", marker, vcs)
+		}
+	}
+}
+
 func TestDetectVCS_NoVCS(t *testing.T) {
 	// Create temporary directory structure without any VCS
 	tempDir := t.TempDir()
@@ -208,11 +268,57 @@ func TestDetectVCS_GitInParentHgInChild(t *testing.T) {
 		t.Fatalf("Failed to change to subdir: %v", err)
 	}
 
-	// Test detection - should prefer Git (due to Git-first priority) over closer .hg
-	// This tests our Git-first priority behavior
+	// Test detection - the nearer .hg wins over the enclosing .git
 	vcs := DetectVCS()
-	if reflect.TypeOf(vcs) != reflect.TypeOf(GitVCS{}) {
-		t.Errorf("Expected GitVCS (priority), got %T", vcs)
+	if reflect.TypeOf(vcs) != reflect.TypeOf(HgVCS{}) {
+		t.Errorf("Expected HgVCS (nearest), got %T", vcs)
+	}
+}
+
+func TestDetectVCS_NestedCheckout(t *testing.T) {
+	tests := []struct {
+		name   string
+		marker string
+		want   VCS
+	}{
+		{"svn", ".svn", SvnVCS{}},
+		{"fossil", ".fslckout", FossilVCS{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A checkout vendored inside a git repository, entered from below
+			// its root.
+			tempDir := t.TempDir()
+			checkout := filepath.Join(tempDir, "vendor", "lib")
+			nested := filepath.Join(checkout, "src")
+			if err := os.MkdirAll(nested, 0755); err != nil {
+				t.Fatalf("Failed to create nested dir: %v", err)
+			}
+			if err := os.Mkdir(filepath.Join(tempDir, ".git"), 0755); err != nil {
+				t.Fatalf("Failed to create .git dir: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(checkout, tt.marker), nil, 0644); err != nil {
+				t.Fatalf("Failed to create %s: %v", tt.marker, err)
+			}
+
+			originalDir, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("Failed to get current dir: %v", err)
+			}
+			defer func() {
+				if err := os.Chdir(originalDir); err != nil {
+					t.Errorf("Failed to restore directory: %v", err)
+				}
+			}()
+			if err := os.Chdir(nested); err != nil {
+				t.Fatalf("Failed to change to nested dir: %v", err)
+			}
+
+			vcs := DetectVCS()
+			if reflect.TypeOf(vcs) != reflect.TypeOf(tt.want) {
+				t.Errorf("Expected %T (nearest), got %T", tt.want, vcs)
+			}
+		})
 	}
 }
 
@@ -226,7 +332,7 @@ func TestVCSInterface_GitVCS(t *testing.T) {
 
 	// Test that the interface methods exist and can be called
 	// (actual functionality would require a git repo, so we just test the interface)
-	files, _ := vcs.ListChangedFiles("main")
+	files, _ := vcs.ListChangedFiles(context.Background(), "main", diff.Options{})
 	if files == nil {
 		files = []string{} // Just to use the variable
 	}
@@ -242,12 +348,18 @@ func TestVCSInterface_HgVCS(t *testing.T) {
 
 	// Test that the interface methods exist and can be called
 	// (actual functionality would require an hg repo, so we just test the interface)
-	files, _ := vcs.ListChangedFiles("default")
+	files, _ := vcs.ListChangedFiles(context.Background(), "default", diff.Options{})
 	if files == nil {
 		files = []string{} // Just to use the variable
 	}
 }
 
+func TestVCSInterface_SvnFossil(t *testing.T) {
+	// Compile-time checks that SvnVCS and FossilVCS implement VCS
+	var _ VCS = SvnVCS{}
+	var _ VCS = FossilVCS{}
+}
+
 func TestDetectVCS_ErrorHandling(t *testing.T) {
 	// Test behavior when os.Getwd() might fail
 	// We can't easily simulate os.Getwd() failure, but we can test
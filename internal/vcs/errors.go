@@ -0,0 +1,114 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// Kinds of failure the UI and --plain tell apart. Classify sorts backend
+// errors into them.
+var (
+	ErrUnknownRevision = errors.New("unknown revision")
+	ErrNotRepository   = errors.New("not a repository")
+	ErrToolMissing     = errors.New("VCS tool not found")
+	ErrTimeout         = errors.New("timed out")
+)
+
+// Error is a failed VCS operation. errors.Is matches it against its Kind
+// as well as the errors it wraps.
+type Error struct {
+	// Kind is one of the Err variables above, or nil when the failure was
+	// not recognized.
+	Kind error
+	Err  error
+	// Detail is the first line the tool printed on stderr, which usually
+	// says more than its exit status.
+	Detail string
+}
+
+func (e *Error) Error() string {
+	if e.Kind == ErrTimeout {
+		// The tool was killed, so its exit status and output say nothing.
+		return e.Kind.Error()
+	}
+	msg := e.Err.Error()
+	if e.Detail != "" {
+		msg = e.Detail
+	}
+	if e.Kind != nil && !strings.Contains(strings.ToLower(msg), e.Kind.Error()) {
+		msg = e.Kind.Error() + ": " + msg
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// stderrKinds maps what git, hg, svn and fossil print for a failure to its
+// kind. Matching is case-insensitive.
+var stderrKinds = []struct {
+	text string
+	kind error
+}{
+	{"unknown revision", ErrUnknownRevision},
+	{"bad revision", ErrUnknownRevision},
+	{"not a valid object name", ErrUnknownRevision},
+	{"invalid object name", ErrUnknownRevision},
+	{"no such revision", ErrUnknownRevision},
+	{"syntax error in revision argument", ErrUnknownRevision},
+	{"no such check-in", ErrUnknownRevision},
+	{"not a git repository", ErrNotRepository},
+	{"no repository found", ErrNotRepository},
+	{"is not a working copy", ErrNotRepository},
+	{"not within an open checkout", ErrNotRepository},
+}
+
+// Classify wraps err, returned by an operation run under ctx, in an *Error
+// of the matching kind. It returns nil for nil and errors that are already
+// classified unchanged.
+func Classify(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	e = &Error{Err: err}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.Detail = firstLine(string(exitErr.Stderr))
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded):
+		e.Kind = ErrTimeout
+		return e
+	case errors.Is(err, exec.ErrNotFound):
+		e.Kind = ErrToolMissing
+		return e
+	}
+	text := strings.ToLower(e.Detail + "\n" + err.Error())
+	for _, k := range stderrKinds {
+		if strings.Contains(text, k.text) {
+			e.Kind = k.kind
+			break
+		}
+	}
+	return e
+}
+
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// failing runs a shell command that prints stderr and exits with 128, like
+// git does for a bad revision.
+func failing(t *testing.T, stderr string) error {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not installed")
+	}
+	_, err := exec.Command("sh", "-c", "echo \"$0\" >&2; exit 128", stderr).Output()
+	if err == nil {
+		t.Fatal("command succeeded")
+	}
+	return err
+}
+
+func TestClassify(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		stderr string
+		kind   error
+	}{
+		{"fatal: bad revision 'nope'", ErrUnknownRevision},
+		{"abort: unknown revision 'nope'", ErrUnknownRevision},
+		{"svn: E160006: No such revision 99", ErrUnknownRevision},
+		{"fatal: not a git repository (or any of the parent directories): .git", ErrNotRepository},
+		{"abort: no repository found in '/tmp' (.hg not found)!", ErrNotRepository},
+		{"svn: E155007: '/tmp' is not a working copy", ErrNotRepository},
+		{"fatal: unable to read tree", nil},
+	}
+	for _, tt := range tests {
+		err := Classify(ctx, failing(t, tt.stderr))
+		var e *Error
+		if !errors.As(err, &e) || e.Kind != tt.kind {
+			t.Errorf("Classify(%q) = %v, want kind %v", tt.stderr, err, tt.kind)
+			continue
+		}
+		// The tool's message says more than "exit status 128".
+		if e.Detail != tt.stderr {
+			t.Errorf("Classify(%q) detail = %q", tt.stderr, e.Detail)
+		}
+		if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("errors.Is(%v, %v) = false", err, tt.kind)
+		}
+	}
+
+	_, err := exec.Command("difi-no-such-tool").Output()
+	if err := Classify(ctx, err); !errors.Is(err, ErrToolMissing) || !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("Classify(missing tool) = %v", err)
+	}
+
+	expired, cancel := context.WithTimeout(ctx, time.Nanosecond)
+	defer cancel()
+	<-expired.Done()
+	if err := Classify(expired, errors.New("signal: killed")); !errors.Is(err, ErrTimeout) || err.Error() != "timed out" {
+		t.Errorf("Classify(expired) = %v", err)
+	}
+
+	if Classify(ctx, nil) != nil {
+		t.Error("Classify(nil) != nil")
+	}
+	first := Classify(ctx, failing(t, "fatal: bad revision 'x'"))
+	if again := Classify(ctx, first); again != first {
+		t.Errorf("Classify() reclassified %v as %v", first, again)
+	}
+}
@@ -1,19 +1,98 @@
 package vcs
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	"context"
+	"io"
 
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oug-t/difi/internal/diff"
+	"github.com/oug-t/difi/internal/submodule"
+)
+
+// VCS is a repository backend. The operations that take a context run
+// subprocesses, which are killed when the context is done.
 type VCS interface {
+	// Backend describes the kind of repository, for labels, default targets
+	// and capabilities.
+	Backend() Backend
 	GetCurrentBranch() string
 	GetRepoName() string
-	ListChangedFiles(targetBranch string) ([]string, error)
-	DiffCmd(targetBranch, path string) tea.Cmd
+	ListChangedFiles(ctx context.Context, targetBranch string, opts diff.Options) ([]string, error)
+	RenamesByFile(ctx context.Context, targetBranch string, opts diff.Options) (map[string]diff.Rename, error)
+	DiffCmd(ctx context.Context, targetBranch, path, oldPath string, opts diff.Options) tea.Cmd
 	OpenEditorCmd(path string, lineNumber int, targetBranch string, editor string) tea.Cmd
-	DiffStats(targetBranch string) (added int, deleted int, err error)
-	DiffStatsByFile(targetBranch string) (map[string][2]int, error)
-	CalculateFileLine(diffContent string, visualLineIndex int) int
+	// Stats counts the changed lines, in all and per file, and finds the
+	// binary files, running the backend's stats or diff command once.
+	Stats(ctx context.Context, targetBranch string, opts diff.Options) (diff.Summary, error)
+	// FileContents loads both versions of a file, for views the diff text
+	// cannot drive, such as the binary summary.
+	FileContents(ctx context.Context, targetBranch, path, oldPath string) (diff.File, error)
 	ParseFilesFromDiff(diffText string) []string
 	ExtractFileDiff(diffText, targetPath string) string
 }
 
-type DiffMsg struct{ Content string }
+// LFS is implemented by backends that store large files as Git LFS
+// pointers.
+type LFS interface {
+	LFSFiles(files []string) (map[string]bool, error)
+	// LFSObject reads an object from the local cache, or returns nil when it
+	// has not been downloaded.
+	LFSObject(oid string) ([]byte, error)
+}
+
+// Submodules is implemented by backends whose repositories can nest other
+// repositories: git submodules and hg subrepos.
+type Submodules interface {
+	SubmoduleChanges(path, diffText string) []submodule.Change
+	SubmoduleLog(c submodule.Change) (submodule.Log, error)
+	// SubmoduleArgs returns where and with which arguments to run a nested
+	// difi on the change.
+	SubmoduleArgs(c submodule.Change) (dir string, args []string)
+}
+
+// Worktree is implemented by backends whose changes include files on disk,
+// so callers can tell when a changed file was edited.
+type Worktree interface {
+	// WorkingFile returns the on-disk location of a repository path.
+	WorkingFile(path string) string
+}
+
+// Ignores is implemented by backends with ignore files, so a watcher can
+// skip what the repository leaves out.
+type Ignores interface {
+	// Ignored returns the paths among paths, which are absolute, that the
+	// repository ignores.
+	Ignored(paths []string) (map[string]bool, error)
+}
+
+// Batch is implemented by backends that can print the diffs of all changed
+// files in one run, which beats one run per file on large change sets.
+type Batch interface {
+	// StreamDiff returns the diff of every changed file in git format as it
+	// is produced. The reader must be closed; Close reports the
+	// subprocess's failure.
+	StreamDiff(ctx context.Context, targetBranch string, opts diff.Options) (io.ReadCloser, error)
+}
+
+// Conflicts is implemented by backends that can list and resolve the files
+// of an interrupted merge.
+type Conflicts interface {
+	Worktree
+	UnmergedFiles() ([]string, error)
+	// MergeBase returns path as it was in the common ancestor, or nil
+	// when it was not there.
+	MergeBase(path string) ([]byte, error)
+	MarkResolved(path string) error
+}
+
+// DiffMsg carries the diff DiffCmd loaded for Path, or the error that kept
+// it from loading. ID is left for the caller to tag requests with, so
+// replies to superseded ones can be told apart.
+type DiffMsg struct {
+	Content string
+	Path    string
+	ID      int
+	Err     error
+}
+
 type EditorFinishedMsg struct{ Err error }
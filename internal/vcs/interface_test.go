@@ -1,8 +1,11 @@
 package vcs
 
 import (
+	"context"
 	"os"
 	"testing"
+
+	"github.com/oug-t/difi/internal/diff"
 )
 
 // TestVCSInterfaceConsistency tests that both Git and Mercurial VCS implementations
@@ -57,34 +60,22 @@ func TestVCSInterfaceConsistency(t *testing.T) {
 				// Test with common branch names
 				testBranches := []string{"main", "master", "default", "HEAD"}
 				for _, branch := range testBranches {
-					files, err := vcs.ListChangedFiles(branch)
+					files, err := vcs.ListChangedFiles(context.Background(), branch, diff.Options{})
 					// Error is expected if not in a repo, but shouldn't panic
 					_ = files
 					_ = err
 				}
 			})
 
-			t.Run("DiffStats", func(t *testing.T) {
+			t.Run("Stats", func(t *testing.T) {
 				defer func() {
 					if r := recover(); r != nil {
-						t.Errorf("%s DiffStats() panicked: %v", impl.name, r)
+						t.Errorf("%s Stats() panicked: %v", impl.name, r)
 					}
 				}()
-				added, deleted, err := vcs.DiffStats("main")
+				s, err := vcs.Stats(context.Background(), "main", diff.Options{})
 				// Error is expected if not in a repo, but shouldn't panic
-				_ = added
-				_ = deleted
-				_ = err
-			})
-
-			t.Run("DiffStatsByFile", func(t *testing.T) {
-				defer func() {
-					if r := recover(); r != nil {
-						t.Errorf("%s DiffStatsByFile() panicked: %v", impl.name, r)
-					}
-				}()
-				byFile, err := vcs.DiffStatsByFile("main")
-				_ = byFile
+				_ = s
 				_ = err
 			})
 
@@ -115,20 +106,6 @@ func TestVCSInterfaceConsistency(t *testing.T) {
 					t.Errorf("%s ExtractFileDiff('some diff', '') should return empty string, got %q", impl.name, result)
 				}
 			})
-
-			t.Run("CalculateFileLine", func(t *testing.T) {
-				// Test with empty diff
-				line := vcs.CalculateFileLine("", 0)
-				if line != 1 && line != 0 {
-					t.Errorf("%s CalculateFileLine('', 0) should return 1 or 0, got %d", impl.name, line)
-				}
-
-				// Test with out-of-bounds index
-				line = vcs.CalculateFileLine("single line", 10)
-				if line < 0 {
-					t.Errorf("%s CalculateFileLine with out-of-bounds index should not return negative, got %d", impl.name, line)
-				}
-			})
 		})
 	}
 }
@@ -0,0 +1,119 @@
+package vcs
+
+import "strings"
+
+// Capability is what a backend's targets can name beyond its default. The
+// UI suggests targets by capability instead of checking for concrete
+// backend types. Features that need more than the VCS interface, such as
+// conflicts or LFS, are offered through optional interfaces instead.
+type Capability uint
+
+const (
+	// MergeBase means "A...B" targets compare B with where it forked from A.
+	MergeBase Capability = 1 << iota
+	// Commits means targets can name past commits and ranges of them.
+	Commits
+)
+
+var capabilityNames = []struct {
+	cap  Capability
+	name string
+}{
+	{MergeBase, "merge-base"},
+	{Commits, "commits"},
+}
+
+// ParseCapability reads a capability name, as plugins declare them.
+func ParseCapability(name string) (Capability, bool) {
+	for _, c := range capabilityNames {
+		if c.name == name {
+			return c.cap, true
+		}
+	}
+	return 0, false
+}
+
+// String lists the capabilities in c by name, separated by spaces.
+func (c Capability) String() string {
+	var names []string
+	for _, n := range capabilityNames {
+		if c&n.cap != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// Backend describes a kind of repository difi can review.
+type Backend struct {
+	// Name is the --vcs value and the label in the top bar.
+	Name string
+	// Markers are the files or directories found at a repository's root.
+	Markers []string
+	// DefaultTarget is what changes are compared against when no target is
+	// given.
+	DefaultTarget string
+	Capabilities  Capability
+	// New returns the backend's VCS; nil for backends that are not in the
+	// registry, such as plugins and path comparisons.
+	New func() VCS
+}
+
+// Has reports whether the backend offers c.
+func (b Backend) Has(c Capability) bool {
+	return b.Capabilities&c == c
+}
+
+var (
+	gitBackend = Backend{
+		Name: "git", Markers: []string{".git"}, DefaultTarget: "HEAD",
+		Capabilities: MergeBase | Commits,
+		New:          func() VCS { return GitVCS{} },
+	}
+	hgBackend = Backend{
+		Name: "hg", Markers: []string{".hg"}, DefaultTarget: "tip",
+		Capabilities: Commits,
+		New:          func() VCS { return HgVCS{} },
+	}
+	// svn compares the working copy with its pristine BASE by default.
+	svnBackend = Backend{
+		Name: "svn", Markers: []string{".svn"}, DefaultTarget: "BASE",
+		Capabilities: Commits,
+		New:          func() VCS { return SvnVCS{} },
+	}
+	// fossil compares the checkout with the check-in it is based on.
+	fossilBackend = Backend{
+		Name: "fossil", Markers: []string{".fslckout", "_FOSSIL_"}, DefaultTarget: "current",
+		Capabilities: Commits,
+		New:          func() VCS { return FossilVCS{} },
+	}
+)
+
+// backends lists the built-in backends in detection order. The nearest
+// repository wins; where one directory holds several markers, as in git-svn
+// and hg-git clones, the earlier backend does.
+var backends = []Backend{gitBackend, hgBackend, svnBackend, fossilBackend}
+
+// Backends returns the built-in backends in detection order.
+func Backends() []Backend {
+	return append([]Backend(nil), backends...)
+}
+
+// LookupBackend finds a built-in backend by name.
+func LookupBackend(name string) (Backend, bool) {
+	for _, b := range backends {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return Backend{}, false
+}
+
+// BackendNames returns the names of the built-in backends.
+func BackendNames() []string {
+	names := make([]string, len(backends))
+	for i, b := range backends {
+		names[i] = b.Name
+	}
+	return names
+}
@@ -0,0 +1,60 @@
+package vcs
+
+import (
+	"testing"
+
+	"github.com/oug-t/difi/internal/plugin"
+)
+
+func TestLookupBackend(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		vcs    VCS
+	}{
+		{"git", "HEAD", GitVCS{}},
+		{"hg", "tip", HgVCS{}},
+		{"svn", "BASE", SvnVCS{}},
+		{"fossil", "current", FossilVCS{}},
+	}
+	for _, tt := range tests {
+		b, ok := LookupBackend(tt.name)
+		if !ok {
+			t.Fatalf("LookupBackend(%q) not found", tt.name)
+		}
+		if b.DefaultTarget != tt.target {
+			t.Errorf("%s default target = %q, want %q", tt.name, b.DefaultTarget, tt.target)
+		}
+		if got := b.New(); got != tt.vcs {
+			t.Errorf("%s New() = %T, want %T", tt.name, got, tt.vcs)
+		}
+		// Each backend's VCS describes itself with its registry entry.
+		if got := tt.vcs.Backend().Name; got != tt.name {
+			t.Errorf("%T.Backend().Name = %q, want %q", tt.vcs, got, tt.name)
+		}
+	}
+	if _, ok := LookupBackend("cvs"); ok {
+		t.Error("LookupBackend(cvs) succeeded")
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	git, _ := LookupBackend("git")
+	hg, _ := LookupBackend("hg")
+	if !git.Has(MergeBase|Commits) || hg.Has(MergeBase) || !hg.Has(Commits) {
+		t.Errorf("git = %v, hg = %v", git.Capabilities, hg.Capabilities)
+	}
+	if got := (MergeBase | Commits).String(); got != "merge-base commits" {
+		t.Errorf("String() = %q", got)
+	}
+
+	p := PluginVCS{Plugin: plugin.Plugin{Name: "jj", DefaultTarget: "@-", Capabilities: []string{"commits", "merge-base", "telepathy"}}}
+	b := p.Backend()
+	if b.Name != "jj" || b.DefaultTarget != "@-" || b.Capabilities != Commits|MergeBase {
+		t.Errorf("plugin Backend() = %+v", b)
+	}
+
+	if b := (PathVCS{}).Backend(); b.Name != "diff" || b.Capabilities != 0 {
+		t.Errorf("PathVCS Backend() = %+v", b)
+	}
+}
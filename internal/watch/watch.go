@@ -0,0 +1,55 @@
+// Package watch reports edits to the files of a working tree, so a review
+// can follow along with changes made in another terminal.
+package watch
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned by New on platforms without a watcher.
+var ErrUnsupported = errors.New("watching files is not supported on this platform")
+
+// Options tune a Watcher.
+type Options struct {
+	// Meta names the directories at the root that hold the repository's
+	// own data, like ".git". Their files are watched, since a commit or
+	// a staged change alters the diff, but not their subdirectories.
+	Meta []string
+	// Ignored returns the paths among paths that the repository ignores.
+	// Ignored directories are not watched and edits to ignored files are
+	// dropped. Nil ignores nothing.
+	Ignored func(paths []string) map[string]bool
+	// Debounce is how long the tree has to stay quiet before the edits
+	// are reported together.
+	Debounce time.Duration
+}
+
+// Change is a burst of edits. Err reports a problem that left part of the
+// tree unwatched, such as running out of inotify watches; the Watcher keeps
+// going with the rest.
+type Change struct {
+	Paths []string
+	Err   error
+}
+
+// Watcher watches a tree until closed. Its Changes channel is closed once
+// it stops.
+type Watcher struct {
+	changes chan Change
+	impl    closer
+}
+
+type closer interface {
+	Close() error
+}
+
+// Changes delivers the edits under the root, absolute paths included.
+func (w *Watcher) Changes() <-chan Change {
+	return w.changes
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.impl.Close()
+}
@@ -0,0 +1,261 @@
+package watch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// watchMask selects the events that can change a diff: content, mode and
+// the files and directories coming and going.
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+// inotify watches every directory of the tree, since inotify is not
+// recursive.
+type inotify struct {
+	file    *os.File
+	fd      int
+	root    string
+	opts    Options
+	dirs    map[int32]string // watch descriptor to directory
+	meta    map[int32]bool   // watches of repository data directories
+	changes chan Change
+	done    chan struct{} // closed by Close
+	once    sync.Once
+}
+
+type event struct {
+	wd   int32
+	mask uint32
+	name string
+}
+
+// New starts watching the tree under root. The directories are added in
+// the background, so a large tree does not hold up the caller.
+func New(root string, opts Options) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	in := &inotify{
+		// A non-blocking descriptor goes through the runtime poller, so
+		// closing the file ends a pending Read.
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		root:    filepath.Clean(root),
+		opts:    opts,
+		dirs:    make(map[int32]string),
+		meta:    make(map[int32]bool),
+		changes: make(chan Change, 1),
+		done:    make(chan struct{}),
+	}
+	go in.run()
+	return &Watcher{changes: in.changes, impl: in}, nil
+}
+
+// Close stops run and read even when nobody takes their changes anymore.
+func (in *inotify) Close() error {
+	in.once.Do(func() { close(in.done) })
+	return in.file.Close()
+}
+
+// run adds the tree and then gathers events until the file is closed,
+// reporting them once Debounce has passed without another.
+func (in *inotify) run() {
+	defer close(in.changes)
+	events := make(chan []event)
+	go in.read(events)
+
+	var errs []error
+	if err := in.addTree(in.root); err != nil {
+		errs = append(errs, err)
+	}
+	pending := make(map[string]bool) // path to whether it may be ignored
+	var quiet <-chan time.Time
+	if len(errs) > 0 {
+		quiet = time.After(0)
+	}
+	for {
+		select {
+		case evs, ok := <-events:
+			if !ok {
+				return
+			}
+			for _, ev := range evs {
+				if err := in.handle(ev, pending); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if len(pending) > 0 || len(errs) > 0 {
+				quiet = time.After(in.opts.Debounce)
+			}
+		case <-quiet:
+			quiet = nil
+			c := Change{Paths: in.filter(pending), Err: errors.Join(errs...)}
+			clear(pending)
+			errs = nil
+			if len(c.Paths) > 0 || c.Err != nil {
+				select {
+				case in.changes <- c:
+				case <-in.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// read decodes the events inotify writes to the file.
+func (in *inotify) read(events chan<- []event) {
+	defer close(events)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := in.file.Read(buf)
+		if err != nil {
+			return
+		}
+		var evs []event
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			evs = append(evs, event{
+				wd:   int32(binary.NativeEndian.Uint32(buf[off:])),
+				mask: binary.NativeEndian.Uint32(buf[off+4:]),
+				name: strings.TrimRight(string(buf[start:start+nameLen]), "\x00"),
+			})
+			off = start + nameLen
+		}
+		select {
+		case events <- evs:
+		case <-in.done:
+			return
+		}
+	}
+}
+
+// handle records the path an event is about, and starts watching the
+// directories that appear.
+func (in *inotify) handle(ev event, pending map[string]bool) error {
+	if ev.mask&syscall.IN_Q_OVERFLOW != 0 {
+		// Events were lost; something changed somewhere.
+		pending[in.root] = false
+		return nil
+	}
+	dir, ok := in.dirs[ev.wd]
+	if !ok {
+		return nil
+	}
+	if ev.mask&syscall.IN_IGNORED != 0 {
+		delete(in.dirs, ev.wd)
+		delete(in.meta, ev.wd)
+		return nil
+	}
+	if ev.name == "" || (dir == in.root && slices.Contains(in.opts.Meta, ev.name)) {
+		return nil
+	}
+	path := filepath.Join(dir, ev.name)
+	if in.meta[ev.wd] {
+		// Lock files come and go around every write of the real file.
+		if !strings.HasSuffix(ev.name, ".lock") {
+			pending[path] = false
+		}
+		return nil
+	}
+	pending[path] = true
+	if ev.mask&syscall.IN_ISDIR != 0 && ev.mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		if in.ignored([]string{path})[path] {
+			return nil
+		}
+		return in.addTree(path)
+	}
+	return nil
+}
+
+// addTree watches dir and the directories below it that are not ignored,
+// one level at a time so each level is checked in a single call.
+func (in *inotify) addTree(dir string) error {
+	level := []string{dir}
+	for len(level) > 0 {
+		var next []string
+		for _, d := range level {
+			if err := in.add(d, false); err != nil {
+				return err
+			}
+			entries, err := os.ReadDir(d)
+			if err != nil {
+				continue // removed since it was seen
+			}
+			for _, e := range entries {
+				// Symbolic links are not followed: IsDir is false for them.
+				if !e.IsDir() {
+					continue
+				}
+				path := filepath.Join(d, e.Name())
+				if !slices.Contains(in.opts.Meta, e.Name()) {
+					next = append(next, path)
+				} else if d == in.root {
+					if err := in.add(path, true); err != nil {
+						return err
+					}
+				}
+				// Nested repositories' data is left alone.
+			}
+		}
+		ignored := in.ignored(next)
+		level = slices.DeleteFunc(next, func(p string) bool { return ignored[p] })
+	}
+	return nil
+}
+
+func (in *inotify) add(dir string, meta bool) error {
+	wd, err := syscall.InotifyAddWatch(in.fd, dir, watchMask)
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return fmt.Errorf("watching %s: too many directories; raise fs.inotify.max_user_watches", dir)
+	case errors.Is(err, syscall.ENOENT), errors.Is(err, syscall.ENOTDIR):
+		return nil
+	case err != nil:
+		return fmt.Errorf("watching %s: %w", dir, err)
+	}
+	in.dirs[int32(wd)] = dir
+	if meta {
+		in.meta[int32(wd)] = true
+	}
+	return nil
+}
+
+func (in *inotify) ignored(paths []string) map[string]bool {
+	if in.opts.Ignored == nil || len(paths) == 0 {
+		return nil
+	}
+	return in.opts.Ignored(paths)
+}
+
+// filter drops the ignored paths of a burst and sorts the rest.
+func (in *inotify) filter(pending map[string]bool) []string {
+	var check, paths []string
+	for path, mayIgnore := range pending {
+		if mayIgnore {
+			check = append(check, path)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+	ignored := in.ignored(check)
+	for _, path := range check {
+		if !ignored[path] {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
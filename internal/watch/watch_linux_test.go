@@ -0,0 +1,137 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// next waits for the next change, or returns false after timeout.
+func next(t *testing.T, w *Watcher, timeout time.Duration) (Change, bool) {
+	t.Helper()
+	select {
+	case c, ok := <-w.Changes():
+		if !ok {
+			t.Fatal("Changes() closed early")
+		}
+		return c, true
+	case <-time.After(timeout):
+		return Change{}, false
+	}
+}
+
+func TestChanges(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "src", "a.go"), "a")
+	writeFile(t, filepath.Join(root, ".git", "objects", "x"), "x")
+	writeFile(t, filepath.Join(root, "build", "out"), "o")
+
+	w, err := New(root, Options{
+		Meta: []string{".git"},
+		Ignored: func(paths []string) map[string]bool {
+			ignored := make(map[string]bool)
+			for _, p := range paths {
+				if filepath.Base(p) == "build" || strings.HasSuffix(p, ".log") {
+					ignored[p] = true
+				}
+			}
+			return ignored
+		},
+		Debounce: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+	// Let the tree be added before editing it.
+	time.Sleep(100 * time.Millisecond)
+
+	a := filepath.Join(root, "src", "a.go")
+	writeFile(t, a, "b")
+	writeFile(t, a, "c")
+	c, ok := next(t, w, 2*time.Second)
+	if !ok || c.Err != nil || !slices.Equal(c.Paths, []string{a}) {
+		t.Fatalf("change = %+v, %v, want one burst for %s", c, ok, a)
+	}
+
+	writeFile(t, filepath.Join(root, "debug.log"), "ignored")
+	writeFile(t, filepath.Join(root, "build", "out"), "ignored directory")
+	writeFile(t, filepath.Join(root, ".git", "objects", "y"), "below the data directory")
+	writeFile(t, filepath.Join(root, ".git", "index.lock"), "lock")
+	if c, ok := next(t, w, 200*time.Millisecond); ok {
+		t.Errorf("change = %+v, want none for ignored paths", c)
+	}
+
+	index := filepath.Join(root, ".git", "index")
+	writeFile(t, index, "staged")
+	if c, ok := next(t, w, 2*time.Second); !ok || !slices.Equal(c.Paths, []string{index}) {
+		t.Errorf("change = %+v, %v, want %s", c, ok, index)
+	}
+
+	// New directories are watched too.
+	if err := os.Mkdir(filepath.Join(root, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := next(t, w, 2*time.Second); !ok {
+		t.Fatal("no change for a new directory")
+	}
+	b := filepath.Join(root, "pkg", "b.go")
+	writeFile(t, b, "b")
+	if c, ok := next(t, w, 2*time.Second); !ok || !slices.Contains(c.Paths, b) {
+		t.Errorf("change = %+v, %v, want %s", c, ok, b)
+	}
+
+	w.Close()
+	if _, ok := <-w.Changes(); ok {
+		t.Error("Changes() still open after Close()")
+	}
+}
+
+// TestCloseUnread closes a watcher whose changes nobody reads anymore, as
+// quitting difi does.
+func TestCloseUnread(t *testing.T) {
+	root := t.TempDir()
+	w, err := New(root, Options{Debounce: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The first change fills the channel and the second waits to be sent.
+	writeFile(t, filepath.Join(root, "a"), "a")
+	time.Sleep(100 * time.Millisecond)
+	writeFile(t, filepath.Join(root, "b"), "b")
+	time.Sleep(100 * time.Millisecond)
+
+	w.Close()
+	time.Sleep(50 * time.Millisecond)
+	// Only the change already in the channel is left; the waiting one was
+	// dropped when the watcher stopped.
+	timeout := time.After(2 * time.Second)
+	for n := 0; ; n++ {
+		select {
+		case _, ok := <-w.Changes():
+			if !ok {
+				if n > 1 {
+					t.Errorf("got %d changes after Close(), want at most 1", n)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("Changes() still open after Close()")
+		}
+	}
+}
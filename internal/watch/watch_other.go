@@ -0,0 +1,8 @@
+//go:build !linux
+
+package watch
+
+// New is only implemented on Linux, with inotify.
+func New(root string, opts Options) (*Watcher, error) {
+	return nil, ErrUnsupported
+}